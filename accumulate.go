@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// LoadJSONReport reads the per-language statistics of a report printed by
+// the json output format. A missing or empty file holds no statistics. The
+// returned columns select the optional fields the report has.
+func LoadJSONReport(path string) (map[string]*LanguageStats, JSONColumns, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]*LanguageStats), JSONColumns{}, nil
+	}
+	if err != nil {
+		return nil, JSONColumns{}, err
+	}
+	langStats, cols, err := parseJSONReport(data)
+	if err != nil {
+		return nil, cols, fmt.Errorf("%s: %w", path, err)
+	}
+	return langStats, cols, nil
+}
+
+// parseJSONReport decodes the per-language statistics of a JSON report, as
+// described by LoadJSONReport. Empty data holds no statistics, and text after
+// the report, such as a trailing log line, is ignored.
+func parseJSONReport(data []byte) (map[string]*LanguageStats, JSONColumns, error) {
+	langStats := make(map[string]*LanguageStats)
+	var cols JSONColumns
+	if len(bytes.TrimSpace(data)) == 0 {
+		return langStats, cols, nil
+	}
+
+	var report struct {
+		Languages map[string]JSONStats `json:"languages"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&report); err != nil {
+		return nil, cols, err
+	}
+
+	for lang, stats := range report.Languages {
+		ls := &LanguageStats{
+			Language:   lang,
+			FileCount:  stats.Files.Count,
+			CodeLines:  stats.Code,
+			TotalLines: stats.Total,
+			Bytes:      stats.Bytes,
+		}
+		if stats.Blank != nil {
+			ls.BlankLines = *stats.Blank
+		}
+		if stats.Comment != nil {
+			ls.CommentLines = *stats.Comment
+		}
+		if stats.LineComment != nil && stats.BlockComment != nil {
+			ls.LineCommentLines, ls.BlockCommentLines = *stats.LineComment, *stats.BlockComment
+			cols.SplitComments = true
+		}
+		if stats.Functions != nil {
+			ls.Functions = *stats.Functions
+			cols.Functions = true
+		}
+		langStats[lang] = ls
+	}
+	return langStats, cols, nil
+}
+
+// MergeJSONReport adds the per-language statistics of the JSON report read
+// from r to langStats. Empty input holds no statistics.
+func MergeJSONReport(langStats map[string]*LanguageStats, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	merged, _, err := parseJSONReport(data)
+	if err != nil {
+		return err
+	}
+
+	for lang, ls := range merged {
+		if _, ok := langStats[lang]; !ok {
+			langStats[lang] = &LanguageStats{Language: lang}
+		}
+		langStats[lang].Add(ls)
+	}
+	return nil
+}
+
+// AccumulateReport adds langStats to the report at path, as read by
+// LoadJSONReport, and writes the combined report back in its place. The
+// optional fields of cols are written along with those the report had.
+func AccumulateReport(path string, langStats map[string]*LanguageStats, cols JSONColumns) error {
+	combined, had, err := LoadJSONReport(path)
+	if err != nil {
+		return err
+	}
+
+	for lang, ls := range langStats {
+		if _, ok := combined[lang]; !ok {
+			combined[lang] = &LanguageStats{Language: lang}
+		}
+		combined[lang].Add(ls)
+	}
+
+	cols = JSONColumns{
+		SplitComments: cols.SplitComments || had.SplitComments,
+		Functions:     cols.Functions || had.Functions,
+	}
+	report := NewJSONReport(combined, TotalStats(combined), cols)
+	return writeOutputFile(path, func(w io.Writer) error {
+		PrintJSONReport(w, report)
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunAccumulateInto(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(first, "main.go"), []byte("package main\n\n// main runs\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(second, "util.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(second, "run.py"), []byte("x = 1\ny = 2\n"), 0644)
+
+	report := filepath.Join(t.TempDir(), "tally.json")
+	if err := os.WriteFile(report, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, dir := range []string{first, second} {
+		config := &Config{Path: dir, OutputFormat: "compact", Quiet: true, AccumulateInto: report}
+		captureStdout(func() {
+			if err := Run(config); err != nil {
+				t.Fatalf("Run(%s) error = %v", dir, err)
+			}
+		})
+	}
+
+	langStats, _, err := LoadJSONReport(report)
+	if err != nil {
+		t.Fatalf("LoadJSONReport() error = %v", err)
+	}
+	goStats, pyStats := langStats["Go"], langStats["Python"]
+	if goStats == nil || goStats.FileCount != 2 || goStats.BlankLines != 1 || goStats.CommentLines != 1 || goStats.CodeLines != 3 || goStats.TotalLines != 5 {
+		t.Errorf("Accumulated Go = %+v, want 2 files, 1 blank, 1 comment, 3 code, 5 total", goStats)
+	}
+	if pyStats == nil || pyStats.FileCount != 1 || pyStats.CodeLines != 2 {
+		t.Errorf("Accumulated Python = %+v, want 1 file with 2 code lines", pyStats)
+	}
+	if total := TotalStats(langStats); total.FileCount != 3 || total.TotalLines != 7 {
+		t.Errorf("Accumulated total = %+v, want 3 files and 7 lines", total)
+	}
+}
+
+func TestLoadJSONReportMissing(t *testing.T) {
+	langStats, _, err := LoadJSONReport(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(langStats) != 0 {
+		t.Errorf("LoadJSONReport(missing) = %v, %v; want an empty tally", langStats, err)
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.json")
+	os.WriteFile(bad, []byte("not json"), 0644)
+	if _, _, err := LoadJSONReport(bad); err == nil {
+		t.Error("LoadJSONReport should fail on a file that is not a JSON report")
+	}
+}
+
+func TestMergeJSONReport(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\n// main runs\nfunc main() {}\n"), 0644)
+
+	result, err := Scan(&Config{Quiet: true}, dir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	// Rust is listed as by --detailed
+	piped := `{"languages": {
+		"Go": {"files": 2, "blank": 1, "comment": 0, "code": 9, "total": 10},
+		"Rust": {"files": {"count": 1, "list": [{"path": "lib.rs", "language": "Rust", "blank": 0, "comment": 2, "code": 5, "total": 7}]}, "blank": 0, "comment": 2, "code": 5, "total": 7}
+	}, "total": {"files": 3, "blank": 1, "comment": 2, "code": 14, "total": 17}}`
+	if err := MergeJSONReport(result.LangStats, strings.NewReader(piped)); err != nil {
+		t.Fatalf("MergeJSONReport() error = %v", err)
+	}
+
+	goStats, rustStats := result.LangStats["Go"], result.LangStats["Rust"]
+	if goStats == nil || goStats.FileCount != 3 || goStats.BlankLines != 2 || goStats.CommentLines != 1 || goStats.CodeLines != 11 || goStats.TotalLines != 14 {
+		t.Errorf("Merged Go = %+v, want 3 files, 2 blank, 1 comment, 11 code, 14 total", goStats)
+	}
+	if rustStats == nil || rustStats.FileCount != 1 || rustStats.CodeLines != 5 {
+		t.Errorf("Merged Rust = %+v, want 1 file with 5 code lines", rustStats)
+	}
+	if total := TotalStats(result.LangStats); total.FileCount != 4 || total.TotalLines != 21 {
+		t.Errorf("Merged total = %+v, want 4 files and 21 lines", total)
+	}
+
+	if err := MergeJSONReport(result.LangStats, strings.NewReader("")); err != nil {
+		t.Errorf("MergeJSONReport(empty) error = %v, want nothing added", err)
+	}
+	if err := MergeJSONReport(result.LangStats, strings.NewReader("not json")); err == nil {
+		t.Error("MergeJSONReport should fail on input that is not a JSON report")
+	}
+}
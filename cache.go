@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CacheFileName is the name of the cache file written inside --cache-dir
+const CacheFileName = "locc-cache.json"
+
+// cacheVersion is bumped whenever the meaning of cached counts changes
+const cacheVersion = 2
+
+// racyWindow is how recently a file may have been modified and still be
+// cached. A file written within this window of being counted could change
+// again without its modification time or size changing.
+const racyWindow = 2 * time.Second
+
+// cacheEntry holds the counts of a file along with the metadata they were
+// computed from
+type cacheEntry struct {
+	ModTime int64      `json:"mtime"` // nanoseconds since the Unix epoch
+	Size    int64      `json:"size"`
+	Rules   string     `json:"rules"` // name of the language the file was counted with
+	Stats   *FileStats `json:"stats"`
+}
+
+// cacheDocument is the on-disk format of the cache
+type cacheDocument struct {
+	Version int                   `json:"version"`
+	Options string                `json:"options"`
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+// FileCache stores per-file counts keyed by path, modification time and size
+// so unchanged files are not read again. It is safe for concurrent use.
+type FileCache struct {
+	mu      sync.Mutex
+	path    string
+	options string
+	entries map[string]cacheEntry
+	hits    int
+}
+
+// LoadFileCache opens the cache in dir for counts made with opts. A missing,
+// unreadable or outdated cache file starts an empty cache.
+func LoadFileCache(dir string, opts CountOptions) (*FileCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &FileCache{
+		path:    filepath.Join(dir, CacheFileName),
+		options: fmt.Sprintf("%+v", opts),
+		entries: make(map[string]cacheEntry),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc cacheDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		LogWarn("Ignoring unreadable cache %s: %v", c.path, err)
+		return c, nil
+	}
+	if doc.Version != cacheVersion || doc.Options != c.options {
+		LogDebug("Discarding cache %s built with different settings", c.path)
+		return c, nil
+	}
+	if doc.Entries != nil {
+		c.entries = doc.Entries
+	}
+	return c, nil
+}
+
+// cacheKey returns the key a file is stored under
+func cacheKey(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Get returns a copy of the cached counts of path, if they were computed
+// from a file with the same modification time and size, with the same rules
+func (c *FileCache) Get(path string, info os.FileInfo, lang *Language) (*FileStats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[cacheKey(path)]
+	if !ok || entry.Stats == nil || entry.ModTime != info.ModTime().UnixNano() || entry.Size != info.Size() || entry.Rules != lang.Name {
+		return nil, false
+	}
+
+	c.hits++
+	stats := *entry.Stats
+	stats.FilePath = path
+	return &stats, true
+}
+
+// Put stores the counts of path. Files modified within racyWindow are not
+// stored since they may still be changing.
+func (c *FileCache) Put(path string, info os.FileInfo, lang *Language, stats *FileStats) {
+	if time.Since(info.ModTime()) < racyWindow {
+		return
+	}
+
+	stored := *stats
+	stored.FilePath = ""
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(path)] = cacheEntry{
+		ModTime: info.ModTime().UnixNano(),
+		Size:    info.Size(),
+		Rules:   lang.Name,
+		Stats:   &stored,
+	}
+}
+
+// Hits returns the number of files whose counts were served from the cache
+func (c *FileCache) Hits() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits
+}
+
+// Save writes the cache back to disk, replacing the previous file atomically
+func (c *FileCache) Save() error {
+	c.mu.Lock()
+	data, err := json.Marshal(cacheDocument{
+		Version: cacheVersion,
+		Options: c.options,
+		Entries: c.entries,
+	})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), CacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestScanUsesCache(t *testing.T) {
+	srcDir := t.TempDir()
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+
+	old := time.Now().Add(-time.Hour)
+	files := map[string]string{
+		"main.go":   "package main\n\n// comment\nfunc main() {}\n",
+		"script.py": "# comment\nx = 1\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(srcDir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatalf("Failed to set mtime: %v", err)
+		}
+	}
+
+	config := &Config{CacheDir: cacheDir}
+	first, err := Scan(config, srcDir)
+	if err != nil {
+		t.Fatalf("First scan failed: %v", err)
+	}
+	if first.CachedFiles != 0 {
+		t.Errorf("First scan CachedFiles = %d, want 0", first.CachedFiles)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, CacheFileName)); err != nil {
+		t.Fatalf("Cache file not written: %v", err)
+	}
+
+	second, err := Scan(config, srcDir)
+	if err != nil {
+		t.Fatalf("Second scan failed: %v", err)
+	}
+	if second.CachedFiles != len(files) {
+		t.Errorf("Second scan CachedFiles = %d, want %d", second.CachedFiles, len(files))
+	}
+	if *TotalStats(first.LangStats) != *TotalStats(second.LangStats) {
+		t.Errorf("Totals differ: first %+v, second %+v", TotalStats(first.LangStats), TotalStats(second.LangStats))
+	}
+
+	// Changing the size of a file invalidates its entry
+	changed := filepath.Join(srcDir, "script.py")
+	os.WriteFile(changed, []byte("# comment\nx = 1\ny = 2\n"), 0644)
+	os.Chtimes(changed, old, old)
+
+	third, err := Scan(config, srcDir)
+	if err != nil {
+		t.Fatalf("Third scan failed: %v", err)
+	}
+	if third.CachedFiles != 1 {
+		t.Errorf("Third scan CachedFiles = %d, want 1", third.CachedFiles)
+	}
+	if py := third.LangStats["Python"]; py == nil || py.CodeLines != 2 {
+		t.Errorf("Changed file should be recounted, got %+v", py)
+	}
+
+	// Different counting options discard the cache
+	codeOnly, err := Scan(&Config{CacheDir: cacheDir, CodeOnly: true}, srcDir)
+	if err != nil {
+		t.Fatalf("Code-only scan failed: %v", err)
+	}
+	if codeOnly.CachedFiles != 0 {
+		t.Errorf("Code-only scan CachedFiles = %d, want 0", codeOnly.CachedFiles)
+	}
+}
+
+func TestFileCacheSkipsRecentFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "new.go")
+	os.WriteFile(path, []byte("package main\n"), 0644)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+
+	cache, err := LoadFileCache(filepath.Join(dir, "cache"), CountOptions{})
+	if err != nil {
+		t.Fatalf("LoadFileCache failed: %v", err)
+	}
+	cache.Put(path, info, Languages[".go"], &FileStats{FilePath: path, Language: "Go", CodeLines: 1, TotalLines: 1})
+	if _, ok := cache.Get(path, info, Languages[".go"]); ok {
+		t.Error("A file modified just now should not be cached")
+	}
+}
+
+func TestLoadFileCacheIgnoresCorruptFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, CacheFileName), []byte("{not json"), 0644)
+
+	cache, err := LoadFileCache(dir, CountOptions{})
+	if err != nil {
+		t.Fatalf("LoadFileCache failed: %v", err)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected an empty cache, got %d entries", len(cache.entries))
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LineKind is the category a line is counted under
+type LineKind int
+
+const (
+	// LineBlank is a line containing only whitespace
+	LineBlank LineKind = iota
+	// LineComment is a line containing only comments
+	LineComment
+	// LineCode is a line containing any code
+	LineCode
+)
+
+// LineInfo describes a classified line
+type LineInfo struct {
+	Kind LineKind
+
+	// Block is set on a LineComment line that is part of a block comment,
+	// as opposed to holding only single-line comments
+	Block bool
+
+	// Embedded is the tagged language of the string block the line is part
+	// of, if DetectEmbedded is set and the line has content in the block
+	Embedded string
+}
+
+// DefaultTabWidth is the number of columns a tab advances to, for rules that
+// depend on columns, when no other width is set
+const DefaultTabWidth = 8
+
+// fixedFormColumns is the last column of a fixed-form statement; later
+// columns held sequence numbers and are ignored
+const fixedFormColumns = 72
+
+// LineClassifier classifies lines one at a time using the comment and string
+// rules of a language, carrying multi-line comment and string state from one
+// line to the next
+type LineClassifier struct {
+	lang         *Language
+	lineComments []string
+
+	// DetectEmbedded enables tracking of string blocks tagged with a
+	// "language=<name>" line comment
+	DetectEmbedded bool
+
+	// TabWidth is the number of columns a tab advances to the next multiple
+	// of, for languages with FixedForm columns. 0 means DefaultTabWidth.
+	TabWidth int
+
+	inMultiLine    bool
+	multiLineLevel int
+	inString       bool
+	stringEnd      string
+
+	// Embedded language detection state
+	pendingHint  string
+	embeddedLang string
+}
+
+// NewLineClassifier creates a LineClassifier for the given language rules
+func NewLineClassifier(lang *Language) *LineClassifier {
+	return &LineClassifier{
+		lang:         lang,
+		lineComments: lang.LineComments(),
+	}
+}
+
+// Classify classifies the next line
+func (c *LineClassifier) Classify(line string) LineInfo {
+	return c.ClassifyBytes([]byte(line))
+}
+
+// ClassifyBytes classifies the next line like Classify, without converting
+// it to a string. line is not retained, so it may be a buffer that is
+// reused, such as the result of bufio.Scanner.Bytes.
+func (c *LineClassifier) ClassifyBytes(line []byte) LineInfo {
+	if c.lang.FixedForm {
+		if len(line) > 0 && bytes.IndexByte([]byte("Cc*!"), line[0]) >= 0 {
+			return LineInfo{Kind: LineComment}
+		}
+		line = expandTabs(line, c.TabWidth, fixedFormColumns)
+	}
+
+	// Any whitespace-only line is blank, whichever whitespace it uses
+	if isBlankBytes(line) {
+		return LineInfo{Kind: LineBlank}
+	}
+
+	lang := c.lang
+	lineHasCode := false
+	lineHasComment := false
+	lineInBlock := c.inMultiLine
+	lineEmbeddedLang := c.embeddedLang
+	lineHasEmbedded := false
+	hintOnLine := false
+
+	for i := 0; i < len(line); {
+		if c.inString {
+			lineHasCode = true
+			if hasPrefix(line[i:], c.stringEnd) && !isEscaped(line, i) {
+				c.inString = false
+				c.embeddedLang = ""
+				i += len(c.stringEnd)
+			} else {
+				if lineEmbeddedLang != "" && !isWhitespace(line[i]) {
+					lineHasEmbedded = true
+				}
+				i++
+			}
+			continue
+		}
+
+		if c.inMultiLine {
+			lineHasComment = true
+
+			// Check for nested multi-line start
+			if lang.NestedComments && lang.MultiLineStart != "" && hasPrefix(line[i:], lang.MultiLineStart) {
+				c.multiLineLevel++
+				i += len(lang.MultiLineStart)
+				continue
+			}
+
+			// Check for multi-line end
+			if lang.MultiLineEnd != "" && hasPrefix(line[i:], lang.MultiLineEnd) {
+				if c.multiLineLevel > 0 {
+					c.multiLineLevel--
+				} else {
+					c.inMultiLine = false
+				}
+				i += len(lang.MultiLineEnd)
+			} else {
+				i++
+			}
+			continue
+		}
+
+		// Not in string or multi-line comment
+
+		// Check for single line comment
+		if marker := c.lineCommentAt(line[i:]); marker != "" {
+			lineHasComment = true
+			if c.DetectEmbedded {
+				if hint := parseLanguageHint(string(line[i+len(marker):])); hint != "" {
+					c.pendingHint = hint
+					hintOnLine = true
+				}
+			}
+			break // Rest of line is comment
+		}
+
+		// Check for multi-line comment start
+		if lang.MultiLineStart != "" && hasPrefix(line[i:], lang.MultiLineStart) {
+			c.inMultiLine = true
+			lineHasComment = true
+			lineInBlock = true
+			i += len(lang.MultiLineStart)
+			continue
+		}
+
+		// Check for string start
+		foundString := false
+		for _, delim := range lang.StringDelimiters {
+			if hasPrefix(line[i:], delim) {
+				c.inString = true
+				c.stringEnd = delim
+				lineHasCode = true
+				i += len(delim)
+				foundString = true
+				if c.pendingHint != "" {
+					c.embeddedLang = c.pendingHint
+					c.pendingHint = ""
+				}
+				break
+			}
+		}
+		if foundString {
+			continue
+		}
+
+		// Check for code
+		if line[i] < utf8.RuneSelf {
+			if !isWhitespace(line[i]) {
+				lineHasCode = true
+			}
+			i++
+		} else {
+			r, size := utf8.DecodeRune(line[i:])
+			if !isBlankRune(r) {
+				lineHasCode = true
+			}
+			i += size
+		}
+	}
+
+	// A hint only applies to the first code line after it
+	if lineHasCode && !hintOnLine {
+		c.pendingHint = ""
+	}
+
+	info := LineInfo{Kind: LineBlank}
+	if lineHasCode {
+		info.Kind = LineCode
+	} else if lineHasComment {
+		info.Kind = LineComment
+		info.Block = lineInBlock
+	}
+	if lineHasEmbedded {
+		info.Embedded = lineEmbeddedLang
+	}
+	return info
+}
+
+// InBlockComment reports whether the last line classified ended inside a
+// block comment, which continues on the next line
+func (c *LineClassifier) InBlockComment() bool {
+	return c.inMultiLine
+}
+
+// lineCommentAt returns the single-line comment marker s starts with, or ""
+// if it has none or starts with code that looks like one
+func (c *LineClassifier) lineCommentAt(s []byte) string {
+	for _, prefix := range c.lang.NotLineComments {
+		if hasPrefix(s, prefix) {
+			return ""
+		}
+	}
+	for _, marker := range c.lineComments {
+		if hasPrefix(s, marker) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// ClassifyLines classifies every line read from r using the comment and
+// string rules of lang, without any of the optional analyses. It counts the
+// lines as CountReader does for a file.
+func ClassifyLines(r io.Reader, rules *Language) (blank, comment, code, total int, err error) {
+	stats, err := CountReader(r, "", rules, CountOptions{})
+	if err != nil {
+		return 0, 0, 0, 0, err
+	}
+	return stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines, nil
+}
+
+// newLineScanner returns a line scanner accepting lines of up to 1 MiB
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+	return scanner
+}
+
+// hasPrefix reports whether b begins with prefix. The comparison does not
+// allocate.
+func hasPrefix(b []byte, prefix string) bool {
+	return len(b) >= len(prefix) && string(b[:len(prefix)]) == prefix
+}
+
+// isEscaped reports whether the character at line[i] is preceded by an odd
+// number of backslashes
+func isEscaped(line []byte, i int) bool {
+	bsCount := 0
+	for j := i - 1; j >= 0 && line[j] == '\\'; j-- {
+		bsCount++
+	}
+	return bsCount%2 == 1
+}
+
+func isWhitespace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+// isBlankRune reports whether r is Unicode whitespace, such as a
+// non-breaking space, or an invisible zero-width character
+func isBlankRune(r rune) bool {
+	switch r {
+	case '\u200B', '\u200C', '\u200D', '\u2060', '\uFEFF': // zero-width spaces, joiners and BOM
+		return true
+	}
+	return unicode.IsSpace(r)
+}
+
+// isBlankLine reports whether line contains nothing but blank runes
+func isBlankLine(line string) bool {
+	for _, r := range line {
+		if !isBlankRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// expandTabs returns the first limit columns of line, with tabs expanded to
+// spaces up to the next multiple of tabWidth, or of DefaultTabWidth if it is
+// not positive. line itself is returned if it has no tab and fits.
+func expandTabs(line []byte, tabWidth, limit int) []byte {
+	if tabWidth <= 0 {
+		tabWidth = DefaultTabWidth
+	}
+	if bytes.IndexByte(line, '\t') < 0 && utf8.RuneCount(line) <= limit {
+		return line
+	}
+
+	expanded := make([]byte, 0, limit)
+	column := 0
+	for i := 0; i < len(line) && column < limit; {
+		if line[i] == '\t' {
+			next := min((column/tabWidth+1)*tabWidth, limit)
+			expanded = append(expanded, bytes.Repeat([]byte{' '}, next-column)...)
+			column = next
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRune(line[i:])
+		expanded = append(expanded, line[i:i+size]...)
+		column++
+		i += size
+	}
+	return expanded
+}
+
+// indentColumns returns the width in columns of the leading spaces and tabs
+// of line, with tabs advancing to the next multiple of tabWidth
+func indentColumns(line []byte, tabWidth int) int {
+	if tabWidth <= 0 {
+		tabWidth = DefaultTabWidth
+	}
+	column := 0
+	for _, b := range line {
+		switch b {
+		case ' ':
+			column++
+		case '\t':
+			column = (column/tabWidth + 1) * tabWidth
+		default:
+			return column
+		}
+	}
+	return column
+}
+
+// isBlankBytes is isBlankLine for a line held in a byte slice
+func isBlankBytes(line []byte) bool {
+	for i := 0; i < len(line); {
+		if c := line[i]; c < utf8.RuneSelf {
+			if !isWhitespace(c) {
+				return false
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(line[i:])
+		if !isBlankRune(r) {
+			return false
+		}
+		i += size
+	}
+	return true
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"encoding/binary"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestClassifyLines(t *testing.T) {
+	cStyle := &Language{
+		Name:              "C-like",
+		SingleLineComment: "//",
+		MultiLineStart:    "/*",
+		MultiLineEnd:      "*/",
+		StringDelimiters:  []string{"\""},
+	}
+	hashStyle := &Language{
+		Name:              "Hash",
+		SingleLineComment: "#",
+		StringDelimiters:  []string{"\"", "'"},
+	}
+	nested := &Language{
+		Name:              "Nested",
+		SingleLineComment: "//",
+		MultiLineStart:    "/*",
+		MultiLineEnd:      "*/",
+		NestedComments:    true,
+	}
+	htmlStyle := &Language{
+		Name:           "Markup",
+		MultiLineStart: "<!--",
+		MultiLineEnd:   "-->",
+	}
+	noComments := &Language{Name: "Plain"}
+
+	tests := []struct {
+		name        string
+		rules       *Language
+		input       string
+		wantBlank   int
+		wantComment int
+		wantCode    int
+		wantTotal   int
+	}{
+		{
+			name:        "C-style line and block comments",
+			rules:       cStyle,
+			input:       "// comment\nint x;\n/* block\n   still block */\nint y; // trailing\n\n",
+			wantBlank:   1,
+			wantComment: 3,
+			wantCode:    2,
+			wantTotal:   6,
+		},
+		{
+			name:      "C-style comment marker inside string",
+			rules:     cStyle,
+			input:     "s = \"// not a comment\";\ns = \"/* nor this */\";\n",
+			wantCode:  2,
+			wantTotal: 2,
+		},
+		{
+			name:        "C-style escaped quote",
+			rules:       cStyle,
+			input:       "s = \"a \\\" // still string\";\n// comment\n",
+			wantComment: 1,
+			wantCode:    1,
+			wantTotal:   2,
+		},
+		{
+			name:        "Hash comments",
+			rules:       hashStyle,
+			input:       "# comment\nx = '#not'\n\n  # indented\n",
+			wantBlank:   1,
+			wantComment: 2,
+			wantCode:    1,
+			wantTotal:   4,
+		},
+		{
+			name:        "PHP slash and hash comments",
+			rules:       Languages[".php"],
+			input:       "<?php\n// slash comment\n# hash comment\n$x = 1; # trailing\n$s = '# not a comment';\n",
+			wantComment: 2,
+			wantCode:    3,
+			wantTotal:   5,
+		},
+		{
+			name:        "PHP attributes are not hash comments",
+			rules:       Languages[".php"],
+			input:       "<?php\n#[Route('/home')]\n  #[Deprecated] # trailing\n# plain comment\n#comment without space\n",
+			wantComment: 2,
+			wantCode:    3,
+			wantTotal:   5,
+		},
+		{
+			name:        "Python hash comments",
+			rules:       Languages[".py"],
+			input:       "#!/usr/bin/env python3\n# -*- coding: utf-8 -*-\n#comment\nx = 1#trailing\ns = \"#not a comment\"\nt = '# nor this'\nu = \"a\" # c \"b\"\n",
+			wantComment: 3,
+			wantCode:    4,
+			wantTotal:   7,
+		},
+		{
+			name:        "Ruby hash comments and interpolation",
+			rules:       Languages[".rb"],
+			input:       "# frozen_string_literal: true\nputs \"#{name}\"\n  #{not in a string} is a comment\nx = 1 # trailing\n=begin\n# inside block\n=end\n",
+			wantComment: 5,
+			wantCode:    2,
+			wantTotal:   7,
+		},
+		{
+			name:        "Shell hash comments",
+			rules:       Languages[".sh"],
+			input:       "#!/bin/sh\n  # indented\n\t#tab indented\necho $# ${#args}\necho foo#bar\nurl=http://host/#anchor\n",
+			wantComment: 3,
+			wantCode:    3,
+			wantTotal:   6,
+		},
+		{
+			name:        "YAML comments and document markers",
+			rules:       Languages[".yaml"],
+			input:       "# config\n---\nname: app\n  # indented comment\nlist:\n  - a # trailing\n\ntitle: don't # apostrophe\nnext: 1\n...\n--- # second document\n",
+			wantBlank:   1,
+			wantComment: 2,
+			wantCode:    8,
+			wantTotal:   11,
+		},
+		{
+			name:        "Free-form Fortran comments",
+			rules:       Languages[".f90"],
+			input:       "! comment\nprogram p\n  print *, 'a ! b' ! c\nC = 1\nend program\n",
+			wantComment: 1,
+			wantCode:    4,
+			wantTotal:   5,
+		},
+		{
+			name:        "Python indented comment",
+			rules:       Languages[".py"],
+			input:       "def f():\n    # explain\n    return 1  # trailing\n\t# tab indented\n",
+			wantComment: 2,
+			wantCode:    2,
+			wantTotal:   4,
+		},
+		{
+			name:        "Nested block comments",
+			rules:       nested,
+			input:       "/* outer\n/* inner */\nstill outer */\ncode();\n",
+			wantComment: 3,
+			wantCode:    1,
+			wantTotal:   4,
+		},
+		{
+			name:        "Nested comment on one line with trailing code",
+			rules:       Languages[".rs"],
+			input:       "/* a /* b */ c */ let x = 1;\n/* a /* b */ c */\n",
+			wantComment: 1,
+			wantCode:    1,
+			wantTotal:   2,
+		},
+		{
+			name:        "Nested comment ends at the outer delimiter",
+			rules:       Languages[".swift"],
+			input:       "/* outer\n  /* inner */ still comment\n  /* deeper /* deepest */ */\n*/ let y = 2\nlet z = 3\n",
+			wantComment: 3,
+			wantCode:    2,
+			wantTotal:   5,
+		},
+		{
+			name:      "Non-nesting comment ends at the first delimiter",
+			rules:     Languages[".d"],
+			input:     "/* a /* b */ int c; /* d */\nint e;\n",
+			wantCode:  2,
+			wantTotal: 2,
+		},
+		{
+			name:        "Markup comments",
+			rules:       htmlStyle,
+			input:       "<!-- c -->\n<p>text</p>\n<!--\nmulti\n-->\n",
+			wantComment: 4,
+			wantCode:    1,
+			wantTotal:   5,
+		},
+		{
+			name:      "No comment rules",
+			rules:     noComments,
+			input:     "// looks like a comment\n\n# so does this\n",
+			wantBlank: 1,
+			wantCode:  2,
+			wantTotal: 3,
+		},
+		{
+			name:        "Unicode whitespace",
+			rules:       cStyle,
+			input:       "\u00a0\u00a0\n\u200b\n \u200b\t\u2060\n\ufeff// comment after BOM\n\u00a0// comment after NBSP\nint x;\u00a0\n\u00a0x\n",
+			wantBlank:   3,
+			wantComment: 2,
+			wantCode:    2,
+			wantTotal:   7,
+		},
+		{
+			name:      "No trailing newline",
+			rules:     cStyle,
+			input:     "int x;",
+			wantCode:  1,
+			wantTotal: 1,
+		},
+		{
+			name:  "Empty input",
+			rules: cStyle,
+			input: "",
+		},
+		{
+			name:        "UTF-16 with a byte order mark",
+			rules:       cStyle,
+			input:       string(encodeUTF16("// comment\nint x;\n\n", binary.LittleEndian)),
+			wantBlank:   1,
+			wantComment: 1,
+			wantCode:    1,
+			wantTotal:   3,
+		},
+		{
+			name:      "Ignored lines are counted in the total only",
+			rules:     &Language{Name: "Guarded", SingleLineComment: "//", IgnoreLines: []*regexp.Regexp{regexp.MustCompile(`^#pragma once`)}},
+			input:     "#pragma once\nint x;\n",
+			wantCode:  1,
+			wantTotal: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blank, comment, code, total, err := ClassifyLines(strings.NewReader(tt.input), tt.rules)
+			if err != nil {
+				t.Fatalf("ClassifyLines failed: %v", err)
+			}
+			if blank != tt.wantBlank || comment != tt.wantComment || code != tt.wantCode || total != tt.wantTotal {
+				t.Errorf("ClassifyLines() = blank %d, comment %d, code %d, total %d; want %d, %d, %d, %d",
+					blank, comment, code, total, tt.wantBlank, tt.wantComment, tt.wantCode, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestLineClassifierCarriesState(t *testing.T) {
+	classifier := NewLineClassifier(Languages[".go"])
+
+	lines := []struct {
+		line string
+		want LineKind
+	}{
+		{"/*", LineComment},
+		{"inside", LineComment},
+		{"*/ x := 1", LineCode},
+		{"s := `", LineCode},
+		{"// raw string, not a comment", LineCode},
+		{"`", LineCode},
+		{"\t", LineBlank},
+	}
+	for _, l := range lines {
+		if got := classifier.Classify(l.line).Kind; got != l.want {
+			t.Errorf("Classify(%q) = %v, want %v", l.line, got, l.want)
+		}
+	}
+}
+
+func TestLineClassifierBlockComments(t *testing.T) {
+	classifier := NewLineClassifier(Languages[".c"])
+
+	lines := []struct {
+		line      string
+		wantBlock bool
+	}{
+		{"// line", false},
+		{"/* opens", true},
+		{"inside", true},
+		{"closes */ // and line", true},
+		{"  // indented line", false},
+		{"/* whole */", true},
+	}
+	for _, l := range lines {
+		info := classifier.Classify(l.line)
+		if info.Kind != LineComment || info.Block != l.wantBlock {
+			t.Errorf("Classify(%q) = kind %v, block %t; want comment, block %t", l.line, info.Kind, info.Block, l.wantBlock)
+		}
+	}
+	if info := classifier.Classify("int x; /* trailing */"); info.Block {
+		t.Error("Code lines should not be marked as block comments")
+	}
+}
+
+// benchmarkSource returns a Go-like source of about n lines mixing code,
+// comments, strings and blank lines
+func benchmarkSource(n int) string {
+	var b strings.Builder
+	for b.Len() == 0 || strings.Count(b.String(), "\n") < n {
+		b.WriteString("// Package bench is generated for benchmarks\n" +
+			"package bench\n" +
+			"\n" +
+			"/* A block comment\n" +
+			"   spanning lines */\n" +
+			"func f(x int) string {\n" +
+			"\ts := \"a string with // no comment\"\n" +
+			"\treturn s + `raw` // trailing comment\n" +
+			"}\n" +
+			"\n")
+	}
+	return b.String()
+}
+
+// BenchmarkClassifyLines classifies 10,000 lines. Converting every line to
+// a string cost 7002 allocs/op (299 KB/op); classifying the scanner's bytes
+// directly brought it down to 2 allocs/op (67 KB/op, the scanner buffer).
+func BenchmarkClassifyLines(b *testing.B) {
+	src := benchmarkSource(10000)
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, err := ClassifyLines(strings.NewReader(src), Languages[".go"]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
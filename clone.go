@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// CloneRepository shallow-clones the git repository at url into a new
+// temporary directory. The returned cleanup function removes the directory
+// and must be called even if the clone fails.
+func CloneRepository(url string) (dir string, cleanup func(), err error) {
+	dir, err = os.MkdirTemp("", "locc-clone-")
+	if err != nil {
+		return "", func() {}, err
+	}
+	cleanup = func() {
+		if err := os.RemoveAll(dir); err != nil {
+			LogWarn("Failed to remove clone directory %s: %v", dir, err)
+		}
+	}
+
+	LogDebug("Cloning %s into %s", url, dir)
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "clone", "--depth", "1", "--quiet", "--", url, dir)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return dir, cleanup, fmt.Errorf("git clone %s: %w", url, err)
+	}
+	return dir, cleanup, nil
+}
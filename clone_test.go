@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// createBareRepo creates a bare git repository holding a single commit with
+// the given files and returns its file:// URL
+func createBareRepo(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	work := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(work, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	bare := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, work, "init", "--quiet")
+	runGit(t, work, "add", ".")
+	runGit(t, work, "commit", "--quiet", "-m", "initial")
+	runGit(t, work, "clone", "--quiet", "--bare", work, bare)
+
+	return "file://" + bare
+}
+
+// runGit runs a git command in dir with a fixed identity, failing the test
+// if it does not succeed
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, out)
+	}
+}
+
+func TestCloneRepository(t *testing.T) {
+	url := createBareRepo(t, map[string]string{"main.go": "package main\n"})
+
+	dir, cleanup, err := CloneRepository(url)
+	if err != nil {
+		cleanup()
+		t.Fatalf("CloneRepository failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); err != nil {
+		t.Errorf("Cloned file missing: %v", err)
+	}
+
+	cleanup()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Clone directory %s not removed", dir)
+	}
+}
+
+func TestRunClone(t *testing.T) {
+	url := createBareRepo(t, map[string]string{
+		"main.go":   "package main\n\nfunc main() {}\n",
+		"script.py": "# comment\nx = 1\n",
+	})
+
+	config := &Config{
+		Clone:        url,
+		OutputFormat: "default",
+		Quiet:        true,
+		ByFile:       true,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	if !containsRow(output, "main.go", "Go", "1", "0", "2", "3") {
+		t.Errorf("Expected main.go row relative to the clone:\n%s", output)
+	}
+	if _, err := os.Stat(config.Path); !os.IsNotExist(err) {
+		t.Errorf("Clone directory %s not removed", config.Path)
+	}
+
+	err := Run(&Config{Clone: "file:///nonexistent/repo.git", Quiet: true})
+	if err == nil {
+		t.Error("Expected an error for a repository that cannot be cloned")
+	}
+}
@@ -1,11 +1,25 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
+// StdinPath is the file path reported for content read from stdin
+const StdinPath = "<stdin>"
+
 // FileStats holds the line count statistics for a single file
 type FileStats struct {
 	FilePath     string
@@ -15,6 +29,44 @@ type FileStats struct {
 	CommentLines int
 	CodeLines    int
 	TotalLines   int
+	Bytes        int64
+	Embedded     map[string]int // embedded language -> lines, with CountOptions.DetectEmbedded
+
+	// Comment lines holding only single-line comments, and those that are
+	// part of a block comment
+	LineCommentLines  int
+	BlockCommentLines int
+
+	// Leading indentation of code lines, with CountOptions.ReportIndent
+	TabIndented   int
+	SpaceIndented int
+	MixedIndented int
+
+	// Width in columns of the indentation of indented code lines, with tabs
+	// expanded to CountOptions.TabWidth
+	IndentColumns int
+
+	// Region marker lines, with CountOptions.Regions. They are also
+	// counted as code or comment lines.
+	RegionLines int
+
+	// Function definitions found in code lines, with CountOptions.Functions
+	Functions int
+
+	// Comment lines that read like code, with CountOptions.CommentedCode.
+	// They are also counted as comment lines.
+	CommentedCodeLines int
+
+	// Doc comment lines, with CountOptions.DocComments. They are also
+	// counted as comment lines.
+	DocCommentLines int
+
+	// Logical lines of code, with CountOptions.LogicalLines: code lines
+	// continued on the next one are joined with it, see Continuations
+	LogicalLines int
+
+	// Code lines longer than CountOptions.MaxLineLength runes
+	LongLines int
 }
 
 // LanguageStats holds aggregated statistics for a language
@@ -25,154 +77,379 @@ type LanguageStats struct {
 	CommentLines int
 	CodeLines    int
 	TotalLines   int
+	Bytes        int64
+
+	LineCommentLines  int
+	BlockCommentLines int
+
+	TabIndented   int
+	SpaceIndented int
+	MixedIndented int
+	IndentColumns int
+
+	RegionLines        int
+	Functions          int
+	CommentedCodeLines int
+	DocCommentLines    int
+	LogicalLines       int
+	LongLines          int
+
+	// Code lines times the language's --weights weight, see ApplyWeights
+	Weighted float64
+}
+
+// ExtensionStats holds aggregated statistics for the files of one language
+// sharing an extension
+type ExtensionStats struct {
+	Extension string
+	LanguageStats
 }
 
 // CountResult represents the result of counting a file
 type CountResult struct {
-	Stats *FileStats
-	Error error
+	Stats      *FileStats
+	Error      error
+	Skipped    bool
+	SkipReason SkipReason // why the file was skipped, if Skipped
+	Path       string     // path of the file counted or skipped
+}
+
+// CountOptions enables optional analyses performed while counting lines
+type CountOptions struct {
+	// DetectEmbedded reports lines of string literals tagged with a
+	// "language=<name>" line comment as embedded code of that language
+	DetectEmbedded bool
+
+	// ReportIndent classifies the leading indentation of code lines as
+	// tabs, spaces or a mix of both
+	ReportIndent bool
+
+	// TabWidth is the number of columns a tab advances to the next multiple
+	// of, for the indentation width and column-sensitive languages such as
+	// fixed-form Fortran. 0 means DefaultTabWidth.
+	TabWidth int
+
+	// CodeOnly skips comment and string detection: every non-blank line is
+	// counted as code
+	CodeOnly bool
+
+	// Regions tallies lines starting with one of the region markers of the
+	// language, such as "#region" in C# or "// MARK:" in Swift
+	Regions bool
+
+	// Functions counts the matches of the function pattern of the
+	// language in code lines, a rough estimate of its function definitions
+	Functions bool
+
+	// CommentedCode tallies comment lines that read like commented-out
+	// code rather than prose, see isCommentedCode
+	CommentedCode bool
+
+	// DocComments tallies comment lines that are doc comments by the
+	// rules of the language in DocComments
+	DocComments bool
+
+	// LogicalLines counts the logical lines of code, joining the code lines
+	// that continue by the rules of the language in Continuations
+	LogicalLines bool
+
+	// MaxLineLength tallies the code lines longer than this many runes, if
+	// positive. Bytes are not counted, so wide characters pass as one.
+	MaxLineLength int
+
+	// IgnoreHeader skips the first lines of every file, and
+	// IgnoreHeaderUntil the lines before the first one it matches, after
+	// those. Skipped lines are not counted in any category.
+	IgnoreHeader      int
+	IgnoreHeaderUntil *regexp.Regexp
 }
 
 // CountLines counts the lines in a file and categorizes them
 func CountLines(filePath string, lang *Language) (*FileStats, error) {
+	return CountLinesWithOptions(filePath, lang, CountOptions{})
+}
+
+// CountLinesWithOptions counts the lines in a file, running the optional
+// analyses enabled in opts
+func CountLinesWithOptions(filePath string, lang *Language, opts CountOptions) (*FileStats, error) {
+	return CountLinesContext(context.Background(), filePath, lang, opts)
+}
+
+// CountLinesContext counts the lines in a file like CountLinesWithOptions,
+// giving up with the error of ctx at the next read once ctx is done
+func CountLinesContext(ctx context.Context, filePath string, lang *Language, opts CountOptions) (*FileStats, error) {
+	if lang.Notebook {
+		return CountNotebook(filePath, opts)
+	}
+
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	return CountReader(contextReader{ctx: ctx, r: file}, filePath, lang, opts)
+}
+
+// CountReader counts the lines read from r using the comment rules of lang.
+// filePath is only used to label the resulting statistics.
+func CountReader(r io.Reader, filePath string, lang *Language, opts CountOptions) (*FileStats, error) {
 	stats := &FileStats{
 		FilePath:  filePath,
 		Language:  lang.Name,
 		Extension: "",
 	}
 
-	scanner := bufio.NewScanner(file)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
-
-	inMultiLine := false
-	multiLineLevel := 0
-	inString := false
-	stringEnd := ""
+	classifier := NewLineClassifier(lang)
+	classifier.DetectEmbedded = opts.DetectEmbedded
+	classifier.TabWidth = opts.TabWidth
+	classify := classifier.ClassifyBytes
+	if opts.CodeOnly {
+		classify = classifyBlankOrCode
+	}
+	var docs *docTracker
+	if opts.DocComments && !opts.CodeOnly {
+		docs = newDocTracker(lang)
+	}
+	var logical *logicalCounter
+	if opts.LogicalLines {
+		logical = newLogicalCounter(lang)
+	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	// Lines are handled as the scanner's own bytes, not converted to
+	// strings, so counting allocates nothing per line
+	countLine := func(line []byte) {
 		stats.TotalLines++
+		line = validUTF8(line)
 
-		lineHasCode := false
-		lineHasComment := false
-
-		for i := 0; i < len(line); {
-			if inString {
-				lineHasCode = true
-				if strings.HasPrefix(line[i:], stringEnd) {
-					// Check if escaped
-					escaped := false
-					if i > 0 && line[i-1] == '\\' {
-						bsCount := 0
-						for j := i - 1; j >= 0 && line[j] == '\\'; j-- {
-							bsCount++
-						}
-						if bsCount%2 == 1 {
-							escaped = true
-						}
-					}
-					if !escaped {
-						inString = false
-						i += len(stringEnd)
-					} else {
-						i++
-					}
-				} else {
-					i++
-				}
-				continue
-			}
-
-			if inMultiLine {
-				lineHasComment = true
-
-				// Check for nested multi-line start
-				if lang.NestedComments && lang.MultiLineStart != "" && strings.HasPrefix(line[i:], lang.MultiLineStart) {
-					multiLineLevel++
-					i += len(lang.MultiLineStart)
-					continue
-				}
-
-				// Check for multi-line end
-				if lang.MultiLineEnd != "" && strings.HasPrefix(line[i:], lang.MultiLineEnd) {
-					if multiLineLevel > 0 {
-						multiLineLevel--
-						i += len(lang.MultiLineEnd)
-					} else {
-						inMultiLine = false
-						i += len(lang.MultiLineEnd)
-					}
-				} else {
-					i++
-				}
-				continue
+		info := classify(line)
+		if info.Kind != LineBlank && isIgnoredLine(line, lang) {
+			return
+		}
+		if info.Embedded != "" {
+			if stats.Embedded == nil {
+				stats.Embedded = make(map[string]int)
 			}
+			stats.Embedded[info.Embedded]++
+		}
+		if docs != nil {
+			docs.add(line, info, classifier.InBlockComment())
+		}
+		if logical != nil {
+			logical.add(line, info)
+		}
 
-			// Not in string or multi-line comment
+		if opts.Regions && info.Kind != LineBlank && isRegionMarker(line, lang) {
+			stats.RegionLines++
+		}
 
-			// Check for single line comment
-			if lang.SingleLineComment != "" && strings.HasPrefix(line[i:], lang.SingleLineComment) {
-				lineHasComment = true
-				break // Rest of line is comment
+		switch info.Kind {
+		case LineCode:
+			stats.CodeLines++
+			if opts.MaxLineLength > 0 && utf8.RuneCount(line) > opts.MaxLineLength {
+				stats.LongLines++
 			}
-
-			// Check for multi-line comment start
-			if lang.MultiLineStart != "" && strings.HasPrefix(line[i:], lang.MultiLineStart) {
-				inMultiLine = true
-				lineHasComment = true
-				i += len(lang.MultiLineStart)
-				continue
+			if opts.Functions && lang.FunctionPattern != nil {
+				stats.Functions += len(lang.FunctionPattern.FindAllIndex(line, -1))
 			}
-
-			// Check for string start
-			foundString := false
-			for _, delim := range lang.StringDelimiters {
-				if strings.HasPrefix(line[i:], delim) {
-					inString = true
-					stringEnd = delim
-					lineHasCode = true
-					i += len(delim)
-					foundString = true
-					break
+			if opts.ReportIndent {
+				switch leadingIndent(line) {
+				case indentTabs:
+					stats.TabIndented++
+				case indentSpaces:
+					stats.SpaceIndented++
+				case indentMixed:
+					stats.MixedIndented++
 				}
+				stats.IndentColumns += indentColumns(line, opts.TabWidth)
 			}
-			if foundString {
-				continue
+		case LineComment:
+			stats.CommentLines++
+			if opts.CommentedCode && isCommentedCode(line, lang) {
+				stats.CommentedCodeLines++
 			}
-
-			// Check for code
-			if !isWhitespace(line[i]) {
-				lineHasCode = true
+			if info.Block {
+				stats.BlockCommentLines++
+			} else {
+				stats.LineCommentLines++
 			}
-			i++
+		default:
+			stats.BlankLines++
 		}
+	}
 
-		if lineHasCode {
-			stats.CodeLines++
-		} else if lineHasComment {
-			stats.CommentLines++
-		} else if stats.TotalLines > 0 { // Should always be true here
-			// Check if it's truly blank or just whitespace
-			stats.BlankLines++
+	counter := &countingReader{r: r}
+	scanner := newLineScanner(decodeUTF16(counter))
+	header := newHeaderSkipper(opts)
+	for scanner.Scan() {
+		if line := scanner.Bytes(); !header.skip(line) {
+			countLine(line)
 		}
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	stats.Bytes = counter.n
+
+	// A file with no line matching IgnoreHeaderUntil has no header
+	for _, line := range header.unmatched() {
+		countLine(line)
+	}
+	if docs != nil {
+		stats.DocCommentLines = docs.lines
+	}
+	if logical != nil {
+		stats.LogicalLines = logical.lines
+	}
 
 	return stats, nil
 }
 
-func isWhitespace(c byte) bool {
-	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+// isIgnoredLine reports whether line matches one of the IgnoreLines
+// patterns of lang
+func isIgnoredLine(line []byte, lang *Language) bool {
+	for _, pattern := range lang.IgnoreLines {
+		if pattern.Match(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRegionMarker reports whether line starts with one of the region markers
+// of lang, after any leading whitespace
+func isRegionMarker(line []byte, lang *Language) bool {
+	trimmed := bytes.TrimLeftFunc(line, unicode.IsSpace)
+	for _, marker := range lang.RegionMarkers {
+		if hasPrefix(trimmed, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// codeLikeComment matches comment text that reads like code: a statement
+// ending in ";", "{" or "}", a call, an assignment or a control statement
+var codeLikeComment = regexp.MustCompile(`[;{}]$|^((go|defer|return|await)\s+)?[\w.]+\(.*\)$|^[\w.\[\]]+\s*(:=|[-+*/%|&^]?=)[^=]|^(if|for|while|switch)\s*\(`)
+
+// isCommentedCode reports whether a comment line of lang reads like
+// commented-out code once its comment markers are stripped. It is a
+// heuristic: prose ending in a brace matches, and code without any
+// statement punctuation does not.
+func isCommentedCode(line []byte, lang *Language) bool {
+	text := bytes.TrimSpace(line)
+	for _, marker := range lang.LineComments() {
+		for marker != "" && hasPrefix(text, marker) {
+			text = text[len(marker):]
+		}
+	}
+	if lang.MultiLineStart != "" {
+		text = bytes.TrimPrefix(text, []byte(lang.MultiLineStart))
+	}
+	if lang.MultiLineEnd != "" {
+		text = bytes.TrimSuffix(text, []byte(lang.MultiLineEnd))
+	}
+	text = bytes.TrimSpace(text)
+
+	// Strip the "*" continuing a C-style block comment
+	if lang.MultiLineStart == "/*" && len(text) > 0 && text[0] == '*' {
+		text = bytes.TrimSpace(text[1:])
+	}
+	return codeLikeComment.Match(text)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// contextReader reads from r until ctx is done, then fails with its error
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// classifyBlankOrCode classifies a line as blank or code without looking
+// for comments
+func classifyBlankOrCode(line []byte) LineInfo {
+	if isBlankBytes(line) {
+		return LineInfo{Kind: LineBlank}
+	}
+	return LineInfo{Kind: LineCode}
+}
+
+// indentKind describes the leading whitespace of a line
+type indentKind int
+
+const (
+	indentNone indentKind = iota
+	indentTabs
+	indentSpaces
+	indentMixed
+)
+
+// leadingIndent classifies the leading whitespace of line
+func leadingIndent(line []byte) indentKind {
+	tabs, spaces := false, false
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\t':
+			tabs = true
+		case ' ':
+			spaces = true
+		default:
+			i = len(line)
+		}
+	}
+
+	switch {
+	case tabs && spaces:
+		return indentMixed
+	case tabs:
+		return indentTabs
+	case spaces:
+		return indentSpaces
+	default:
+		return indentNone
+	}
+}
+
+// parseLanguageHint extracts the language name from a "language=<name>"
+// comment body, returning "" if the comment carries no hint. Known language
+// names are normalized to their display name.
+func parseLanguageHint(comment string) string {
+	comment = strings.TrimSpace(comment)
+	if !strings.HasPrefix(comment, "language=") {
+		return ""
+	}
+
+	hint := strings.TrimPrefix(comment, "language=")
+	if end := strings.IndexAny(hint, " \t"); end >= 0 {
+		hint = hint[:end]
+	}
+	if hint == "" {
+		return ""
+	}
+
+	if lang := GetLanguageByName(hint); lang != nil {
+		return lang.Name
+	}
+	return hint
 }
 
 // CountLinesGeneric counts lines for files without specific language support
@@ -183,21 +460,23 @@ func CountLinesGeneric(filePath string) (*FileStats, error) {
 	}
 	defer file.Close()
 
+	return CountReaderGeneric(file, filePath)
+}
+
+// CountReaderGeneric counts the lines read from r without comment detection
+func CountReaderGeneric(r io.Reader, filePath string) (*FileStats, error) {
 	stats := &FileStats{
 		FilePath: filePath,
 		Language: "Unknown",
 	}
 
-	scanner := bufio.NewScanner(file)
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
+	counter := &countingReader{r: r}
+	scanner := newLineScanner(decodeUTF16(counter))
 
 	for scanner.Scan() {
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
 		stats.TotalLines++
 
-		if trimmedLine == "" {
+		if isBlankBytes(scanner.Bytes()) {
 			stats.BlankLines++
 		} else {
 			stats.CodeLines++
@@ -207,10 +486,25 @@ func CountLinesGeneric(filePath string) (*FileStats, error) {
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
+	stats.Bytes = counter.n
 
 	return stats, nil
 }
 
+// CountStdin counts everything read from r as a single file of the named
+// language. An empty langName counts the content generically as Unknown.
+func CountStdin(r io.Reader, langName string) (*FileStats, error) {
+	if langName == "" {
+		return CountReaderGeneric(r, StdinPath)
+	}
+
+	lang := GetLanguageByName(langName)
+	if lang == nil {
+		return nil, fmt.Errorf("unknown language %q", langName)
+	}
+	return CountReader(r, StdinPath, lang, CountOptions{})
+}
+
 // AggregateStats aggregates file statistics by language
 func AggregateStats(fileStats []*FileStats) map[string]*LanguageStats {
 	langStats := make(map[string]*LanguageStats)
@@ -220,21 +514,341 @@ func AggregateStats(fileStats []*FileStats) map[string]*LanguageStats {
 			continue
 		}
 
-		lang := fs.Language
-		if _, exists := langStats[lang]; !exists {
-			langStats[lang] = &LanguageStats{
-				Language: lang,
+		addFileStats(langStats, fs)
+	}
+
+	return langStats
+}
+
+// addFileStats merges the statistics of a single file into langStats, under
+// the canonical name of its language, which fs is relabeled with
+func addFileStats(langStats map[string]*LanguageStats, fs *FileStats) {
+	fs.Language = CanonicalLanguageName(fs.Language)
+	lang := fs.Language
+	if _, exists := langStats[lang]; !exists {
+		langStats[lang] = &LanguageStats{
+			Language: lang,
+		}
+	}
+
+	langStats[lang].AddFile(fs)
+}
+
+// Add sums the counts of other into fs, such as those of the parts of a
+// file counted one by one. FilePath, Language and Extension are left
+// unchanged.
+func (fs *FileStats) Add(other *FileStats) {
+	fs.BlankLines += other.BlankLines
+	fs.CommentLines += other.CommentLines
+	fs.CodeLines += other.CodeLines
+	fs.TotalLines += other.TotalLines
+	fs.Bytes += other.Bytes
+	for lang, lines := range other.Embedded {
+		if fs.Embedded == nil {
+			fs.Embedded = make(map[string]int)
+		}
+		fs.Embedded[lang] += lines
+	}
+	fs.LineCommentLines += other.LineCommentLines
+	fs.BlockCommentLines += other.BlockCommentLines
+	fs.TabIndented += other.TabIndented
+	fs.SpaceIndented += other.SpaceIndented
+	fs.MixedIndented += other.MixedIndented
+	fs.IndentColumns += other.IndentColumns
+	fs.RegionLines += other.RegionLines
+	fs.Functions += other.Functions
+	fs.CommentedCodeLines += other.CommentedCodeLines
+	fs.DocCommentLines += other.DocCommentLines
+	fs.LogicalLines += other.LogicalLines
+	fs.LongLines += other.LongLines
+}
+
+// Add sums the counts of other into ls. Language is left unchanged.
+func (ls *LanguageStats) Add(other *LanguageStats) {
+	ls.FileCount += other.FileCount
+	ls.BlankLines += other.BlankLines
+	ls.CommentLines += other.CommentLines
+	ls.CodeLines += other.CodeLines
+	ls.TotalLines += other.TotalLines
+	ls.Bytes += other.Bytes
+	ls.LineCommentLines += other.LineCommentLines
+	ls.BlockCommentLines += other.BlockCommentLines
+	ls.TabIndented += other.TabIndented
+	ls.SpaceIndented += other.SpaceIndented
+	ls.MixedIndented += other.MixedIndented
+	ls.IndentColumns += other.IndentColumns
+	ls.RegionLines += other.RegionLines
+	ls.Functions += other.Functions
+	ls.CommentedCodeLines += other.CommentedCodeLines
+	ls.DocCommentLines += other.DocCommentLines
+	ls.LogicalLines += other.LogicalLines
+	ls.LongLines += other.LongLines
+	ls.Weighted += other.Weighted
+}
+
+// AddFile adds the counts of a single file to ls
+func (ls *LanguageStats) AddFile(fs *FileStats) {
+	ls.Add(&LanguageStats{
+		FileCount:          1,
+		BlankLines:         fs.BlankLines,
+		CommentLines:       fs.CommentLines,
+		CodeLines:          fs.CodeLines,
+		TotalLines:         fs.TotalLines,
+		Bytes:              fs.Bytes,
+		LineCommentLines:   fs.LineCommentLines,
+		BlockCommentLines:  fs.BlockCommentLines,
+		TabIndented:        fs.TabIndented,
+		SpaceIndented:      fs.SpaceIndented,
+		MixedIndented:      fs.MixedIndented,
+		IndentColumns:      fs.IndentColumns,
+		RegionLines:        fs.RegionLines,
+		Functions:          fs.Functions,
+		CommentedCodeLines: fs.CommentedCodeLines,
+		DocCommentLines:    fs.DocCommentLines,
+		LogicalLines:       fs.LogicalLines,
+		LongLines:          fs.LongLines,
+	})
+}
+
+// TopFiles returns the file with the most code lines of every language,
+// keyed by the row rowLanguage maps its language to, as returned by
+// RowLanguage. Ties go to the first path in lexical order.
+func TopFiles(fileStats []*FileStats, rowLanguage func(string) string) map[string]*FileStats {
+	top := make(map[string]*FileStats)
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+		lang := rowLanguage(fs.Language)
+		best, ok := top[lang]
+		if !ok || fs.CodeLines > best.CodeLines || (fs.CodeLines == best.CodeLines && fs.FilePath < best.FilePath) {
+			top[lang] = fs
+		}
+	}
+	return top
+}
+
+// SplitTests totals the files that are test files by the conventions of
+// their language, see Language.IsTestFile, apart from the other source files
+func SplitTests(fileStats []*FileStats) (tests, source *LanguageStats) {
+	tests = &LanguageStats{Language: "Test"}
+	source = &LanguageStats{Language: "Source"}
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+		lang := GetLanguage(fs.Extension)
+		if lang == nil || lang.Name != fs.Language {
+			lang = GetLanguageByName(fs.Language)
+		}
+		if lang != nil && lang.IsTestFile(fs.FilePath) {
+			tests.AddFile(fs)
+		} else {
+			source.AddFile(fs)
+		}
+	}
+	return tests, source
+}
+
+// AggregateByExtension aggregates file statistics by language and extension,
+// ordered by language name, then by code lines (descending)
+func AggregateByExtension(fileStats []*FileStats) []*ExtensionStats {
+	type key struct{ language, extension string }
+	byKey := make(map[key]*ExtensionStats)
+
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+
+		k := key{fs.Language, fs.Extension}
+		es, exists := byKey[k]
+		if !exists {
+			es = &ExtensionStats{Extension: fs.Extension, LanguageStats: LanguageStats{Language: fs.Language}}
+			byKey[k] = es
+		}
+		es.AddFile(fs)
+	}
+
+	rows := make([]*ExtensionStats, 0, len(byKey))
+	for _, es := range byKey {
+		rows = append(rows, es)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Language != rows[j].Language {
+			return rows[i].Language < rows[j].Language
+		}
+		if rows[i].CodeLines != rows[j].CodeLines {
+			return rows[i].CodeLines > rows[j].CodeLines
+		}
+		return rows[i].Extension < rows[j].Extension
+	})
+	return rows
+}
+
+// GroupStats merges the statistics of grouped languages into a single row per
+// group. groups maps a language name to its group name; languages without a
+// group are kept as-is.
+func GroupStats(langStats map[string]*LanguageStats, groups map[string]string) map[string]*LanguageStats {
+	grouped := make(map[string]*LanguageStats)
+
+	for lang, ls := range langStats {
+		name := lang
+		if group, ok := groups[lang]; ok {
+			name = group
+		}
+
+		if _, exists := grouped[name]; !exists {
+			grouped[name] = &LanguageStats{
+				Language: name,
 			}
 		}
 
-		langStats[lang].FileCount++
-		langStats[lang].BlankLines += fs.BlankLines
-		langStats[lang].CommentLines += fs.CommentLines
-		langStats[lang].CodeLines += fs.CodeLines
-		langStats[lang].TotalLines += fs.TotalLines
+		grouped[name].Add(ls)
 	}
 
-	return langStats
+	return grouped
+}
+
+// Ungrouped is the row of files whose path GroupByPath cannot match
+const Ungrouped = "(ungrouped)"
+
+// GroupByPath aggregates file statistics into one row per value of the first
+// capture group of re, matched against the slash-separated path of each file
+// relative to base. Files it does not match, or whose group is empty, are
+// counted under Ungrouped.
+func GroupByPath(fileStats []*FileStats, re *regexp.Regexp, base string) map[string]*LanguageStats {
+	grouped := make(map[string]*LanguageStats)
+
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+
+		name := Ungrouped
+		path := filepath.ToSlash(reportPath(fs.FilePath, base))
+		if match := re.FindStringSubmatch(path); len(match) > 1 && match[1] != "" {
+			name = match[1]
+		}
+
+		if _, exists := grouped[name]; !exists {
+			grouped[name] = &LanguageStats{
+				Language: name,
+			}
+		}
+
+		grouped[name].AddFile(fs)
+	}
+
+	return grouped
+}
+
+// MergeLanguageAliases merges rows whose language names refer to the same
+// language into one canonical row. aliases maps a lower-cased alias to its
+// canonical name; other names differing only in case are merged under the
+// built-in name, or the first variant in sort order for unknown languages.
+func MergeLanguageAliases(langStats map[string]*LanguageStats, aliases map[string]string) map[string]*LanguageStats {
+	groups := aliasGroups(langStats, aliases)
+	if len(groups) == 0 {
+		return langStats
+	}
+	return GroupStats(langStats, groups)
+}
+
+// aliasGroups returns the renames applied by MergeLanguageAliases, mapping
+// each non-canonical language name to its canonical one
+func aliasGroups(langStats map[string]*LanguageStats, aliases map[string]string) map[string]string {
+	canonical := make(map[string]string) // lower-cased name -> canonical name
+	for lang := range langStats {
+		key := strings.ToLower(lang)
+		if target, ok := aliases[key]; ok {
+			canonical[key] = target
+			continue
+		}
+		if known := GetLanguageByName(lang); known != nil {
+			canonical[key] = known.Name
+			continue
+		}
+		if current, ok := canonical[key]; !ok || lang < current {
+			canonical[key] = lang
+		}
+	}
+
+	groups := make(map[string]string)
+	for lang := range langStats {
+		if name := canonical[strings.ToLower(lang)]; name != lang {
+			groups[lang] = name
+		}
+	}
+	return groups
+}
+
+// RowLanguage returns a function mapping the language of a counted file to
+// the row it is reported under once the langStats it was aggregated into
+// have been passed through MergeLanguageAliases and GroupStats
+func RowLanguage(langStats map[string]*LanguageStats, aliases, groups map[string]string) func(string) string {
+	renames := aliasGroups(langStats, aliases)
+	return func(lang string) string {
+		if name, ok := renames[lang]; ok {
+			lang = name
+		}
+		if group, ok := groups[lang]; ok {
+			lang = group
+		}
+		return lang
+	}
+}
+
+// AggregateEmbedded sums the embedded language lines found across files
+func AggregateEmbedded(fileStats []*FileStats) map[string]int {
+	embedded := make(map[string]int)
+
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+		for lang, lines := range fs.Embedded {
+			embedded[lang] += lines
+		}
+	}
+
+	return embedded
+}
+
+// ParseWeights parses comma-separated "Language=weight" pairs, as given to
+// --weights, into a weight per lower-cased canonical language name
+func ParseWeights(value string) (map[string]float64, error) {
+	specs := splitAndTrim(value, ",")
+	if len(specs) == 0 {
+		return nil, errors.New("no weights given, expected Language=weight,...")
+	}
+	weights := make(map[string]float64, len(specs))
+	for _, spec := range specs {
+		name, number, ok := strings.Cut(spec, "=")
+		name = trimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid weight %q, expected Language=weight", spec)
+		}
+		weight, err := strconv.ParseFloat(trimSpace(number), 64)
+		if err != nil || weight < 0 || math.IsInf(weight, 0) || math.IsNaN(weight) {
+			return nil, fmt.Errorf("invalid weight %q for %s, expected a number of 0 or more", trimSpace(number), name)
+		}
+		weights[strings.ToLower(CanonicalLanguageName(name))] = weight
+	}
+	return weights, nil
+}
+
+// ApplyWeights sets the Weighted score of every language to its code lines
+// times its weight in weights, as returned by ParseWeights. Languages
+// without a weight count 1.0.
+func ApplyWeights(langStats map[string]*LanguageStats, weights map[string]float64) {
+	for _, ls := range langStats {
+		weight, ok := weights[strings.ToLower(CanonicalLanguageName(ls.Language))]
+		if !ok {
+			weight = 1.0
+		}
+		ls.Weighted = float64(ls.CodeLines) * weight
+	}
 }
 
 // TotalStats calculates the total statistics across all languages
@@ -244,11 +858,7 @@ func TotalStats(langStats map[string]*LanguageStats) *LanguageStats {
 	}
 
 	for _, ls := range langStats {
-		total.FileCount += ls.FileCount
-		total.BlankLines += ls.BlankLines
-		total.CommentLines += ls.CommentLines
-		total.CodeLines += ls.CodeLines
-		total.TotalLines += ls.TotalLines
+		total.Add(ls)
 	}
 
 	return total
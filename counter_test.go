@@ -1,8 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -309,6 +315,86 @@ func TestTotalStats(t *testing.T) {
 	}
 }
 
+func TestLanguageStatsAdd(t *testing.T) {
+	// Fill every numeric field with a distinct value so a field missing
+	// from Add shows up here as soon as it is added to LanguageStats
+	a := &LanguageStats{Language: "Go"}
+	b := &LanguageStats{Language: "Other"}
+	av, bv := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < av.NumField(); i++ {
+		if av.Field(i).CanInt() {
+			av.Field(i).SetInt(int64(i + 1))
+			bv.Field(i).SetInt(int64(100 * (i + 1)))
+		}
+	}
+
+	a.Add(b)
+
+	if a.Language != "Go" {
+		t.Errorf("Add changed Language to %q", a.Language)
+	}
+	for i := 0; i < av.NumField(); i++ {
+		if !av.Field(i).CanInt() {
+			continue
+		}
+		if got, want := av.Field(i).Int(), int64(101*(i+1)); got != want {
+			t.Errorf("%s = %d after Add, want %d", av.Type().Field(i).Name, got, want)
+		}
+	}
+}
+
+func TestFileStatsAdd(t *testing.T) {
+	// Fill every numeric field with a distinct value so a field missing
+	// from Add shows up here as soon as it is added to FileStats
+	a := &FileStats{FilePath: "a.ipynb", Language: "Python", Extension: ".ipynb", Embedded: map[string]int{"SQL": 1}}
+	b := &FileStats{FilePath: "cell", Language: "Other", Extension: ".py", Embedded: map[string]int{"SQL": 2, "HTML": 3}}
+	av, bv := reflect.ValueOf(a).Elem(), reflect.ValueOf(b).Elem()
+	for i := 0; i < av.NumField(); i++ {
+		if av.Field(i).CanInt() {
+			av.Field(i).SetInt(int64(i + 1))
+			bv.Field(i).SetInt(int64(100 * (i + 1)))
+		}
+	}
+
+	a.Add(b)
+
+	if a.FilePath != "a.ipynb" || a.Language != "Python" || a.Extension != ".ipynb" {
+		t.Errorf("Add changed the file to %s, %s, %s", a.FilePath, a.Language, a.Extension)
+	}
+	for i := 0; i < av.NumField(); i++ {
+		field := av.Type().Field(i)
+		switch {
+		case av.Field(i).CanInt():
+			if got, want := av.Field(i).Int(), int64(101*(i+1)); got != want {
+				t.Errorf("%s = %d after Add, want %d", field.Name, got, want)
+			}
+		case field.Type.Kind() != reflect.String && field.Name != "Embedded":
+			t.Errorf("Field %s of type %s is not summed by Add", field.Name, field.Type)
+		}
+	}
+	if want := map[string]int{"SQL": 3, "HTML": 3}; !reflect.DeepEqual(a.Embedded, want) {
+		t.Errorf("Embedded = %v after Add, want %v", a.Embedded, want)
+	}
+
+	empty := &FileStats{}
+	empty.Add(&FileStats{CodeLines: 1})
+	if empty.Embedded != nil || empty.CodeLines != 1 {
+		t.Errorf("Add without embedded lines = %+v", empty)
+	}
+}
+
+func TestLanguageStatsAddFile(t *testing.T) {
+	ls := &LanguageStats{Language: "Go"}
+	fs := &FileStats{BlankLines: 1, CommentLines: 2, CodeLines: 3, TotalLines: 6, Bytes: 40, LineCommentLines: 2, TabIndented: 3}
+	ls.AddFile(fs)
+	ls.AddFile(fs)
+
+	want := &LanguageStats{Language: "Go", FileCount: 2, BlankLines: 2, CommentLines: 4, CodeLines: 6, TotalLines: 12, Bytes: 80, LineCommentLines: 4, TabIndented: 6}
+	if !reflect.DeepEqual(ls, want) {
+		t.Errorf("AddFile twice = %+v, want %+v", ls, want)
+	}
+}
+
 func TestCountLinesFileNotFound(t *testing.T) {
 	_, err := CountLines("/nonexistent/file.go", Languages[".go"])
 	if err == nil {
@@ -333,3 +419,890 @@ func TestAggregateStatsWithNil(t *testing.T) {
 		t.Errorf("Go FileCount = %d, want 2", goStats.FileCount)
 	}
 }
+
+func TestCountLinesWhitespaceOnly(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "locc-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name      string
+		content   string
+		wantBlank int
+		wantCode  int
+	}{
+		{"Tab-only lines", "\t\n\t\t\n", 2, 0},
+		{"Space-only lines", " \n    \n", 2, 0},
+		{"Mixed whitespace lines", " \t \n\f\n\v \t\n", 3, 0},
+		{"Whitespace around code", "\t\n\tx := 1\n \f\n", 2, 1},
+		{"Whitespace inside block comment", "/*\n\t \n*/\n", 1, 0},
+		{"Whitespace inside raw string", "s := `\n\t\n`\n", 1, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(tmpDir, "ws.go")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			stats, err := CountLines(filePath, Languages[".go"])
+			if err != nil {
+				t.Fatalf("CountLines failed: %v", err)
+			}
+
+			if stats.BlankLines != tt.wantBlank {
+				t.Errorf("BlankLines = %d, want %d", stats.BlankLines, tt.wantBlank)
+			}
+			if stats.CodeLines != tt.wantCode {
+				t.Errorf("CodeLines = %d, want %d", stats.CodeLines, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestGroupStats(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"JavaScript": {Language: "JavaScript", FileCount: 2, BlankLines: 4, CommentLines: 2, CodeLines: 40, TotalLines: 46},
+		"TypeScript": {Language: "TypeScript", FileCount: 3, BlankLines: 6, CommentLines: 3, CodeLines: 60, TotalLines: 69},
+		"Go":         {Language: "Go", FileCount: 1, BlankLines: 1, CommentLines: 1, CodeLines: 10, TotalLines: 12},
+	}
+	groups := map[string]string{
+		"JavaScript": "Frontend",
+		"TypeScript": "Frontend",
+		"JSX":        "Frontend",
+	}
+
+	grouped := GroupStats(langStats, groups)
+
+	if len(grouped) != 2 {
+		t.Fatalf("Expected 2 rows after grouping, got %d", len(grouped))
+	}
+
+	frontend, ok := grouped["Frontend"]
+	if !ok {
+		t.Fatal("Frontend group not found")
+	}
+	if frontend.Language != "Frontend" {
+		t.Errorf("Frontend Language = %q, want %q", frontend.Language, "Frontend")
+	}
+	if frontend.FileCount != 5 {
+		t.Errorf("Frontend FileCount = %d, want 5", frontend.FileCount)
+	}
+	if frontend.BlankLines != 10 || frontend.CommentLines != 5 || frontend.CodeLines != 100 || frontend.TotalLines != 115 {
+		t.Errorf("Frontend lines = %+v, want blank 10, comment 5, code 100, total 115", frontend)
+	}
+
+	if goStats, ok := grouped["Go"]; !ok || goStats.CodeLines != 10 {
+		t.Errorf("Ungrouped Go row not preserved: %+v", goStats)
+	}
+
+	before := TotalStats(langStats)
+	after := TotalStats(grouped)
+	if *before != *after {
+		t.Errorf("Totals changed after grouping: before %+v, after %+v", before, after)
+	}
+}
+
+func TestAggregateStatsCanonicalNames(t *testing.T) {
+	fileStats := []*FileStats{
+		{FilePath: "a.cpp", Language: "C++", CodeLines: 10, TotalLines: 10},
+		{FilePath: "b.cpp", Language: "Cpp", CodeLines: 5, TotalLines: 6},
+		{FilePath: "c.cpp", Language: "cplusplus", CodeLines: 1, TotalLines: 1},
+		{FilePath: "main.go", Language: "golang", CodeLines: 3, TotalLines: 3},
+		{FilePath: "notes.txt", Language: "Text", CodeLines: 2, TotalLines: 2},
+	}
+
+	langStats := AggregateStats(fileStats)
+	want := map[string][2]int{"C++": {3, 16}, "Go": {1, 3}, "Text": {1, 2}} // files, code
+	if len(langStats) != len(want) {
+		t.Errorf("AggregateStats() rows = %v, want %v", langStats, want)
+	}
+	for name, w := range want {
+		ls := langStats[name]
+		if ls == nil || ls.Language != name || ls.FileCount != w[0] || ls.CodeLines != w[1] {
+			t.Errorf("Row %q = %+v, want %d files and %d code lines", name, ls, w[0], w[1])
+		}
+	}
+	if fileStats[1].Language != "C++" {
+		t.Errorf("Per-file language = %q, want the canonical C++", fileStats[1].Language)
+	}
+	if lang := GetLanguageByName("cpp"); lang == nil || lang.Name != "C++" {
+		t.Errorf("GetLanguageByName(cpp) = %v, want C++", lang)
+	}
+}
+
+func TestGroupByPath(t *testing.T) {
+	root := t.TempDir()
+	fileStats := []*FileStats{
+		{FilePath: filepath.Join(root, "services", "api", "main.go"), Language: "Go", BlankLines: 1, CodeLines: 10, TotalLines: 11},
+		{FilePath: filepath.Join(root, "services", "api", "client.py"), Language: "Python", CommentLines: 2, CodeLines: 5, TotalLines: 7},
+		{FilePath: filepath.Join(root, "services", "web", "app.js"), Language: "JavaScript", CodeLines: 20, TotalLines: 20},
+		{FilePath: filepath.Join(root, "tools", "gen.go"), Language: "Go", CodeLines: 3, TotalLines: 3},
+		{FilePath: filepath.Join(root, "README.md"), Language: "Markdown", CodeLines: 4, TotalLines: 4},
+	}
+
+	grouped := GroupByPath(fileStats, regexp.MustCompile(`^services/([^/]+)/`), root)
+
+	want := map[string][2]int{ // files, code
+		"api":     {2, 15},
+		"web":     {1, 20},
+		Ungrouped: {2, 7},
+	}
+	if len(grouped) != len(want) {
+		t.Errorf("GroupByPath() rows = %v, want %v", grouped, want)
+	}
+	for name, w := range want {
+		ls, ok := grouped[name]
+		if !ok {
+			t.Errorf("Missing group %q", name)
+			continue
+		}
+		if ls.Language != name || ls.FileCount != w[0] || ls.CodeLines != w[1] {
+			t.Errorf("Group %q = %+v, want %d files and %d code lines", name, ls, w[0], w[1])
+		}
+	}
+
+	if got, want := TotalStats(grouped), TotalStats(AggregateStats(fileStats)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Grouping changed the totals: %+v, want %+v", got, want)
+	}
+}
+
+func TestSplitTests(t *testing.T) {
+	fileStats := []*FileStats{
+		{FilePath: filepath.Join("pkg", "walk.go"), Language: "Go", Extension: ".go", CodeLines: 40, TotalLines: 50},
+		{FilePath: filepath.Join("pkg", "walk_test.go"), Language: "Go", Extension: ".go", CodeLines: 20, TotalLines: 25},
+		{FilePath: filepath.Join("web", "app.js"), Language: "JavaScript", Extension: ".js", CodeLines: 30, TotalLines: 30},
+		{FilePath: filepath.Join("web", "app.test.js"), Language: "JavaScript", Extension: ".js", CodeLines: 6, TotalLines: 6},
+		{FilePath: filepath.Join("web", "app.spec.ts"), Language: "TypeScript", Extension: ".ts", CodeLines: 4, TotalLines: 4},
+		{FilePath: filepath.Join("tool", "test_cli.py"), Language: "Python", Extension: ".py", CodeLines: 10, TotalLines: 12},
+		{FilePath: filepath.Join("tool", "cli.py"), Language: "Python", Extension: ".py", CodeLines: 10, TotalLines: 10},
+		{FilePath: filepath.Join("tool", "testing.py"), Language: "Python", Extension: ".py", CodeLines: 5, TotalLines: 5},
+		{FilePath: filepath.Join("bin", "deploy"), Language: "Python", CodeLines: 15, TotalLines: 15},
+		{FilePath: filepath.Join("docs", "test_plan.md"), Language: "Markdown", Extension: ".md", CodeLines: 8, TotalLines: 8},
+	}
+
+	tests, source := SplitTests(fileStats)
+	if tests.FileCount != 4 || tests.CodeLines != 40 || tests.TotalLines != 47 {
+		t.Errorf("Test totals = %+v, want 4 files, 40 code and 47 total lines", tests)
+	}
+	if source.FileCount != 6 || source.CodeLines != 108 || source.TotalLines != 118 {
+		t.Errorf("Source totals = %+v, want 6 files, 108 code and 118 total lines", source)
+	}
+}
+
+func TestCountLinesContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.go")
+	os.WriteFile(path, []byte("package main\n"), 0644)
+
+	stats, err := CountLinesContext(context.Background(), path, Languages[".go"], CountOptions{})
+	if err != nil || stats.CodeLines != 1 {
+		t.Fatalf("CountLinesContext() = %+v, %v; want 1 code line", stats, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CountLinesContext(ctx, path, Languages[".go"], CountOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CountLinesContext() with a done context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCountLongLines(t *testing.T) {
+	under := "x := " + strings.Repeat("a", 15)         // 20 runes
+	over := "x := " + strings.Repeat("a", 16)          // 21 runes
+	wide := "s := \"" + strings.Repeat("世", 13) + "\"" // 20 runes, 46 bytes
+	comment := "// " + strings.Repeat("c", 40)
+	source := strings.Join([]string{"package main", under, over, wide, comment, "", wide + "!"}, "\n") + "\n"
+
+	stats, err := CountReader(strings.NewReader(source), "long.go", Languages[".go"], CountOptions{MaxLineLength: 20})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.LongLines != 2 {
+		t.Errorf("LongLines = %d, want 2: the 21-rune line and the wide line with one more rune", stats.LongLines)
+	}
+
+	stats, err = CountReader(strings.NewReader(source), "long.go", Languages[".go"], CountOptions{})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.LongLines != 0 {
+		t.Errorf("LongLines = %d without a maximum, want 0", stats.LongLines)
+	}
+}
+
+func TestTopFiles(t *testing.T) {
+	fileStats := []*FileStats{
+		{FilePath: "b.go", Language: "Go", CodeLines: 30},
+		{FilePath: "a.go", Language: "Go", CodeLines: 30},
+		{FilePath: "small.go", Language: "Go", CodeLines: 5},
+		{FilePath: "app.ts", Language: "TypeScript", CodeLines: 12},
+		{FilePath: "app.js", Language: "JavaScript", CodeLines: 20},
+	}
+
+	t.Run("By language", func(t *testing.T) {
+		top := TopFiles(fileStats, func(lang string) string { return lang })
+		if len(top) != 3 {
+			t.Fatalf("Got %d languages, want 3", len(top))
+		}
+		if top["Go"].FilePath != "a.go" {
+			t.Errorf("Top Go file = %s, want a.go, the first of the tied files", top["Go"].FilePath)
+		}
+		if top["TypeScript"].FilePath != "app.ts" || top["JavaScript"].FilePath != "app.js" {
+			t.Errorf("Top files = %s and %s, want app.ts and app.js", top["TypeScript"].FilePath, top["JavaScript"].FilePath)
+		}
+	})
+
+	t.Run("Grouped", func(t *testing.T) {
+		langStats := AggregateStats(fileStats)
+		top := TopFiles(fileStats, RowLanguage(langStats, nil, map[string]string{"TypeScript": "Web", "JavaScript": "Web"}))
+		if top["Web"] == nil || top["Web"].FilePath != "app.js" {
+			t.Errorf("Top Web file = %v, want app.js", top["Web"])
+		}
+	})
+}
+
+func TestCountStdin(t *testing.T) {
+	source := `package main
+
+// greet prints a greeting
+func greet() {
+	println("hi // not a comment")
+}
+`
+
+	t.Run("With language", func(t *testing.T) {
+		stats, err := CountStdin(bytes.NewReader([]byte(source)), "go")
+		if err != nil {
+			t.Fatalf("CountStdin failed: %v", err)
+		}
+		if stats.FilePath != StdinPath {
+			t.Errorf("FilePath = %q, want %q", stats.FilePath, StdinPath)
+		}
+		if stats.Language != "Go" {
+			t.Errorf("Language = %q, want %q", stats.Language, "Go")
+		}
+		if stats.BlankLines != 1 || stats.CommentLines != 1 || stats.CodeLines != 4 || stats.TotalLines != 6 {
+			t.Errorf("Got blank %d, comment %d, code %d, total %d; want 1, 1, 4, 6",
+				stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines)
+		}
+	})
+
+	t.Run("Without language", func(t *testing.T) {
+		stats, err := CountStdin(bytes.NewReader([]byte(source)), "")
+		if err != nil {
+			t.Fatalf("CountStdin failed: %v", err)
+		}
+		if stats.Language != "Unknown" {
+			t.Errorf("Language = %q, want %q", stats.Language, "Unknown")
+		}
+		if stats.CommentLines != 0 || stats.CodeLines != 5 {
+			t.Errorf("Got comment %d, code %d; want 0, 5", stats.CommentLines, stats.CodeLines)
+		}
+	})
+
+	t.Run("Unknown language", func(t *testing.T) {
+		if _, err := CountStdin(bytes.NewReader([]byte(source)), "NoSuchLang"); err == nil {
+			t.Error("Expected error for unknown language, got nil")
+		}
+	})
+}
+
+func TestCountLinesDetectEmbedded(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "locc-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	content := "package main\n" +
+		"\n" +
+		"// language=sql\n" +
+		"const query = `\n" +
+		"SELECT id, name\n" +
+		"\n" +
+		"FROM users\n" +
+		"WHERE id = ?`\n" +
+		"\n" +
+		"const plain = `\n" +
+		"not tagged\n" +
+		"`\n" +
+		"\n" +
+		"// language=graphql\n" +
+		"var x = 1\n" +
+		"var y = `\n" +
+		"hint already dropped\n" +
+		"`\n"
+	filePath := filepath.Join(tmpDir, "query.go")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	stats, err := CountLinesWithOptions(filePath, Languages[".go"], CountOptions{DetectEmbedded: true})
+	if err != nil {
+		t.Fatalf("CountLinesWithOptions failed: %v", err)
+	}
+
+	want := map[string]int{"SQL": 3}
+	if !reflect.DeepEqual(stats.Embedded, want) {
+		t.Errorf("Embedded = %v, want %v", stats.Embedded, want)
+	}
+	// Embedded lines are still code lines of the host file
+	if stats.CodeLines != 12 {
+		t.Errorf("CodeLines = %d, want 12", stats.CodeLines)
+	}
+
+	// Detection is opt-in
+	stats, err = CountLines(filePath, Languages[".go"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+	if stats.Embedded != nil {
+		t.Errorf("Embedded = %v, want nil without DetectEmbedded", stats.Embedded)
+	}
+}
+
+func TestParseLanguageHint(t *testing.T) {
+	tests := []struct {
+		comment string
+		want    string
+	}{
+		{" language=sql", "SQL"},
+		{"language=Go trailing text", "Go"},
+		{" language=cypher", "cypher"},
+		{" language=", ""},
+		{" just a comment", ""},
+	}
+	for _, tt := range tests {
+		if got := parseLanguageHint(tt.comment); got != tt.want {
+			t.Errorf("parseLanguageHint(%q) = %q, want %q", tt.comment, got, tt.want)
+		}
+	}
+}
+
+func TestCountLinesReportIndent(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "locc-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	content := "package main\n" +
+		"\n" +
+		"func main() {\n" +
+		"\tx := 1\n" +
+		"\t\ty := 2\n" +
+		"    z := 3\n" +
+		" \tw := 4\n" +
+		"\t// tab-indented comment is ignored\n" +
+		"    // space-indented comment is ignored\n" +
+		"\t\n" +
+		"}\n"
+	filePath := filepath.Join(tmpDir, "indent.go")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	stats, err := CountLinesWithOptions(filePath, Languages[".go"], CountOptions{ReportIndent: true})
+	if err != nil {
+		t.Fatalf("CountLinesWithOptions failed: %v", err)
+	}
+	if stats.TabIndented != 2 {
+		t.Errorf("TabIndented = %d, want 2", stats.TabIndented)
+	}
+	if stats.SpaceIndented != 1 {
+		t.Errorf("SpaceIndented = %d, want 1", stats.SpaceIndented)
+	}
+	if stats.MixedIndented != 1 {
+		t.Errorf("MixedIndented = %d, want 1", stats.MixedIndented)
+	}
+
+	langStats := AggregateStats([]*FileStats{stats, stats})
+	if langStats["Go"].TabIndented != 4 || langStats["Go"].SpaceIndented != 2 || langStats["Go"].MixedIndented != 2 {
+		t.Errorf("Aggregated indent = %+v", langStats["Go"])
+	}
+
+	stats, err = CountLines(filePath, Languages[".go"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+	if stats.TabIndented != 0 || stats.SpaceIndented != 0 || stats.MixedIndented != 0 {
+		t.Errorf("Indentation should not be reported without ReportIndent: %+v", stats)
+	}
+}
+
+func TestCountReaderRegions(t *testing.T) {
+	tests := []struct {
+		name        string
+		lang        *Language
+		input       string
+		wantRegions int
+		wantComment int
+		wantCode    int
+	}{
+		{
+			name:        "C# regions",
+			lang:        Languages[".cs"],
+			input:       "class A {\n    #region Fields\n    int x;\n    #endregion\n    // #region in a comment\n    string s = \"#region\";\n}\n",
+			wantRegions: 2,
+			wantComment: 1,
+			wantCode:    6,
+		},
+		{
+			name:        "Swift marks",
+			lang:        Languages[".swift"],
+			input:       "// MARK: - Lifecycle\nfunc a() {}\n\t// MARK: Helpers\n// MARKS are not marks\nlet b = 1\n",
+			wantRegions: 2,
+			wantComment: 3,
+			wantCode:    2,
+		},
+		{
+			name:        "Language without markers",
+			lang:        Languages[".go"],
+			input:       "#region\n// MARK: x\n",
+			wantComment: 1,
+			wantCode:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(tt.input), "test", tt.lang, CountOptions{Regions: true})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.RegionLines != tt.wantRegions || stats.CommentLines != tt.wantComment || stats.CodeLines != tt.wantCode {
+				t.Errorf("CountReader() = regions %d, comment %d, code %d; want %d, %d, %d",
+					stats.RegionLines, stats.CommentLines, stats.CodeLines, tt.wantRegions, tt.wantComment, tt.wantCode)
+			}
+
+			// Totals are the same with and without regions
+			plain, err := CountReader(strings.NewReader(tt.input), "test", tt.lang, CountOptions{})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if plain.RegionLines != 0 || plain.CommentLines != stats.CommentLines || plain.CodeLines != stats.CodeLines {
+				t.Errorf("Regions changed the counts: %+v, without: %+v", stats, plain)
+			}
+		})
+	}
+}
+
+func TestCountReaderTabWidth(t *testing.T) {
+	// Nine tabs reach column 72 at a width of 8, pushing the sequence
+	// number past the statement field, but only column 36 at a width of 4
+	content := "C     COMMENT IN COLUMN 1\n" +
+		"*     STAR COMMENT\n" +
+		"\tPROGRAM HELLO\n" +
+		"\tC = 1\n" +
+		"\t! INDENTED COMMENT\n" +
+		"\t\t\t\t\t\t\t\t\t00000010\n" +
+		"\tPRINT *, 'HI' ! TRAILING\n" +
+		"\tEND\n"
+
+	tests := []struct {
+		tabWidth    int
+		wantBlank   int
+		wantComment int
+		wantCode    int
+		wantIndent  int
+	}{
+		{tabWidth: 8, wantBlank: 1, wantComment: 3, wantCode: 4, wantIndent: 4 * 8},
+		{tabWidth: 0, wantBlank: 1, wantComment: 3, wantCode: 4, wantIndent: 4 * 8},
+		{tabWidth: 4, wantBlank: 0, wantComment: 3, wantCode: 5, wantIndent: 4*4 + 9*4},
+	}
+	for _, tt := range tests {
+		opts := CountOptions{ReportIndent: true, TabWidth: tt.tabWidth}
+		stats, err := CountReader(strings.NewReader(content), "hello.f", Languages[".f"], opts)
+		if err != nil {
+			t.Fatalf("CountReader failed: %v", err)
+		}
+		if stats.BlankLines != tt.wantBlank || stats.CommentLines != tt.wantComment || stats.CodeLines != tt.wantCode {
+			t.Errorf("Tab width %d: blank %d, comment %d, code %d; want %d, %d, %d",
+				tt.tabWidth, stats.BlankLines, stats.CommentLines, stats.CodeLines, tt.wantBlank, tt.wantComment, tt.wantCode)
+		}
+		if stats.IndentColumns != tt.wantIndent || stats.TabIndented != tt.wantCode {
+			t.Errorf("Tab width %d: indent columns %d over %d lines, want %d over %d",
+				tt.tabWidth, stats.IndentColumns, stats.TabIndented, tt.wantIndent, tt.wantCode)
+		}
+	}
+
+	// Languages without fixed columns only use the width for indentation
+	stats, err := CountReader(strings.NewReader("func f() {\n\t  x := 1\n}\n"), "f.go", Languages[".go"], CountOptions{ReportIndent: true, TabWidth: 4})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.IndentColumns != 6 || stats.MixedIndented != 1 {
+		t.Errorf("Go indent columns = %d over %d mixed lines, want 6 over 1", stats.IndentColumns, stats.MixedIndented)
+	}
+}
+
+func TestCountReaderFunctions(t *testing.T) {
+	tests := []struct {
+		ext   string
+		input string
+		want  int
+	}{
+		{".go", "package main\n\n// func commented() {}\nfunc main() {\n\tgo func() {}()\n}\n\nfunc (s *S) Method() int { return 0 }\n", 2},
+		{".py", "def a():\n    pass\n\nclass C:\n    def m(self):\n        pass\n    async def n(self):\n        pass\n# def commented():\nundefined = 1\n", 3},
+		{".js", "function a() {}\nconst b = function () {};\nconst c = (x) => x * 2;\n[1, 2].map(n => n + 1);\n// function commented() {}\nconst functional = 1;\n", 4},
+		{".ts", "export async function load(): Promise<void> {}\nconst f = (a: number): number => a;\n", 2},
+		{".rs", "fn main() {\n    let add = |a, b| a + b;\n}\npub fn helper(x: i32) -> i32 { x }\nlet f: fn(i32) -> i32 = helper;\n", 2},
+		{".rb", "def greet\n  puts 'hi'\nend\n  def self.build\n  end\n# def commented\n", 2},
+		{".sh", "#!/bin/sh\nsetup() {\n  echo hi\n}\nfunction cleanup {\n  rm -f x\n}\necho done\n", 2},
+		{".php", "<?php\nfunction a() {}\n$f = function () {};\n# function commented() {}\n", 2},
+		{".kt", "fun main() {}\nprivate fun helper(): Int = 1\nval funny = 1\n", 2},
+		{".swift", "func a() {}\nstatic func b() -> Int { 1 }\n", 2},
+		{".lua", "local function a() end\nfunction M.b() end\n-- function commented() end\n", 2},
+		{".c", "int main(void) { return 0; }\n", 0},
+	}
+
+	for _, tt := range tests {
+		lang := Languages[tt.ext]
+		t.Run(lang.Name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, lang, CountOptions{Functions: true})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.Functions != tt.want {
+				t.Errorf("CountReader() functions = %d, want %d", stats.Functions, tt.want)
+			}
+
+			plain, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, lang, CountOptions{})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if plain.Functions != 0 {
+				t.Errorf("Functions should only be counted with CountOptions.Functions, got %d", plain.Functions)
+			}
+		})
+	}
+}
+
+func TestCountReaderCommentedCode(t *testing.T) {
+	tests := []struct {
+		name        string
+		ext         string
+		input       string
+		wantComment int
+		wantCode    int
+	}{
+		{
+			name: "Go line and block comments",
+			ext:  ".go",
+			input: "// This computes the sum of the values.\n" +
+				"// x = compute(y)\n" +
+				"// fmt.Println(x)\n" +
+				"// See foo() for details\n" +
+				"/*\n * total += n;\n * Explains the loop\n */\n" +
+				"//if (done) {\n" +
+				"x := compute(y); // not a comment line\n",
+			wantComment: 9,
+			wantCode:    4,
+		},
+		{
+			name:        "Python hash comments",
+			ext:         ".py",
+			input:       "# TODO: refactor this\n# Note that a = b here\n# result = run(args)\n## print(result)\n",
+			wantComment: 4,
+			wantCode:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, Languages[tt.ext], CountOptions{CommentedCode: true})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.CommentLines != tt.wantComment || stats.CommentedCodeLines != tt.wantCode {
+				t.Errorf("CountReader() = comment %d, commented code %d; want %d, %d",
+					stats.CommentLines, stats.CommentedCodeLines, tt.wantComment, tt.wantCode)
+			}
+		})
+	}
+
+	prose := []string{"// Returns the number of lines.", "// TODO: handle errors", "# See run() for details"}
+	code := []string{"// return nil;", "// defer f.Close()", "#count += 1", "/* while (x) */"}
+	for _, line := range prose {
+		if isCommentedCode([]byte(line), Languages[".go"]) || isCommentedCode([]byte(line), Languages[".py"]) {
+			t.Errorf("isCommentedCode(%q) = true for prose", line)
+		}
+	}
+	for _, line := range code {
+		if !isCommentedCode([]byte(line), Languages[".go"]) && !isCommentedCode([]byte(line), Languages[".py"]) {
+			t.Errorf("isCommentedCode(%q) = false for a commented-out statement", line)
+		}
+	}
+}
+
+func TestCountReaderIgnoreHeader(t *testing.T) {
+	content := "// Copyright 2024 Example\n" +
+		"// Licensed under the Apache License\n" +
+		"//\n" +
+		"\n" +
+		"package main\n" +
+		"\n" +
+		"// main runs\n" +
+		"func main() {}\n"
+
+	tests := []struct {
+		name                        string
+		opts                        CountOptions
+		blank, comment, code, total int
+	}{
+		{"no header", CountOptions{}, 2, 4, 2, 8},
+		{"by count", CountOptions{IgnoreHeader: 3}, 2, 1, 2, 5},
+		{"until pattern", CountOptions{IgnoreHeaderUntil: regexp.MustCompile(`^package `)}, 1, 1, 2, 4},
+		{"count then pattern", CountOptions{IgnoreHeader: 1, IgnoreHeaderUntil: regexp.MustCompile(`^//$`)}, 2, 2, 2, 6},
+		{"pattern never matches", CountOptions{IgnoreHeaderUntil: regexp.MustCompile(`^import`)}, 2, 4, 2, 8},
+		{"count past the end", CountOptions{IgnoreHeader: 100}, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(content), "main.go", Languages[".go"], tt.opts)
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.BlankLines != tt.blank || stats.CommentLines != tt.comment || stats.CodeLines != tt.code || stats.TotalLines != tt.total {
+				t.Errorf("CountReader() = blank %d, comment %d, code %d, total %d; want %d, %d, %d, %d",
+					stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines, tt.blank, tt.comment, tt.code, tt.total)
+			}
+			if stats.Bytes != int64(len(content)) {
+				t.Errorf("Bytes = %d, want the full size %d", stats.Bytes, len(content))
+			}
+		})
+	}
+}
+
+func TestCountReaderCodeOnly(t *testing.T) {
+	content := "package main\n" +
+		"\n" +
+		"// line comment\n" +
+		"/* block\n" +
+		"   comment */\n" +
+		"func main() {}\n" +
+		"  \n"
+
+	stats, err := CountReader(strings.NewReader(content), "code.go", Languages[".go"], CountOptions{CodeOnly: true})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.CommentLines != 0 {
+		t.Errorf("CommentLines = %d, want 0 without comment detection", stats.CommentLines)
+	}
+	if stats.CodeLines != 5 || stats.BlankLines != 2 || stats.TotalLines != 7 {
+		t.Errorf("Got code %d, blank %d, total %d; want 5, 2, 7", stats.CodeLines, stats.BlankLines, stats.TotalLines)
+	}
+	if stats.CodeLines+stats.BlankLines != stats.TotalLines {
+		t.Errorf("code + blank = %d, want total %d", stats.CodeLines+stats.BlankLines, stats.TotalLines)
+	}
+}
+
+func TestCountReaderSplitComments(t *testing.T) {
+	content := "// line one\n" +
+		"// line two\n" +
+		"/* block\n" +
+		" * middle\n" +
+		" */\n" +
+		"/* one-line block */\n" +
+		"/* block */ // then line\n" +
+		"x := 1 /* trailing */\n" +
+		"\n" +
+		"    // indented line\n"
+
+	stats, err := CountReader(strings.NewReader(content), "mix.go", Languages[".go"], CountOptions{})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.LineCommentLines != 3 || stats.BlockCommentLines != 5 {
+		t.Errorf("Got %d line and %d block comment lines, want 3 and 5", stats.LineCommentLines, stats.BlockCommentLines)
+	}
+	if stats.LineCommentLines+stats.BlockCommentLines != stats.CommentLines {
+		t.Errorf("line + block = %d, want comment %d", stats.LineCommentLines+stats.BlockCommentLines, stats.CommentLines)
+	}
+
+	langStats := AggregateStats([]*FileStats{stats, stats})
+	total := TotalStats(GroupStats(langStats, map[string]string{"Go": "All"}))
+	if total.LineCommentLines != 6 || total.BlockCommentLines != 10 {
+		t.Errorf("Aggregated %d line and %d block comment lines, want 6 and 10", total.LineCommentLines, total.BlockCommentLines)
+	}
+}
+
+func BenchmarkCountReader(b *testing.B) {
+	var sb strings.Builder
+	for i := 0; i < 500; i++ {
+		sb.WriteString("/*\n * Comment-heavy block describing the function below.\n */\n")
+		sb.WriteString("// Another line comment with \"quotes\" and /* markers */\n")
+		sb.WriteString("func f() string { return \"value // not a comment\" }\n\n")
+	}
+	content := sb.String()
+
+	for _, tt := range []struct {
+		name string
+		opts CountOptions
+	}{
+		{"full", CountOptions{}},
+		{"code-only", CountOptions{CodeOnly: true}},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				if _, err := CountReader(strings.NewReader(content), "bench.go", Languages[".go"], tt.opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeLanguageAliases(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":      {Language: "Go", FileCount: 2, CodeLines: 20, TotalLines: 22},
+		"go":      {Language: "go", FileCount: 1, CodeLines: 5, TotalLines: 5},
+		"golang":  {Language: "golang", FileCount: 1, CodeLines: 3, TotalLines: 4},
+		"Jsonnet": {Language: "Jsonnet", FileCount: 1, CodeLines: 7, TotalLines: 7},
+		"jsonnet": {Language: "jsonnet", FileCount: 1, CodeLines: 1, TotalLines: 1},
+		"Python":  {Language: "Python", FileCount: 1, CodeLines: 9, TotalLines: 9},
+	}
+
+	merged := MergeLanguageAliases(langStats, map[string]string{"golang": "Go"})
+
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 rows after merging, got %d: %v", len(merged), merged)
+	}
+	if goStats := merged["Go"]; goStats == nil || goStats.FileCount != 4 || goStats.CodeLines != 28 || goStats.TotalLines != 31 {
+		t.Errorf("Go row = %+v, want 4 files, 28 code, 31 total", goStats)
+	}
+	if js := merged["Jsonnet"]; js == nil || js.FileCount != 2 || js.CodeLines != 8 {
+		t.Errorf("Jsonnet row = %+v, want 2 files, 8 code", js)
+	}
+	if py := merged["Python"]; py == nil || py.CodeLines != 9 {
+		t.Errorf("Python row not preserved: %+v", py)
+	}
+
+	if *TotalStats(langStats) != *TotalStats(merged) {
+		t.Errorf("Totals changed after merging")
+	}
+}
+
+func TestCountLinesBytes(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := "package main\r\n\r\n// comment\nfunc main() {}"
+	filePath := filepath.Join(tmpDir, "size.go")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	stats, err := CountLines(filePath, Languages[".go"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+	if stats.Bytes != int64(len(content)) {
+		t.Errorf("Bytes = %d, want %d", stats.Bytes, len(content))
+	}
+
+	langStats := AggregateStats([]*FileStats{stats, stats})
+	if langStats["Go"].Bytes != 2*int64(len(content)) {
+		t.Errorf("Aggregated Bytes = %d, want %d", langStats["Go"].Bytes, 2*len(content))
+	}
+	if total := TotalStats(langStats); total.Bytes != 2*int64(len(content)) {
+		t.Errorf("Total Bytes = %d, want %d", total.Bytes, 2*len(content))
+	}
+}
+
+func TestCountLinesGenericUnicodeWhitespace(t *testing.T) {
+	content := "\u00a0\n\u200b\n\u3000\u00a0\ntext\n"
+	stats, err := CountReaderGeneric(strings.NewReader(content), "notes")
+	if err != nil {
+		t.Fatalf("CountReaderGeneric failed: %v", err)
+	}
+	if stats.BlankLines != 3 || stats.CodeLines != 1 {
+		t.Errorf("Got blank %d, code %d; want 3, 1", stats.BlankLines, stats.CodeLines)
+	}
+}
+
+func TestAggregateByExtension(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"a.cpp":   "int a;\n// comment\n",
+		"b.cpp":   "int b;\n\n",
+		"c.cc":    "int c;\nint d;\nint e;\n",
+		"d.cxx":   "int f;\n",
+		"e.hpp":   "#pragma once\n",
+		"main.go": "package main\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	fileStats, errs := walker.Walk()
+	if len(errs) > 0 {
+		t.Fatalf("Walk returned errors: %v", errs)
+	}
+
+	rows := AggregateByExtension(fileStats)
+	type row struct {
+		language, extension string
+		files, code         int
+	}
+	var got []row
+	for _, es := range rows {
+		got = append(got, row{es.Language, es.Extension, es.FileCount, es.CodeLines})
+	}
+	want := []row{
+		{"C++", ".cc", 1, 3},
+		{"C++", ".cpp", 2, 2},
+		{"C++", ".cxx", 1, 1},
+		{"C++ Header", ".hpp", 1, 1},
+		{"Go", ".go", 1, 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AggregateByExtension() = %v, want %v", got, want)
+	}
+
+	// The extension rows add up to the language view, in every field
+	langTotal := TotalStats(AggregateStats(fileStats))
+	extTotal := &LanguageStats{Language: "Total"}
+	for _, es := range rows {
+		extTotal.Add(&es.LanguageStats)
+	}
+	if !reflect.DeepEqual(extTotal, langTotal) {
+		t.Errorf("Extension totals %+v do not match language totals %+v", extTotal, langTotal)
+	}
+}
+
+func TestApplyWeights(t *testing.T) {
+	weights, err := ParseWeights("Go=1.0, assembly=2.5,YAML=0.2")
+	if err != nil {
+		t.Fatalf("ParseWeights() error = %v", err)
+	}
+	langStats := map[string]*LanguageStats{
+		"Go":       {Language: "Go", CodeLines: 1000},
+		"Assembly": {Language: "Assembly", CodeLines: 200},
+		"YAML":     {Language: "YAML", CodeLines: 500},
+		"Python":   {Language: "Python", CodeLines: 30},
+	}
+	ApplyWeights(langStats, weights)
+
+	want := map[string]float64{"Go": 1000, "Assembly": 500, "YAML": 100, "Python": 30}
+	for lang, score := range want {
+		if got := langStats[lang].Weighted; got != score {
+			t.Errorf("%s weighted = %v, want %v", lang, got, score)
+		}
+	}
+	if total := TotalStats(langStats); total.Weighted != 1630 || total.CodeLines != 1730 {
+		t.Errorf("total weighted = %v (code %d), want 1630 (code 1730)", total.Weighted, total.CodeLines)
+	}
+
+	for _, value := range []string{"", "Go", "Go=fast", "Go=-1", "=2"} {
+		if _, err := ParseWeights(value); err == nil {
+			t.Errorf("ParseWeights(%q) should fail", value)
+		}
+	}
+}
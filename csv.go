@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// csvColumn is a column of csv and tsv output
+type csvColumn struct {
+	name  string
+	value func(*LanguageStats) string
+}
+
+func csvCount(count func(*LanguageStats) int) func(*LanguageStats) string {
+	return func(ls *LanguageStats) string { return strconv.Itoa(count(ls)) }
+}
+
+// csvColumns lists every column of csv and tsv output, in the default order
+var csvColumns = []csvColumn{
+	{"language", func(ls *LanguageStats) string { return ls.Language }},
+	{"files", csvCount(func(ls *LanguageStats) int { return ls.FileCount })},
+	{"blank", csvCount(func(ls *LanguageStats) int { return ls.BlankLines })},
+	{"comment", csvCount(func(ls *LanguageStats) int { return ls.CommentLines })},
+	{"code", csvCount(func(ls *LanguageStats) int { return ls.CodeLines })},
+	{"total", csvCount(func(ls *LanguageStats) int { return ls.TotalLines })},
+	{"bytes", func(ls *LanguageStats) string { return strconv.FormatInt(ls.Bytes, 10) }},
+}
+
+// CSVColumnNames returns the names of every csv and tsv column, in the
+// default order
+func CSVColumnNames() []string {
+	names := make([]string, len(csvColumns))
+	for i, col := range csvColumns {
+		names[i] = col.name
+	}
+	return names
+}
+
+// ParseCSVColumns parses a comma-separated list of column names, as given to
+// --columns, rejecting unknown and repeated names
+func ParseCSVColumns(value string) ([]string, error) {
+	known := CSVColumnNames()
+	names := splitAndTrim(value, ",")
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no columns given, expected some of: %s", strings.Join(known, ", "))
+	}
+	for i, name := range names {
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown column %q, expected one of: %s", name, strings.Join(known, ", "))
+		}
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("column %q given twice", name)
+		}
+	}
+	return names, nil
+}
+
+// PrintCSV writes a header row and one row per language, in the order of
+// sortBy as for --sort, separated by comma. columns names the columns and
+// their order; nil selects every column in the default order.
+func PrintCSV(w io.Writer, langStats map[string]*LanguageStats, columns []string, sortBy string, comma rune) error {
+	if columns == nil {
+		columns = CSVColumnNames()
+	}
+	selected := make([]csvColumn, 0, len(columns))
+	for _, name := range columns {
+		i := slices.IndexFunc(csvColumns, func(col csvColumn) bool { return col.name == name })
+		if i < 0 {
+			return fmt.Errorf("unknown column %q", name)
+		}
+		selected = append(selected, csvColumns[i])
+	}
+
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+	record := make([]string, len(selected))
+	for i, col := range selected {
+		record[i] = col.name
+	}
+	writer.Write(record)
+	for _, lang := range sortLanguages(langStats, sortBy) {
+		for i, col := range selected {
+			record[i] = col.value(langStats[lang])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintCSV(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 3, BlankLines: 5, CommentLines: 4, CodeLines: 40, TotalLines: 49, Bytes: 900},
+		"Python": {Language: "Python", FileCount: 1, CodeLines: 10, TotalLines: 10, Bytes: 120},
+	}
+
+	var buf bytes.Buffer
+	if err := PrintCSV(&buf, langStats, nil, "", ','); err != nil {
+		t.Fatalf("PrintCSV() error = %v", err)
+	}
+	want := "language,files,blank,comment,code,total,bytes\nGo,3,5,4,40,49,900\nPython,1,0,0,10,10,120\n"
+	if buf.String() != want {
+		t.Errorf("PrintCSV() with the default columns =\n%s\nwant\n%s", buf.String(), want)
+	}
+
+	columns, err := ParseCSVColumns("total, language,code")
+	if err != nil {
+		t.Fatalf("ParseCSVColumns() error = %v", err)
+	}
+	buf.Reset()
+	if err := PrintCSV(&buf, langStats, columns, SortByName, '\t'); err != nil {
+		t.Fatalf("PrintCSV() error = %v", err)
+	}
+	want = "total\tlanguage\tcode\n49\tGo\t40\n10\tPython\t10\n"
+	if buf.String() != want {
+		t.Errorf("PrintCSV() with custom tsv columns =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestParseCSVColumnsInvalid(t *testing.T) {
+	for _, value := range []string{"language,lines", "code,code", ""} {
+		if _, err := ParseCSVColumns(value); err == nil {
+			t.Errorf("ParseCSVColumns(%q) should fail", value)
+		}
+	}
+	if _, err := ParseCSVColumns("language,lines"); err == nil || !strings.Contains(err.Error(), `unknown column "lines"`) {
+		t.Errorf("ParseCSVColumns() error = %v, want it to name the unknown column", err)
+	}
+}
+
+func TestRunColumnsRequiresCSV(t *testing.T) {
+	config := &Config{Path: t.TempDir(), OutputFormat: "json", Quiet: true, Columns: []string{"code"}}
+	if err := Run(config); err == nil {
+		t.Error("Run should reject --columns with a format other than csv or tsv")
+	}
+}
+
+func TestRunCSVOmittedColumns(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\n// main runs\nfunc main() {}\n"), 0644)
+
+	tests := []struct {
+		config *Config
+		want   string
+	}{
+		{&Config{NoBlankCol: true, NoCommentCol: true}, "language,files,code,total,bytes\n"},
+		{&Config{NoBlankCol: true}, "language,files,comment,code,total,bytes\n"},
+		{&Config{NoCommentCol: true, Columns: []string{"language", "comment"}}, "language,comment\n"},
+	}
+	for _, tt := range tests {
+		tt.config.Path = tmpDir
+		tt.config.OutputFormat = "csv"
+		tt.config.Quiet = true
+		output := captureStdout(func() {
+			if err := Run(tt.config); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+		})
+		if header, _, _ := strings.Cut(output, "\n"); header+"\n" != tt.want {
+			t.Errorf("Header = %q, want %q", header+"\n", tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import "strings"
+
+// DataLanguage is the language data files are reported under with
+// --exclude-data. It has no comments, so every non-blank line is code.
+var DataLanguage = &Language{Name: "Data"}
+
+// DefaultDataExtensions lists the file name suffixes treated as data rather
+// than code with --exclude-data, unless replaced with --data-ext
+var DefaultDataExtensions = []string{
+	".json",
+	".lock",
+	".min.js",
+	".min.css",
+	".csv",
+	".tsv",
+}
+
+// dataSuffixes normalizes a list of data extensions to lower case with a
+// leading dot
+func dataSuffixes(exts []string) []string {
+	suffixes := make([]string, 0, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		suffixes = append(suffixes, ext)
+	}
+	return suffixes
+}
+
+// isDataFile reports whether fileName ends in one of the data suffixes.
+// Suffixes may span several extensions, as ".min.js" does.
+func isDataFile(fileName string, suffixes []string) bool {
+	fileName = strings.ToLower(fileName)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(fileName, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DiffRow holds the code lines of one language in two compared trees
+type DiffRow struct {
+	Language string
+	A        int
+	B        int
+	Delta    int
+}
+
+// DiffStats compares the code lines per language of two results. Languages
+// present in only one tree count as zero in the other. Rows are sorted by
+// absolute delta (descending), then by name.
+func DiffStats(a, b map[string]*LanguageStats) []DiffRow {
+	rows := make(map[string]*DiffRow)
+	for lang, ls := range a {
+		rows[lang] = &DiffRow{Language: lang, A: ls.CodeLines}
+	}
+	for lang, ls := range b {
+		if _, exists := rows[lang]; !exists {
+			rows[lang] = &DiffRow{Language: lang}
+		}
+		rows[lang].B = ls.CodeLines
+	}
+
+	result := make([]DiffRow, 0, len(rows))
+	for _, row := range rows {
+		row.Delta = row.B - row.A
+		result = append(result, *row)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		di, dj := abs(result[i].Delta), abs(result[j].Delta)
+		if di != dj {
+			return di > dj
+		}
+		return result[i].Language < result[j].Language
+	})
+
+	return result
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// RunDiff counts the two directories in config.DiffDirs and prints a
+// per-language comparison of their code lines
+func RunDiff(config *Config) error {
+	if len(config.DiffDirs) != 2 {
+		return fmt.Errorf("--diff-dirs requires exactly two directories, got %d", len(config.DiffDirs))
+	}
+
+	startTime := time.Now()
+
+	stats := make([]map[string]*LanguageStats, 2)
+	for i, dir := range config.DiffDirs {
+		result, err := Scan(config, dir)
+		if err != nil {
+			return err
+		}
+		stats[i] = MergeLanguageAliases(result.LangStats, config.Aliases)
+		if len(config.Groups) > 0 {
+			stats[i] = GroupStats(stats[i], config.Groups)
+		}
+	}
+
+	PrintDiff(config.DiffDirs[0], config.DiffDirs[1], DiffStats(stats[0], stats[1]), TotalStats(stats[0]), TotalStats(stats[1]))
+
+	LogInfo("Time elapsed: %v", time.Since(startTime).Round(time.Millisecond))
+
+	return nil
+}
+
+// PrintDiff prints the comparison table produced by DiffStats
+func PrintDiff(dirA, dirB string, rows []DiffRow, totalA, totalB *LanguageStats) {
+	languages := make([]string, 0, len(rows))
+	for _, row := range rows {
+		languages = append(languages, row.Language)
+	}
+	langWidth := languageColumnWidth(languages, colCode, colCode, colCode)
+	width := tableWidth(langWidth, colCode, colCode, colCode)
+
+	fmt.Println()
+	fmt.Printf("A: %s\n", dirA)
+	fmt.Printf("B: %s\n", dirB)
+	fmt.Println(strings.Repeat("-", width))
+	fmt.Printf("%-*s %*s %*s %*s\n", langWidth, "Language", colCode, "A", colCode, "B", colCode, "Delta")
+	fmt.Println(strings.Repeat("-", width))
+
+	for _, row := range rows {
+		fmt.Printf("%-*s %*d %*d %*s\n", langWidth, truncateLanguage(row.Language, langWidth), colCode, row.A, colCode, row.B, colCode, formatDelta(row.Delta))
+	}
+
+	fmt.Println(strings.Repeat("-", width))
+	fmt.Printf("%-*s %*d %*d %*s\n", langWidth, "Total", colCode, totalA.CodeLines, colCode, totalB.CodeLines,
+		colCode, formatDelta(totalB.CodeLines-totalA.CodeLines))
+	fmt.Println(strings.Repeat("-", width))
+	fmt.Println()
+}
+
+// formatDelta formats a difference with an explicit sign
+func formatDelta(n int) string {
+	if n > 0 {
+		return fmt.Sprintf("+%d", n)
+	}
+	return fmt.Sprintf("%d", n)
+}
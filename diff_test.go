@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestDiffStats(t *testing.T) {
+	a := map[string]*LanguageStats{
+		"Go":     {Language: "Go", CodeLines: 100},
+		"Python": {Language: "Python", CodeLines: 30},
+	}
+	b := map[string]*LanguageStats{
+		"Go":   {Language: "Go", CodeLines: 90},
+		"Rust": {Language: "Rust", CodeLines: 50},
+	}
+
+	got := DiffStats(a, b)
+	want := []DiffRow{
+		{Language: "Rust", A: 0, B: 50, Delta: 50},
+		{Language: "Python", A: 30, B: 0, Delta: -30},
+		{Language: "Go", A: 100, B: 90, Delta: -10},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dirA, err := os.MkdirTemp("", "diff-a")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dirA)
+	dirB, err := os.MkdirTemp("", "diff-b")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dirB)
+
+	mainGo := []byte("package main\n\nfunc main() {}\n")
+	os.WriteFile(filepath.Join(dirA, "main.go"), mainGo, 0644)
+	os.WriteFile(filepath.Join(dirB, "main.go"), mainGo, 0644)
+	os.WriteFile(filepath.Join(dirB, "extra.py"), []byte("x = 1\ny = 2\n"), 0644)
+
+	var runErr error
+	output := captureStdout(func() {
+		runErr = Run(&Config{DiffDirs: []string{dirA, dirB}, Quiet: true})
+	})
+	if runErr != nil {
+		t.Fatalf("Run() error = %v", runErr)
+	}
+
+	if !containsRow(output, "Python", "0", "2", "+2") {
+		t.Errorf("Missing Python row with delta +2:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "2", "0") {
+		t.Errorf("Missing unchanged Go row:\n%s", output)
+	}
+	if !containsRow(output, "Total", "2", "4", "+2") {
+		t.Errorf("Missing Total row:\n%s", output)
+	}
+
+	if err := Run(&Config{DiffDirs: []string{dirA}, Quiet: true}); err == nil {
+		t.Error("Expected error for a single --diff-dirs argument")
+	}
+}
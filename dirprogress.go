@@ -0,0 +1,116 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dirCounts holds the files of one directory seen by a walk
+type dirCounts struct {
+	pending int  // files sent for counting and not counted yet
+	files   int  // files counted
+	code    int  // code lines of the files counted
+	walked  bool // the walk has left the directory
+}
+
+// dirProgress logs a summary of every directory of a walk at Info level
+// once the walk has left it and its files are all counted. Only the files
+// directly in a directory count towards it, not those of its
+// subdirectories. It is safe for concurrent use.
+type dirProgress struct {
+	mu   sync.Mutex
+	root string
+	dirs map[string]*dirCounts
+	open []string // directories the walk is in, innermost last
+}
+
+// newDirProgress returns a tracker for a walk of root
+func newDirProgress(root string) *dirProgress {
+	return &dirProgress{root: root, dirs: make(map[string]*dirCounts)}
+}
+
+// visit records that the walk reached path, so it has left the open
+// directories path is not in
+func (p *dirProgress) visit(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.open) > 0 && !isWithin(p.open[len(p.open)-1], path) {
+		p.leave()
+	}
+}
+
+// enter records that the walk went into the directory at path
+func (p *dirProgress) enter(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.open = append(p.open, path)
+}
+
+// dispatched records that the file at path was sent for counting
+func (p *dirProgress) dispatched(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dir := filepath.Dir(path)
+	if p.dirs[dir] == nil {
+		p.dirs[dir] = &dirCounts{}
+	}
+	p.dirs[dir].pending++
+}
+
+// counted records the outcome of counting the file at path: its stats, or
+// nil if it could not be counted
+func (p *dirProgress) counted(path string, stats *FileStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	dir := filepath.Dir(path)
+	counts := p.dirs[dir]
+	if counts == nil {
+		return
+	}
+	counts.pending--
+	if stats != nil {
+		counts.files++
+		counts.code += stats.CodeLines
+	}
+	p.report(dir)
+}
+
+// finish records that the walk has ended, leaving every open directory
+func (p *dirProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.open) > 0 {
+		p.leave()
+	}
+}
+
+// leave marks the innermost open directory as walked
+func (p *dirProgress) leave() {
+	dir := p.open[len(p.open)-1]
+	p.open = p.open[:len(p.open)-1]
+	if counts := p.dirs[filepath.Clean(dir)]; counts != nil {
+		counts.walked = true
+		p.report(filepath.Clean(dir))
+	}
+}
+
+// report logs the summary of dir if it is complete, and forgets it
+func (p *dirProgress) report(dir string) {
+	counts := p.dirs[dir]
+	if !counts.walked || counts.pending > 0 {
+		return
+	}
+	delete(p.dirs, dir)
+	name := dir
+	if rel, err := filepath.Rel(p.root, dir); err == nil {
+		name = rel
+	}
+	LogInfo("Processed directory %s: %d files, %s code lines", name, counts.files, FormatNumber(int64(counts.code)))
+}
+
+// isWithin reports whether path is dir or below it
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"unicode"
+)
+
+// DocCommentRules tells the doc comments of a language apart from its other
+// comments
+type DocCommentRules struct {
+	LineMarkers []string // line comment markers of doc comments, e.g. "///"
+	BlockStarts []string // block comment openers of doc comments, e.g. "/**"
+
+	// Above marks the comment lines directly above a matching code line as
+	// docs, as for Go declarations
+	Above *regexp.Regexp
+
+	// After marks a block comment directly after a matching code line as a
+	// doc, and Leading one opening the file, as for Python docstrings
+	After   *regexp.Regexp
+	Leading bool
+}
+
+// cStyleDocs are the Doxygen-style doc comments of the C family
+var cStyleDocs = &DocCommentRules{
+	LineMarkers: []string{"///", "//!"},
+	BlockStarts: []string{"/**", "/*!"},
+}
+
+// javadocDocs are the /** */ doc blocks of Javadoc and its descendants
+var javadocDocs = &DocCommentRules{BlockStarts: []string{"/**"}}
+
+// DocComments maps language names to their doc comment rules. Languages
+// without an entry have no doc comments.
+var DocComments = map[string]*DocCommentRules{
+	"Go": {
+		Above: regexp.MustCompile(`^\s*(package|func|type|var|const)\b`),
+	},
+	"Rust":       cStyleDocs,
+	"C":          cStyleDocs,
+	"C Header":   cStyleDocs,
+	"C++":        cStyleDocs,
+	"C++ Header": cStyleDocs,
+	"C#":         {LineMarkers: []string{"///"}, BlockStarts: []string{"/**"}},
+	"Swift":      {LineMarkers: []string{"///"}, BlockStarts: []string{"/**"}},
+	"D":          {LineMarkers: []string{"///"}, BlockStarts: []string{"/**", "/++"}},
+	"Java":       javadocDocs,
+	"Kotlin":     javadocDocs,
+	"Scala":      javadocDocs,
+	"JavaScript": javadocDocs,
+	"TypeScript": javadocDocs,
+	"PHP":        javadocDocs,
+	"Python": {
+		After:   regexp.MustCompile(`^\s*(async\s+)?(def|class)\s.*:\s*(#.*)?$`),
+		Leading: true,
+	},
+}
+
+// docTracker counts the doc comment lines of a file, fed every line in
+// order with its classification
+type docTracker struct {
+	rules *DocCommentRules
+
+	lines      int  // doc comment lines found so far
+	pending    int  // comment lines that are docs if a matching line follows
+	inBlock    bool // the previous line ended inside a block comment
+	blockIsDoc bool // the current block comment is a doc
+	afterMatch bool // the last code line matched rules.After
+	seenLine   bool // a non-blank line has been seen
+}
+
+// newDocTracker returns a tracker for lang, or nil if it has no doc comments
+func newDocTracker(lang *Language) *docTracker {
+	if rules := DocComments[lang.Name]; rules != nil {
+		return &docTracker{rules: rules}
+	}
+	return nil
+}
+
+// add records the next line, classified as info, with open telling whether
+// a block comment continues past it
+func (d *docTracker) add(line []byte, info LineInfo, open bool) {
+	wasInBlock := d.inBlock
+	d.inBlock = open
+
+	switch info.Kind {
+	case LineBlank:
+		// A blank line ends a comment, unless it is inside a block comment
+		if !wasInBlock {
+			d.pending = 0
+		}
+		return
+	case LineCode:
+		if d.rules.Above != nil && d.pending > 0 && d.rules.Above.Match(line) {
+			d.lines += d.pending
+		}
+		d.pending = 0
+		d.afterMatch = d.rules.After != nil && d.rules.After.Match(line)
+		d.seenLine = true
+		return
+	}
+
+	trimmed := bytes.TrimLeftFunc(line, unicode.IsSpace)
+	isDoc := false
+	if info.Block {
+		if !wasInBlock {
+			// The line opens a block comment
+			d.blockIsDoc = startsDocBlock(trimmed, d.rules.BlockStarts) ||
+				(d.rules.After != nil && d.afterMatch) || (d.rules.Leading && !d.seenLine)
+		}
+		isDoc = d.blockIsDoc
+	} else {
+		for _, marker := range d.rules.LineMarkers {
+			if hasPrefix(trimmed, marker) {
+				isDoc = true
+				break
+			}
+		}
+	}
+	d.afterMatch = false
+	d.seenLine = true
+
+	if isDoc {
+		d.lines++
+	} else if d.rules.Above != nil {
+		d.pending++
+	}
+}
+
+// startsDocBlock reports whether line opens a block comment with one of
+// starts, other than an empty comment such as "/**/"
+func startsDocBlock(line []byte, starts []string) bool {
+	for _, start := range starts {
+		if hasPrefix(line, start) && !hasPrefix(line[len(start)-1:], "*/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCountReaderDocComments(t *testing.T) {
+	tests := []struct {
+		name        string
+		ext         string
+		input       string
+		wantComment int
+		wantDoc     int
+	}{
+		{
+			name: "Go comments above declarations",
+			ext:  ".go",
+			input: "// Package main is a tool.\n" +
+				"package main\n" +
+				"\n" +
+				"// A detached comment\n" +
+				"\n" +
+				"// Sum returns the sum\n" +
+				"// of the values.\n" +
+				"func Sum(values []int) int {\n" +
+				"\t// not a doc comment\n" +
+				"\treturn 0\n" +
+				"}\n" +
+				"\n" +
+				"/*\nPoint is a point.\n*/\n" +
+				"type Point struct{}\n" +
+				"// trailing comment\n",
+			wantComment: 9,
+			wantDoc:     6,
+		},
+		{
+			name: "Rust triple slash",
+			ext:  ".rs",
+			input: "//! Crate docs\n" +
+				"/// Adds one.\n" +
+				"// implementation note\n" +
+				"fn add(x: i32) -> i32 { x + 1 }\n" +
+				"/**/\n",
+			wantComment: 4,
+			wantDoc:     2,
+		},
+		{
+			name: "Java doc blocks",
+			ext:  ".java",
+			input: "/**\n * A greeter.\n */\n" +
+				"class Greeter {\n" +
+				"    /* not a doc */\n" +
+				"    /** Says hello. */\n" +
+				"    void greet() {}\n" +
+				"    // line comment\n" +
+				"}\n",
+			wantComment: 6,
+			wantDoc:     4,
+		},
+		{
+			name: "Python docstrings",
+			ext:  ".py",
+			input: "\"\"\"Module docs.\"\"\"\n" +
+				"# a comment\n" +
+				"def f():\n" +
+				"    \"\"\"Function docs,\n" +
+				"    on two lines.\"\"\"\n" +
+				"    x = 1\n" +
+				"    \"\"\"A stray string.\"\"\"\n",
+			wantComment: 5,
+			wantDoc:     3,
+		},
+		{
+			name:        "language without rules",
+			ext:         ".sh",
+			input:       "# a comment\necho hi\n",
+			wantComment: 1,
+			wantDoc:     0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, Languages[tt.ext], CountOptions{DocComments: true})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.CommentLines != tt.wantComment || stats.DocCommentLines != tt.wantDoc {
+				t.Errorf("CountReader() = comment %d, doc comment %d; want %d, %d",
+					stats.CommentLines, stats.DocCommentLines, tt.wantComment, tt.wantDoc)
+			}
+
+			plain, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, Languages[tt.ext], CountOptions{})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if plain.DocCommentLines != 0 || plain.CommentLines != stats.CommentLines {
+				t.Errorf("Without DocComments, got doc comment %d and comment %d lines", plain.DocCommentLines, plain.CommentLines)
+			}
+		})
+	}
+}
+
+func TestPrintTableDocComments(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":    {Language: "Go", FileCount: 2, CommentLines: 8, DocCommentLines: 6, CodeLines: 30, TotalLines: 38},
+		"Shell": {Language: "Shell", FileCount: 1, CodeLines: 5, TotalLines: 5},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{DocComments: true}, 3, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Blank", "Comment", "Code", "Total", "DocComment", "Doc%") {
+		t.Errorf("Expected DocComment and Doc%% headers:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "0", "8", "30", "38", "6", "75.0%") || !containsRow(output, "Shell", "1", "0", "0", "5", "5", "0", "-") {
+		t.Errorf("Expected doc comment counts and shares per language:\n%s", output)
+	}
+	checkSeparatorWidth(t, "PrintTable(os.Stdout, DocComments)", output, "Language")
+}
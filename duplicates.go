@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DuplicateGroup is a set of counted files with identical content
+type DuplicateGroup struct {
+	Hash  string   // hex SHA-256 of the shared content
+	Files []string // reported paths, sorted
+	Lines int      // total lines of each copy
+}
+
+// DuplicatedLines returns the lines that could be removed by keeping a single
+// copy of the group
+func (g DuplicateGroup) DuplicatedLines() int {
+	return (len(g.Files) - 1) * g.Lines
+}
+
+// hashFile returns the hex SHA-256 of the content of the file at path
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// FindDuplicates groups the counted files by content hash, whatever their
+// language, and returns the groups with more than one file, sorted by
+// duplicated lines (descending), then by first path. Only files of equal size
+// are hashed, and files that cannot be read again are left out. Paths are
+// reported relative to relativeTo when it is set.
+func FindDuplicates(fileStats []*FileStats, relativeTo string) []DuplicateGroup {
+	bySize := make(map[int64][]*FileStats)
+	for _, fs := range fileStats {
+		if fs == nil || fs.TotalLines == 0 {
+			continue
+		}
+		bySize[fs.Bytes] = append(bySize[fs.Bytes], fs)
+	}
+
+	byHash := make(map[string]*DuplicateGroup)
+	for _, files := range bySize {
+		if len(files) < 2 {
+			continue
+		}
+		for _, fs := range files {
+			hash, err := hashFile(fs.FilePath)
+			if err != nil {
+				LogDebug("Skipping duplicate check of %s: %v", fs.FilePath, err)
+				continue
+			}
+			group, ok := byHash[hash]
+			if !ok {
+				group = &DuplicateGroup{Hash: hash, Lines: fs.TotalLines}
+				byHash[hash] = group
+			}
+			group.Files = append(group.Files, reportPath(fs.FilePath, relativeTo))
+		}
+	}
+
+	var groups []DuplicateGroup
+	for _, group := range byHash {
+		if len(group.Files) < 2 {
+			continue
+		}
+		sort.Strings(group.Files)
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		di, dj := groups[i].DuplicatedLines(), groups[j].DuplicatedLines()
+		if di != dj {
+			return di > dj
+		}
+		return groups[i].Files[0] < groups[j].Files[0]
+	})
+	return groups
+}
+
+// PrintDuplicates prints every group of identical files with its line count,
+// followed by the lines duplicated across all groups
+func PrintDuplicates(w io.Writer, groups []DuplicateGroup) {
+	width := tableWidth(colFiles, colTotal, colCode, colLanguage)
+
+	fmt.Fprintln(w, "Duplicate files:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	if len(groups) == 0 {
+		fmt.Fprintln(w, "No duplicate files found")
+	}
+	duplicated := 0
+	for _, group := range groups {
+		fmt.Fprintf(w, "%d copies of %d lines (%d duplicated lines), sha256 %s\n",
+			len(group.Files), group.Lines, group.DuplicatedLines(), group.Hash[:12])
+		for _, path := range group.Files {
+			fmt.Fprintf(w, "  %s\n", path)
+		}
+		duplicated += group.DuplicatedLines()
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "Duplicate groups: %d, duplicated lines: %d\n", len(groups), duplicated)
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFindDuplicates(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := []byte("package main\n\n// helper is copied around\nfunc helper() {}\n")
+	os.MkdirAll(filepath.Join(tmpDir, "copy"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "a.go"), content, 0644)
+	os.WriteFile(filepath.Join(tmpDir, "copy", "b.go"), content, 0644)
+	// Same size, different content
+	os.WriteFile(filepath.Join(tmpDir, "c.go"), []byte(strings.Replace(string(content), "helper", "helpme", 2)), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "d.go"), []byte("package main\n"), 0644)
+
+	config := &Config{Path: tmpDir, Duplicates: true, Quiet: true}
+	result, err := Scan(config, tmpDir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+
+	groups := FindDuplicates(result.FileStats, tmpDir)
+	if len(groups) != 1 {
+		t.Fatalf("FindDuplicates() = %+v, want one group", groups)
+	}
+	want := []string{"a.go", filepath.Join("copy", "b.go")}
+	if g := groups[0]; strings.Join(g.Files, ",") != strings.Join(want, ",") || g.Lines != 4 || g.DuplicatedLines() != 4 {
+		t.Errorf("FindDuplicates() = %+v, want files %v of 4 lines", g, want)
+	}
+
+	config.OutputFormat = "default"
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, "2 copies of 4 lines (4 duplicated lines)") || !strings.Contains(output, "Duplicate groups: 1, duplicated lines: 4") {
+		t.Errorf("Expected the duplicate group to be reported:\n%s", output)
+	}
+	if !containsRow(output, "Go", "4", "3", "3", "7", "13") {
+		t.Errorf("Expected every copy to still be counted:\n%s", output)
+	}
+}
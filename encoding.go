@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// replacementChar is the UTF-8 encoding of U+FFFD
+var replacementChar = []byte(string(utf8.RuneError))
+
+// validUTF8 returns line with every invalid UTF-8 sequence replaced by
+// U+FFFD, so comment detection and anything shown from the line work on
+// whole characters. Valid lines, the common case, are returned as they are
+// without allocating.
+func validUTF8(line []byte) []byte {
+	if utf8.Valid(line) {
+		return line
+	}
+	return bytes.ToValidUTF8(line, replacementChar)
+}
+
+// decodeUTF16 returns a reader yielding the content of r as UTF-8. Content
+// starting with a UTF-16 byte order mark is transcoded and the mark dropped;
+// anything else is passed through unchanged.
+func decodeUTF16(r io.Reader) io.Reader {
+	br := bufio.NewReader(r)
+	bom, _ := br.Peek(2)
+	if len(bom) < 2 {
+		return br
+	}
+
+	var order binary.ByteOrder
+	switch {
+	case bom[0] == 0xFF && bom[1] == 0xFE:
+		order = binary.LittleEndian
+	case bom[0] == 0xFE && bom[1] == 0xFF:
+		order = binary.BigEndian
+	default:
+		return br
+	}
+	br.Discard(2)
+	return &utf16Reader{r: br, order: order}
+}
+
+// utf16Reader transcodes UTF-16 code units read from r into UTF-8
+type utf16Reader struct {
+	r       *bufio.Reader
+	order   binary.ByteOrder
+	pending []byte // transcoded bytes not yet returned
+	next    rune   // code unit read ahead while pairing surrogates
+	hasNext bool
+	unit    [2]byte
+	err     error
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.pending) < len(p) && u.err == nil {
+		r, err := u.readRune()
+		if err != nil {
+			u.err = err
+			break
+		}
+		u.pending = utf8.AppendRune(u.pending, r)
+	}
+
+	n := copy(p, u.pending)
+	u.pending = append(u.pending[:0], u.pending[n:]...)
+	if n == 0 && len(p) > 0 {
+		return 0, u.err
+	}
+	return n, nil
+}
+
+// readRune decodes the next character, replacing unpaired surrogates and a
+// trailing odd byte with U+FFFD
+func (u *utf16Reader) readRune() (rune, error) {
+	r1, err := u.readUnit()
+	if err != nil {
+		return 0, err
+	}
+	if !utf16.IsSurrogate(r1) {
+		return r1, nil
+	}
+	if r1 >= 0xDC00 {
+		// Low surrogate without a preceding high surrogate
+		return utf8.RuneError, nil
+	}
+
+	r2, err := u.readUnit()
+	if err != nil {
+		return utf8.RuneError, nil
+	}
+	if r := utf16.DecodeRune(r1, r2); r != utf8.RuneError {
+		return r, nil
+	}
+	// Not a low surrogate: keep it as the start of the next character
+	u.next, u.hasNext = r2, true
+	return utf8.RuneError, nil
+}
+
+// readUnit returns the next UTF-16 code unit
+func (u *utf16Reader) readUnit() (rune, error) {
+	if u.hasNext {
+		u.hasNext = false
+		return u.next, nil
+	}
+
+	n, err := io.ReadFull(u.r, u.unit[:])
+	if err == io.ErrUnexpectedEOF && n == 1 {
+		return utf8.RuneError, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return rune(u.order.Uint16(u.unit[:])), nil
+}
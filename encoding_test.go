@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s as UTF-16 with a byte order mark
+func encodeUTF16(s string, order binary.AppendByteOrder) []byte {
+	data := order.AppendUint16(nil, 0xFEFF)
+	for _, unit := range utf16.Encode([]rune(s)) {
+		data = order.AppendUint16(data, unit)
+	}
+	return data
+}
+
+func TestDecodeUTF16(t *testing.T) {
+	text := "héllo 世界 \U0001F600\r\nline two\n"
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"little-endian", encodeUTF16(text, binary.LittleEndian), text},
+		{"big-endian", encodeUTF16(text, binary.BigEndian), text},
+		{"UTF-8 passes through", []byte(text), text},
+		{"unpaired surrogate", []byte{0xFF, 0xFE, 0x00, 0xD8, 'a', 0x00}, "\ufffda"},
+		{"odd trailing byte", []byte{0xFF, 0xFE, 'a', 0x00, 'b'}, "a\ufffd"},
+		{"single byte", []byte{'x'}, "x"},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := io.ReadAll(decodeUTF16(strings.NewReader(string(tt.input))))
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("decodeUTF16() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountLinesUTF16(t *testing.T) {
+	content := "// Package main\r\npackage main\r\n\r\n/* block\r\n   comment */\r\nfunc main() {\r\n\ts := \"// 文字列\"\r\n}\r\n"
+
+	dir := t.TempDir()
+	utf8Path := filepath.Join(dir, "utf8.go")
+	if err := os.WriteFile(utf8Path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	want, err := CountLines(utf8Path, Languages[".go"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+
+	for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+		data := encodeUTF16(content, order)
+		path := filepath.Join(dir, order.String()+".go")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+
+		got, err := CountLines(path, Languages[".go"])
+		if err != nil {
+			t.Fatalf("CountLines failed: %v", err)
+		}
+		if got.BlankLines != want.BlankLines || got.CommentLines != want.CommentLines ||
+			got.CodeLines != want.CodeLines || got.TotalLines != want.TotalLines {
+			t.Errorf("%s: got blank %d, comment %d, code %d, total %d; want %d, %d, %d, %d", order,
+				got.BlankLines, got.CommentLines, got.CodeLines, got.TotalLines,
+				want.BlankLines, want.CommentLines, want.CodeLines, want.TotalLines)
+		}
+		if got.Bytes != int64(len(data)) {
+			t.Errorf("%s: Bytes = %d, want the undecoded size %d", order, got.Bytes, len(data))
+		}
+	}
+}
+
+func TestCountLinesInvalidUTF8(t *testing.T) {
+	// A stray Latin-1 byte, a truncated sequence and an overlong encoding,
+	// in comments, strings and code
+	content := "// caf\xe9\npackage main\n\n/* \xc3\n*/\nvar s = \"\xed\xa0\x80 // not a comment\"\nvar t = 1 // \xc0\xaf\n\xff\n"
+
+	path := filepath.Join(t.TempDir(), "invalid.go")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	stats, err := CountLines(path, Languages[".go"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+	if stats.BlankLines != 1 || stats.CommentLines != 3 || stats.CodeLines != 4 || stats.TotalLines != 8 {
+		t.Errorf("got blank %d, comment %d, code %d, total %d; want 1, 3, 4, 8",
+			stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines)
+	}
+	if stats.Bytes != int64(len(content)) {
+		t.Errorf("Bytes = %d, want the unsanitized size %d", stats.Bytes, len(content))
+	}
+
+	if got := validUTF8([]byte("a\xffb")); string(got) != "a�b" {
+		t.Errorf("validUTF8() = %q, want %q", got, "a�b")
+	}
+	if line := []byte("déjà vu"); &validUTF8(line)[0] != &line[0] {
+		t.Error("validUTF8() should return valid lines unchanged")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Report holds the results an output format renders
+type Report struct {
+	Config    *Config
+	Result    *ScanResult
+	LangStats map[string]*LanguageStats // rows after aliases and groups
+	Total     *LanguageStats
+	JSON      *JSONReport // built up front for --strict-json, or nil
+}
+
+// Renderer writes a report in one output format
+type Renderer func(w io.Writer, r *Report) error
+
+// DefaultFormat is the output format used when none is given
+const DefaultFormat = "default"
+
+// formats maps the names accepted by --format to their renderers
+var formats = make(map[string]Renderer)
+
+// RegisterFormat makes render available to --format under name, replacing
+// any renderer registered under the same name
+func RegisterFormat(name string, render Renderer) {
+	formats[name] = render
+}
+
+// FormatNames returns the names of the registered formats, sorted
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupFormat returns the renderer registered under name. An empty name
+// selects DefaultFormat.
+func LookupFormat(name string) (Renderer, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+	render, ok := formats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown output format %q, expected one of: %s", name, strings.Join(FormatNames(), ", "))
+	}
+	return render, nil
+}
+
+func init() {
+	RegisterFormat("json", func(w io.Writer, r *Report) error {
+		report := r.JSON
+		if report == nil {
+			report = NewJSONReport(r.LangStats, r.Total, r.Config.jsonColumns())
+		}
+		PrintJSONReport(w, report)
+		return nil
+	})
+	RegisterFormat("tree-json", func(w io.Writer, r *Report) error {
+		PrintTreeJSON(w, r.Config.Path, r.Result.FileStats)
+		return nil
+	})
+	RegisterFormat("ndjson", func(w io.Writer, r *Report) error {
+		PrintNDJSON(w, r.Result.FileStats, r.Config.RelativeTo)
+		return nil
+	})
+	RegisterFormat("prometheus", func(w io.Writer, r *Report) error {
+		PrintPrometheus(w, r.LangStats, r.Total)
+		return nil
+	})
+	RegisterFormat("csv", func(w io.Writer, r *Report) error {
+		return PrintCSV(w, r.LangStats, r.Config.csvColumnNames(), r.Config.Sort, ',')
+	})
+	RegisterFormat("tsv", func(w io.Writer, r *Report) error {
+		return PrintCSV(w, r.LangStats, r.Config.csvColumnNames(), r.Config.Sort, '\t')
+	})
+	RegisterFormat("compact", func(w io.Writer, r *Report) error {
+		if r.Config.CodeOnly {
+			PrintCompactCodeOnly(w, r.Total)
+		} else {
+			PrintCompact(w, r.Total)
+		}
+		return nil
+	})
+	RegisterFormat("lines", func(w io.Writer, r *Report) error {
+		PrintLines(w, r.LangStats, r.Total)
+		return nil
+	})
+	RegisterFormat("formatted", func(w io.Writer, r *Report) error {
+		if r.Config.customTable() {
+			PrintTable(w, r.LangStats, r.Total, r.Config.tableOptions(true), r.Result.ProcessedFiles, r.Result.SkippedFiles, r.Result.ErrorCount)
+		} else {
+			PrintResultsFormatted(w, r.LangStats, r.Total, r.Result.ProcessedFiles, r.Result.SkippedFiles, r.Result.ErrorCount)
+		}
+		return nil
+	})
+	RegisterFormat(DefaultFormat, func(w io.Writer, r *Report) error {
+		if r.Config.customTable() {
+			PrintTable(w, r.LangStats, r.Total, r.Config.tableOptions(false), r.Result.ProcessedFiles, r.Result.SkippedFiles, r.Result.ErrorCount)
+		} else {
+			PrintResults(w, r.LangStats, r.Total, r.Result.ProcessedFiles, r.Result.SkippedFiles, r.Result.ErrorCount)
+		}
+		return nil
+	})
+}
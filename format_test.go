@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("test-lines", func(w io.Writer, r *Report) error {
+		for _, lang := range sortLanguages(r.LangStats, SortByName) {
+			fmt.Fprintf(w, "%s=%d\n", lang, r.LangStats[lang].CodeLines)
+		}
+		_, err := fmt.Fprintf(w, "total=%d\n", r.Total.CodeLines)
+		return err
+	})
+	t.Cleanup(func() { delete(formats, "test-lines") })
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "run.py"), []byte("x = 1\n"), 0644)
+
+	config := &Config{Path: dir, OutputFormat: "test-lines", Quiet: true}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if want := "Go=2\nPython=1\ntotal=3\n"; output != want {
+		t.Errorf("Run() with a registered format printed %q, want %q", output, want)
+	}
+
+	var sb strings.Builder
+	render, err := LookupFormat("test-lines")
+	if err != nil {
+		t.Fatalf("LookupFormat() error = %v", err)
+	}
+	report := &Report{Config: config, LangStats: map[string]*LanguageStats{"Go": {Language: "Go", CodeLines: 7}}, Total: &LanguageStats{CodeLines: 7}}
+	if err := render(&sb, report); err != nil || sb.String() != "Go=7\ntotal=7\n" {
+		t.Errorf("Rendering into a writer = %q, %v; want %q", sb.String(), err, "Go=7\ntotal=7\n")
+	}
+}
+
+func TestLookupFormat(t *testing.T) {
+	if _, err := LookupFormat(""); err != nil {
+		t.Errorf("LookupFormat(\"\") error = %v, want the default format", err)
+	}
+
+	_, err := LookupFormat("xml")
+	if err == nil || !strings.Contains(err.Error(), `unknown output format "xml"`) || !strings.Contains(err.Error(), "json, lines, ndjson") {
+		t.Errorf("LookupFormat(xml) error = %v, want one listing the available formats", err)
+	}
+	if err := Run(&Config{Path: t.TempDir(), OutputFormat: "xml", Quiet: true}); err == nil {
+		t.Error("Run should reject an unknown output format")
+	}
+}
+
+func TestBuiltinFormatsRenderIntoWriter(t *testing.T) {
+	langStats := map[string]*LanguageStats{"Go": {Language: "Go", FileCount: 1, CodeLines: 4, TotalLines: 5}}
+	fileStats := []*FileStats{{FilePath: "main.go", Language: "Go", CodeLines: 4, TotalLines: 5}}
+	report := &Report{
+		Config:    &Config{},
+		Result:    &ScanResult{ProcessedFiles: 1, FileStats: fileStats},
+		LangStats: langStats,
+		Total:     TotalStats(langStats),
+	}
+	for _, name := range FormatNames() {
+		render, err := LookupFormat(name)
+		if err != nil {
+			t.Fatalf("LookupFormat(%s) error = %v", name, err)
+		}
+		var sb strings.Builder
+		stdout := captureStdout(func() {
+			if err := render(&sb, report); err != nil {
+				t.Errorf("%s: render error = %v", name, err)
+			}
+		})
+		if stdout != "" {
+			t.Errorf("%s: rendering into a writer printed to stdout:\n%s", name, stdout)
+		}
+		if !strings.Contains(sb.String(), "Go") && !strings.Contains(sb.String(), "Code: 4") && !strings.Contains(sb.String(), "main.go") {
+			t.Errorf("%s: expected the Go counts in the rendered output:\n%s", name, sb.String())
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// hasGlobMeta reports whether pattern holds any of the glob metacharacters
+// * ? or [
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// isGlobInput reports whether the path to count is a glob pattern rather
+// than a file or directory: it holds glob metacharacters and nothing exists
+// under that literal name
+func isGlobInput(p string) bool {
+	if !hasGlobMeta(p) {
+		return false
+	}
+	_, err := os.Stat(p)
+	return err != nil
+}
+
+// matchGlob reports whether the slash-separated segments of name match those
+// of pattern. A "**" segment matches any number of segments, including none;
+// other segments match one segment each, as for path.Match.
+func matchGlob(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := range len(name) + 1 {
+				if matchGlob(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// ExpandGlob returns the files matching pattern, such as "src/**/*.go", in
+// lexical order. The leading segments without metacharacters name the
+// directory that is searched; "**" matches any number of directories below
+// it. It fails if the pattern is malformed or matches no files.
+func ExpandGlob(pattern string) ([]string, error) {
+	slashed := filepath.ToSlash(pattern)
+	segments := strings.Split(slashed, "/")
+	static := slices.IndexFunc(segments, hasGlobMeta)
+	if static < 0 {
+		static = len(segments)
+	}
+	rest := segments[static:]
+	for _, segment := range rest {
+		if _, err := path.Match(segment, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", pattern, err)
+		}
+	}
+
+	root := filepath.FromSlash(strings.Join(segments[:static], "/"))
+	if root == "" {
+		root = "."
+		if strings.HasPrefix(slashed, "/") {
+			root = string(filepath.Separator)
+		}
+	}
+	// Without "**", files can be no deeper than the pattern
+	maxDepth := len(rest)
+	if slices.Contains(rest, "**") {
+		maxDepth = -1
+	}
+
+	var matches []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			LogDirectoryError(p, err)
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return nil
+		}
+		name := strings.Split(filepath.ToSlash(rel), "/")
+		if d.IsDir() {
+			if maxDepth >= 0 && len(name) >= maxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchGlob(rest, name) {
+			matches = append(matches, p)
+		}
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %q", pattern)
+	}
+	LogDebug("Glob %s matched %d files", pattern, len(matches))
+	return matches, nil
+}
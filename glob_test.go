@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "pkg/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c/main.go", true},
+		{"src/**", "src/a/b.txt", true},
+		{"src/**/test/*.py", "src/test/x.py", true},
+		{"src/**/test/*.py", "src/a/b/test/x.py", true},
+		{"src/**/test/*.py", "src/a/test/b/x.py", false},
+		{"src/?.go", "src/ab.go", false},
+		{"src/[ab].go", "src/b.go", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(strings.Split(tt.pattern, "/"), strings.Split(tt.name, "/")); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %t, want %t", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRunGlob(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"src/main.go":         "package main\n\nfunc main() {}\n",
+		"src/pkg/util.go":     "package pkg\n",
+		"src/pkg/deep/sub.go": "package deep\n",
+		"src/pkg/script.py":   "x = 1\n",
+		"other/skip.go":       "package other\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+
+	pattern := filepath.Join(tmpDir, "src", "**", "*.go")
+	paths, err := ExpandGlob(pattern)
+	if err != nil {
+		t.Fatalf("ExpandGlob() error = %v", err)
+	}
+	want := []string{
+		filepath.Join(tmpDir, "src", "main.go"),
+		filepath.Join(tmpDir, "src", "pkg", "deep", "sub.go"),
+		filepath.Join(tmpDir, "src", "pkg", "util.go"),
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("ExpandGlob(%s) = %v, want %v", pattern, paths, want)
+	}
+
+	output := captureStdout(func() {
+		if err := Run(&Config{Path: pattern, OutputFormat: "default", Quiet: true}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "Go", "3", "1", "0", "4", "5") || strings.Contains(output, "Python") {
+		t.Errorf("Expected only the Go files under src to be counted:\n%s", output)
+	}
+
+	// Without "**", only files at the pattern's depth match
+	if paths, err := ExpandGlob(filepath.Join(tmpDir, "src", "*", "*.go")); err != nil || len(paths) != 1 {
+		t.Errorf("ExpandGlob(src/*/*.go) = %v, %v; want just src/pkg/util.go", paths, err)
+	}
+
+	err = Run(&Config{Path: filepath.Join(tmpDir, "src", "**", "*.rs"), Quiet: true})
+	if err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("Run() error = %v, want a no-match error", err)
+	}
+}
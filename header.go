@@ -0,0 +1,50 @@
+package main
+
+import "bytes"
+
+// headerSkipper drops the header lines of a file selected by
+// CountOptions.IgnoreHeader and CountOptions.IgnoreHeaderUntil
+type headerSkipper struct {
+	remaining int // lines still to skip by count
+	opts      CountOptions
+	held      [][]byte // lines held back while looking for the end of the header
+	done      bool
+}
+
+func newHeaderSkipper(opts CountOptions) *headerSkipper {
+	return &headerSkipper{
+		remaining: opts.IgnoreHeader,
+		opts:      opts,
+		done:      opts.IgnoreHeader <= 0 && opts.IgnoreHeaderUntil == nil,
+	}
+}
+
+// skip reports whether line, the next line of the file, is part of the
+// header
+func (h *headerSkipper) skip(line []byte) bool {
+	if h.done {
+		return false
+	}
+	if h.remaining > 0 {
+		h.remaining--
+		h.done = h.remaining == 0 && h.opts.IgnoreHeaderUntil == nil
+		return true
+	}
+	if h.opts.IgnoreHeaderUntil.Match(line) {
+		h.held = nil
+		h.done = true
+		return false
+	}
+	// line is only valid until the next scan, so keep a copy
+	h.held = append(h.held, bytes.Clone(line))
+	return true
+}
+
+// unmatched returns the lines held back looking for a line matching
+// IgnoreHeaderUntil if none was found. They are not part of a header.
+func (h *headerSkipper) unmatched() [][]byte {
+	if h.done {
+		return nil
+	}
+	return h.held
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// JSONStats is the JSON representation of a row of statistics. Optional
+// fields are nil unless selected by JSONColumns.
+type JSONStats struct {
+	Files        JSONFiles `json:"files"`
+	Blank        *int      `json:"blank,omitempty"`
+	Comment      *int      `json:"comment,omitempty"`
+	LineComment  *int      `json:"line_comment,omitempty"`
+	BlockComment *int      `json:"block_comment,omitempty"`
+	Code         int       `json:"code"`
+	Total        int       `json:"total"`
+	Bytes        int64     `json:"bytes"`
+	Functions    *int      `json:"functions,omitempty"`
+}
+
+// JSONFiles is the "files" field of JSON statistics: the number of files,
+// or, once List is set by --detailed, an object holding that number as
+// "count" and the files themselves as "list"
+type JSONFiles struct {
+	Count int
+	List  []JSONFile
+}
+
+// jsonFileList is the detailed form of JSONFiles
+type jsonFileList struct {
+	Count int        `json:"count"`
+	List  []JSONFile `json:"list"`
+}
+
+// MarshalJSON implements json.Marshaler
+func (f JSONFiles) MarshalJSON() ([]byte, error) {
+	if f.List == nil {
+		return json.Marshal(f.Count)
+	}
+	return json.Marshal(jsonFileList(f))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting both forms
+func (f *JSONFiles) UnmarshalJSON(data []byte) error {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		f.List = nil
+		return json.Unmarshal(data, &f.Count)
+	}
+	var detailed jsonFileList
+	if err := json.Unmarshal(data, &detailed); err != nil {
+		return err
+	}
+	*f = JSONFiles(detailed)
+	return nil
+}
+
+// JSONColumns selects the optional fields of JSON statistics
+type JSONColumns struct {
+	NoBlank       bool // omit the blank line count
+	NoComment     bool // omit the comment line count
+	SplitComments bool // add the line and block comment counts
+	Functions     bool // add the number of functions
+}
+
+// NewJSONStats converts language statistics into their JSON form
+func NewJSONStats(ls *LanguageStats, cols JSONColumns) JSONStats {
+	stats := JSONStats{
+		Files: JSONFiles{Count: ls.FileCount},
+		Code:  ls.CodeLines,
+		Total: ls.TotalLines,
+		Bytes: ls.Bytes,
+	}
+	if !cols.NoBlank {
+		blank := ls.BlankLines
+		stats.Blank = &blank
+	}
+	if !cols.NoComment {
+		comment := ls.CommentLines
+		stats.Comment = &comment
+	}
+	if cols.SplitComments {
+		lineComment, blockComment := ls.LineCommentLines, ls.BlockCommentLines
+		stats.LineComment = &lineComment
+		stats.BlockComment = &blockComment
+	}
+	if cols.Functions {
+		functions := ls.Functions
+		stats.Functions = &functions
+	}
+	return stats
+}
+
+// JSONLanguages marshals to a JSON object keyed by language name. Keys are
+// written in slice order, unlike a Go map which would be sorted by name.
+type JSONLanguages struct {
+	Stats   []*LanguageStats
+	Columns JSONColumns
+	Files   map[string][]JSONFile // per-file entries by language, if added
+}
+
+// MarshalJSON implements json.Marshaler
+func (langs JSONLanguages) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, ls := range langs.Stats {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(ls.Language)
+		if err != nil {
+			return nil, err
+		}
+		stats := NewJSONStats(ls, langs.Columns)
+		if langs.Files != nil {
+			stats.Files.List = langs.Files[ls.Language]
+			if stats.Files.List == nil {
+				stats.Files.List = []JSONFile{}
+			}
+		}
+		value, err := json.Marshal(stats)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// JSONReport is the document printed by the json output format
+type JSONReport struct {
+	Project   string        `json:"project,omitempty"`
+	Languages JSONLanguages `json:"languages"`
+	Total     JSONStats     `json:"total"`
+	Errors    []JSONError   `json:"errors,omitzero"`
+
+	// ErrorsOmitted is the number of errors beyond --max-errors, which are
+	// not listed in Errors
+	ErrorsOmitted int `json:"errors_omitted,omitempty"`
+}
+
+// JSONError is the structured form of an error embedded in JSON output
+type JSONError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// NewJSONError converts an error into its structured JSON form, extracting
+// the path from FileError, DirectoryError and PermissionError values
+func NewJSONError(err error) JSONError {
+	var fileErr *FileError
+	var dirErr *DirectoryError
+	var permErr *PermissionError
+
+	switch {
+	case errors.As(err, &fileErr):
+		return JSONError{Path: fileErr.FilePath, Message: fileErr.Err.Error()}
+	case errors.As(err, &dirErr):
+		return JSONError{Path: dirErr.DirPath, Message: dirErr.Err.Error()}
+	case errors.As(err, &permErr):
+		return JSONError{Path: permErr.Path, Message: permErr.Err.Error()}
+	default:
+		return JSONError{Message: err.Error()}
+	}
+}
+
+// NewJSONReport builds the JSON document for the given results, with
+// languages ordered by code lines (descending)
+func NewJSONReport(langStats map[string]*LanguageStats, total *LanguageStats, cols JSONColumns) *JSONReport {
+	sortedLangs := sortLanguagesByCode(langStats)
+	langs := JSONLanguages{
+		Stats:   make([]*LanguageStats, 0, len(sortedLangs)),
+		Columns: cols,
+	}
+	for _, lang := range sortedLangs {
+		langs.Stats = append(langs.Stats, langStats[lang])
+	}
+
+	return &JSONReport{
+		Languages: langs,
+		Total:     NewJSONStats(total, cols),
+	}
+}
+
+// AddErrors appends the collected errors to the report under an "errors"
+// array. count is the number of errors encountered; any not collected are
+// reported as "errors_omitted".
+func (r *JSONReport) AddErrors(errs []error, count int) {
+	r.Errors = make([]JSONError, 0, len(errs))
+	for _, err := range errs {
+		r.Errors = append(r.Errors, NewJSONError(err))
+	}
+	r.ErrorsOmitted = max(count-len(errs), 0)
+}
+
+// AddFiles nests the per-file entries, sorted by path, under the "files" of
+// each language, which becomes {"count": N, "list": [...]}. rowLanguage maps the language of a file to the row it was
+// aggregated into, see RowLanguage. Paths are reported relative to
+// relativeTo when it is set.
+func (r *JSONReport) AddFiles(fileStats []*FileStats, rowLanguage func(string) string, relativeTo string) {
+	files, paths := sortFilesByPath(fileStats, relativeTo)
+	r.Languages.Files = make(map[string][]JSONFile)
+	for i, fs := range files {
+		row := rowLanguage(fs.Language)
+		r.Languages.Files[row] = append(r.Languages.Files[row], newJSONFile(fs, paths[i]))
+	}
+}
+
+// PrintJSON prints results in JSON format
+func PrintJSON(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, cols JSONColumns) {
+	PrintJSONReport(w, NewJSONReport(langStats, total, cols))
+}
+
+// PrintJSONWithErrors prints results in JSON format with the collected
+// errors appended under an "errors" array
+func PrintJSONWithErrors(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, errs []error, cols JSONColumns) {
+	report := NewJSONReport(langStats, total, cols)
+	report.AddErrors(errs, len(errs))
+	PrintJSONReport(w, report)
+}
+
+// PrintJSONReport prints a report built by NewJSONReport
+func PrintJSONReport(w io.Writer, report *JSONReport) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		LogError("Failed to encode JSON: %v", err)
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
+
+// JSONFile is the JSON representation of a single file's statistics
+type JSONFile struct {
+	Path     string `json:"path"`
+	Language string `json:"language"`
+	Blank    int    `json:"blank"`
+	Comment  int    `json:"comment"`
+	Code     int    `json:"code"`
+	Total    int    `json:"total"`
+}
+
+// newJSONFile converts file statistics into their JSON form, reported under
+// path
+func newJSONFile(fs *FileStats, path string) JSONFile {
+	return JSONFile{
+		Path:     path,
+		Language: fs.Language,
+		Blank:    fs.BlankLines,
+		Comment:  fs.CommentLines,
+		Code:     fs.CodeLines,
+		Total:    fs.TotalLines,
+	}
+}
+
+// PrintNDJSON prints one compact JSON object per file, sorted by path, with
+// paths reported relative to relativeTo when it is set
+func PrintNDJSON(w io.Writer, fileStats []*FileStats, relativeTo string) {
+	files, paths := sortFilesByPath(fileStats, relativeTo)
+	for i, fs := range files {
+		data, err := json.Marshal(newJSONFile(fs, paths[i]))
+		if err != nil {
+			LogError("Failed to encode JSON: %v", err)
+			return
+		}
+		fmt.Fprintln(w, string(data))
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrintJSONWithErrors(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go": {Language: "Go", FileCount: 1, BlankLines: 1, CommentLines: 1, CodeLines: 8, TotalLines: 10},
+	}
+	total := TotalStats(langStats)
+	errs := []error{
+		NewFileError("src/broken.go", errors.New("read failed")),
+		NewDirectoryError("src/private", errors.New("permission denied")),
+		errors.New("walk aborted"),
+	}
+
+	output := captureStdout(func() {
+		PrintJSONWithErrors(os.Stdout, langStats, total, errs, JSONColumns{})
+	})
+
+	var report struct {
+		Languages map[string]map[string]int `json:"languages"`
+		Errors    []JSONError               `json:"errors"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+	}
+
+	want := []JSONError{
+		{Path: "src/broken.go", Message: "read failed"},
+		{Path: "src/private", Message: "permission denied"},
+		{Path: "", Message: "walk aborted"},
+	}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", report.Errors, want)
+	}
+	if report.Languages["Go"]["code"] != 8 {
+		t.Errorf("Go code = %d, want 8", report.Languages["Go"]["code"])
+	}
+
+	// Without the flag there is no errors key at all
+	output = captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{})
+	})
+	if strings.Contains(output, "\"errors\"") {
+		t.Errorf("PrintJSON output should not contain errors: %s", output)
+	}
+}
+
+func TestPrintJSONOrder(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 1, CodeLines: 10, TotalLines: 10},
+		"Python": {Language: "Python", FileCount: 1, CodeLines: 100, TotalLines: 100},
+		"C":      {Language: "C", FileCount: 1, CodeLines: 50, TotalLines: 50},
+		"Alpha":  {Language: "Alpha", FileCount: 1, CodeLines: 50, TotalLines: 50},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{})
+	})
+
+	// Code lines descending, ties broken by name
+	order := []string{"\"Python\"", "\"Alpha\"", "\"C\"", "\"Go\""}
+	sorted := sortLanguagesByCode(langStats)
+	for i, lang := range sorted {
+		if order[i] != "\""+lang+"\"" {
+			t.Fatalf("sortLanguagesByCode = %v, want order %v", sorted, order)
+		}
+	}
+
+	last := -1
+	for _, key := range order {
+		idx := strings.Index(output, key)
+		if idx < 0 {
+			t.Fatalf("Output missing %s: %s", key, output)
+		}
+		if idx < last {
+			t.Errorf("%s appears out of order in JSON output:\n%s", key, output)
+		}
+		last = idx
+	}
+
+	if !json.Valid([]byte(output)) {
+		t.Errorf("Output is not valid JSON: %s", output)
+	}
+}
+
+func TestPrintJSONEscapesNames(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Say \"hi\"": {Language: "Say \"hi\"", FileCount: 1, CodeLines: 1, TotalLines: 1},
+	}
+	output := captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, TotalStats(langStats), JSONColumns{})
+	})
+
+	var report struct {
+		Languages map[string]JSONStats `json:"languages"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+	}
+	if report.Languages["Say \"hi\""].Code != 1 {
+		t.Errorf("Escaped language name not round-tripped: %s", output)
+	}
+}
+
+func TestPrintNDJSON(t *testing.T) {
+	fileStats := []*FileStats{
+		{FilePath: "src/b.py", Language: "Python", BlankLines: 1, CodeLines: 2, TotalLines: 3},
+		nil,
+		{FilePath: "src/a.go", Language: "Go", CommentLines: 1, CodeLines: 4, TotalLines: 5},
+	}
+
+	output := captureStdout(func() {
+		PrintNDJSON(os.Stdout, fileStats, "")
+	})
+
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d:\n%s", len(lines), output)
+	}
+
+	want := []JSONFile{
+		{Path: "src/a.go", Language: "Go", Comment: 1, Code: 4, Total: 5},
+		{Path: "src/b.py", Language: "Python", Blank: 1, Code: 2, Total: 3},
+	}
+	for i, line := range lines {
+		var got JSONFile
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("Line %d is not a JSON object: %v\n%s", i+1, err, line)
+		}
+		if got != want[i] {
+			t.Errorf("Line %d = %+v, want %+v", i+1, got, want[i])
+		}
+	}
+}
+
+func TestRunJSONDetailed(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "b.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "a.go"), []byte("// Package main\npackage main\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "run.py"), []byte("x = 1\n"), 0644)
+
+	config := &Config{
+		Path:         tmpDir,
+		OutputFormat: "json",
+		Quiet:        true,
+		Detailed:     true,
+		RelativeTo:   tmpDir,
+		Groups:       map[string]string{"Python": "Scripts"},
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	var report struct {
+		Languages map[string]struct {
+			Code  int `json:"code"`
+			Files struct {
+				Count int        `json:"count"`
+				List  []JSONFile `json:"list"`
+			} `json:"files"`
+		} `json:"languages"`
+		Total map[string]any `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+	}
+
+	wantGo := []JSONFile{
+		{Path: "a.go", Language: "Go", Comment: 1, Code: 1, Total: 2},
+		{Path: "b.go", Language: "Go", Blank: 1, Code: 2, Total: 3},
+	}
+	if got := report.Languages["Go"].Files; got.Count != 2 || !reflect.DeepEqual(got.List, wantGo) {
+		t.Errorf("Go files = %+v, want 2 files %+v", got, wantGo)
+	}
+	wantScripts := []JSONFile{{Path: "run.py", Language: "Python", Code: 1, Total: 1}}
+	if got := report.Languages["Scripts"].Files.List; !reflect.DeepEqual(got, wantScripts) {
+		t.Errorf("Grouped files = %+v, want %+v", got, wantScripts)
+	}
+	if _, ok := report.Total["files"].(float64); !ok {
+		t.Errorf("The total should keep the plain file count:\n%s", output)
+	}
+
+	config.Detailed = false
+	output = captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if strings.Contains(output, `"path"`) || strings.Contains(output, "[") {
+		t.Errorf("Without --detailed the output should keep the compact shape:\n%s", output)
+	}
+}
+
+func TestRunJSONTimingOnStderr(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+
+	var logs strings.Builder
+	SetLogLevel(LogLevelInfo)
+	SetLogOutput(&logs)
+	defer func() {
+		SetLogOutput(os.Stderr)
+		SetLogLevel(LogLevelInfo)
+	}()
+
+	output := captureStdout(func() {
+		if err := Run(&Config{Path: tmpDir, OutputFormat: "json"}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !json.Valid([]byte(output)) {
+		t.Errorf("Output without -q is not valid JSON:\n%s", output)
+	}
+	if !strings.Contains(logs.String(), "Time elapsed: ") {
+		t.Errorf("Expected the timing line in the log, got %q", logs.String())
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// userLanguagesFile is the languages file looked up under the user
+// configuration directory
+const userLanguagesFile = "countloc/languages.json"
+
+// languageDefinition is a language as written in a languages file
+type languageDefinition struct {
+	Name              string   `json:"name"`
+	LineComment       string   `json:"line_comment"`
+	ExtraLineComments []string `json:"extra_line_comments"`
+	BlockStart        string   `json:"block_start"`
+	BlockEnd          string   `json:"block_end"`
+	Strings           []string `json:"strings"`
+	NestedComments    bool     `json:"nested_comments"`
+	IgnoreLines       []string `json:"ignore_lines"`
+}
+
+// languagesDocument is the format of a languages file: definitions keyed by
+// extension, including the leading dot, and by exact file name, further
+// CanonicalNames entries, and ignore_lines patterns added to the languages
+// of the given names
+type languagesDocument struct {
+	Extensions     map[string]languageDefinition `json:"extensions"`
+	Filenames      map[string]languageDefinition `json:"filenames"`
+	CanonicalNames map[string]string             `json:"canonical_names"`
+	IgnoreLines    map[string][]string           `json:"ignore_lines"`
+}
+
+// NoLanguagesFile is the --languages-file value that loads no languages
+// file, not even the user's
+const NoLanguagesFile = "none"
+
+// languagesFilePath returns the languages file to load for the value of
+// --languages-file: the user languages file if it is empty, none for
+// NoLanguagesFile, or the file given
+func languagesFilePath(flagValue string) string {
+	switch flagValue {
+	case "":
+		return UserLanguagesPath()
+	case NoLanguagesFile:
+		return ""
+	}
+	return flagValue
+}
+
+// UserLanguagesPath returns the path of countloc/languages.json under
+// $XDG_CONFIG_HOME, or under the user configuration directory if it is
+// unset, or "" if there is no such file
+func UserLanguagesPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserConfigDir(); err != nil {
+			return ""
+		}
+	}
+	path := filepath.Join(dir, filepath.FromSlash(userLanguagesFile))
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// language converts the definition into the rules used for counting
+func (d languageDefinition) language(ext string) (*Language, error) {
+	if d.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	if (d.BlockStart == "") != (d.BlockEnd == "") {
+		return nil, errors.New("block_start and block_end must be set together")
+	}
+	lang := &Language{
+		Name:              d.Name,
+		Extensions:        []string{},
+		SingleLineComment: d.LineComment,
+		ExtraLineComments: d.ExtraLineComments,
+		MultiLineStart:    d.BlockStart,
+		MultiLineEnd:      d.BlockEnd,
+		StringDelimiters:  d.Strings,
+		NestedComments:    d.NestedComments,
+	}
+	if ext != "" {
+		lang.Extensions = []string{ext}
+	}
+	var err error
+	if lang.IgnoreLines, err = compileIgnoreLines(d.IgnoreLines); err != nil {
+		return nil, err
+	}
+	return lang, nil
+}
+
+// compileIgnoreLines compiles the ignore_lines patterns of a languages file
+func compileIgnoreLines(patterns []string) ([]*regexp.Regexp, error) {
+	var compiled []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("ignore_lines: %w", err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// knownLanguage reports whether one of tables has a language named name,
+// ignoring case
+func knownLanguage(name string, tables ...map[string]*Language) bool {
+	for _, table := range tables {
+		for _, lang := range table {
+			if strings.EqualFold(lang.Name, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// withIgnoreLines returns a copy of the languages in table named name,
+// ignoring case, with patterns added to their IgnoreLines, keyed as in table. Languages
+// are copied rather than changed, so copies of the tables keep their rules.
+func withIgnoreLines(table map[string]*Language, name string, patterns []*regexp.Regexp) map[string]*Language {
+	changed := make(map[string]*Language)
+	for key, lang := range table {
+		if strings.EqualFold(lang.Name, name) {
+			updated := *lang
+			updated.IgnoreLines = append(slices.Clip(lang.IgnoreLines), patterns...)
+			changed[key] = &updated
+		}
+	}
+	return changed
+}
+
+// LoadLanguagesFile adds the languages defined in the file at path to the
+// built-in tables, replacing any built-in language with the same extension
+// or file name, and adds its canonical names to CanonicalNames. It returns
+// the number of definitions loaded.
+func LoadLanguagesFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var doc languagesDocument
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+
+	extensions := make(map[string]*Language, len(doc.Extensions))
+	for ext, def := range doc.Extensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) == 1 {
+			return 0, fmt.Errorf("%s: extension %q must start with a dot", path, ext)
+		}
+		lang, err := def.language(ext)
+		if err != nil {
+			return 0, fmt.Errorf("%s: extension %s: %w", path, ext, err)
+		}
+		extensions[ext] = lang
+	}
+
+	filenames := make(map[string]*Language, len(doc.Filenames))
+	for name, def := range doc.Filenames {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return 0, fmt.Errorf("%s: invalid file name %q", path, name)
+		}
+		lang, err := def.language("")
+		if err != nil {
+			return 0, fmt.Errorf("%s: file name %s: %w", path, name, err)
+		}
+		filenames[name] = lang
+	}
+
+	for variant, name := range doc.CanonicalNames {
+		if variant == "" || name == "" {
+			return 0, fmt.Errorf("%s: canonical name %q: variant and name must not be empty", path, variant)
+		}
+	}
+
+	ignoreLines := make(map[string][]*regexp.Regexp, len(doc.IgnoreLines))
+	for name, patterns := range doc.IgnoreLines {
+		compiled, err := compileIgnoreLines(patterns)
+		if err != nil {
+			return 0, fmt.Errorf("%s: language %s: %w", path, name, err)
+		}
+		if !knownLanguage(name, Languages, FilenameLanguages, extensions, filenames) {
+			return 0, fmt.Errorf("%s: ignore_lines: unknown language %q", path, name)
+		}
+		ignoreLines[name] = compiled
+	}
+
+	// Only change the tables once the whole file is known to be valid
+	for ext, lang := range extensions {
+		Languages[ext] = lang
+	}
+	for name, lang := range filenames {
+		FilenameLanguages[name] = lang
+	}
+
+	// Ignored lines apply to the built-in and the defined languages alike
+	for name, patterns := range ignoreLines {
+		maps.Copy(Languages, withIgnoreLines(Languages, name, patterns))
+		maps.Copy(FilenameLanguages, withIgnoreLines(FilenameLanguages, name, patterns))
+	}
+	for variant, name := range doc.CanonicalNames {
+		CanonicalNames[strings.ToLower(variant)] = name
+	}
+	return len(extensions) + len(filenames) + len(doc.CanonicalNames) + len(ignoreLines), nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"flag"
+	"maps"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restoreLanguageTables undoes changes made to the language tables by the test
+func restoreLanguageTables(t *testing.T) {
+	languages, filenames, canonical := maps.Clone(Languages), maps.Clone(FilenameLanguages), maps.Clone(CanonicalNames)
+	t.Cleanup(func() {
+		Languages, FilenameLanguages, CanonicalNames = languages, filenames, canonical
+	})
+}
+
+func TestRunUserLanguagesFile(t *testing.T) {
+	restoreLanguageTables(t)
+
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	if got := UserLanguagesPath(); got != "" {
+		t.Fatalf("UserLanguagesPath() = %q without a languages file, want \"\"", got)
+	}
+
+	file := filepath.Join(configHome, "countloc", "languages.json")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	os.WriteFile(file, []byte(`{
+		"extensions": {
+			".tpl": {"name": "Template", "line_comment": "##", "block_start": "{*", "block_end": "*}"},
+			".py": {"name": "Monty", "line_comment": "--"}
+		},
+		"filenames": {"Taskfile": {"name": "Taskfile", "line_comment": "#"}}
+	}`), 0644)
+	if got := UserLanguagesPath(); got != file {
+		t.Fatalf("UserLanguagesPath() = %q, want %q", got, file)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "page.tpl"), []byte("## header\n{* block\n*}\n<p>{$x}</p>\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "run.py"), []byte("-- comment\nx = 1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "Taskfile"), []byte("# task\nbuild: go build\n"), 0644)
+
+	config := &Config{Path: dir, OutputFormat: "default", Quiet: true, LanguagesFile: UserLanguagesPath()}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	for _, want := range []string{"Template", "Monty", "Taskfile"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Output should count %s files:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "Python") {
+		t.Errorf("The languages file should replace the built-in .py rules:\n%s", output)
+	}
+	if lang := Languages[".tpl"]; lang == nil || lang.MultiLineStart != "{*" {
+		t.Errorf("Languages[.tpl] = %+v, want the rules from the languages file", lang)
+	}
+}
+
+func TestLanguagesFileFlag(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	userFile := filepath.Join(configHome, "countloc", "languages.json")
+	os.MkdirAll(filepath.Dir(userFile), 0755)
+	os.WriteFile(userFile, []byte(`{}`), 0644)
+
+	oldArgs := os.Args
+	defer func() { os.Args = oldArgs }()
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"cmd"}, userFile},
+		{[]string{"cmd", "--languages-file", "ci.json"}, "ci.json"},
+		{[]string{"cmd", "--languages-file", "none"}, ""},
+	}
+	for _, tt := range tests {
+		os.Args = tt.args
+		flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+		if got := parseFlags().LanguagesFile; got != tt.want {
+			t.Errorf("parseFlags(%v).LanguagesFile = %q, want %q", tt.args[1:], got, tt.want)
+		}
+	}
+
+	// An explicit file must exist, unlike the user's
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	if err := Run(&Config{Path: t.TempDir(), Quiet: true, LanguagesFile: missing}); err == nil {
+		t.Error("Expected an error for a missing --languages-file")
+	}
+}
+
+func TestLoadLanguagesFileCanonicalNames(t *testing.T) {
+	restoreLanguageTables(t)
+
+	file := filepath.Join(t.TempDir(), "languages.json")
+	os.WriteFile(file, []byte(`{
+		"extensions": {".cc2": {"name": "Cpp", "line_comment": "//"}},
+		"canonical_names": {"Cee Plus Plus": "C++"}
+	}`), 0644)
+	if _, err := LoadLanguagesFile(file); err != nil {
+		t.Fatalf("LoadLanguagesFile() error = %v", err)
+	}
+
+	langStats := AggregateStats([]*FileStats{
+		{FilePath: "a.cc2", Language: Languages[".cc2"].Name, CodeLines: 1, TotalLines: 1},
+		{FilePath: "b.x", Language: "cee plus plus", CodeLines: 2, TotalLines: 2},
+		{FilePath: "c.cpp", Language: "C++", CodeLines: 3, TotalLines: 3},
+	})
+	if len(langStats) != 1 || langStats["C++"] == nil || langStats["C++"].FileCount != 3 {
+		t.Errorf("AggregateStats() = %v, want a single C++ row of 3 files", langStats)
+	}
+}
+
+func TestLoadLanguagesFileInvalid(t *testing.T) {
+	restoreLanguageTables(t)
+
+	tests := map[string]string{
+		"unknown key":       `{"extensions": {".x": {"name": "X", "comment": "#"}}}`,
+		"missing name":      `{"extensions": {".x": {"line_comment": "#"}}}`,
+		"missing dot":       `{"extensions": {"x": {"name": "X"}}}`,
+		"half block":        `{"extensions": {".x": {"name": "X", "block_start": "/*"}}}`,
+		"path in file name": `{"filenames": {"a/b": {"name": "X"}}}`,
+		"empty canonical":   `{"canonical_names": {"x": ""}}`,
+		"not json":          `extensions`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "languages.json")
+			os.WriteFile(file, []byte(content), 0644)
+			if _, err := LoadLanguagesFile(file); err == nil {
+				t.Error("LoadLanguagesFile should reject the file")
+			}
+		})
+	}
+	if _, ok := Languages[".x"]; ok {
+		t.Error("A rejected languages file should not change the language tables")
+	}
+}
+
+func TestLoadLanguagesFileIgnoreLines(t *testing.T) {
+	restoreLanguageTables(t)
+	builtin := Languages[".h"]
+
+	file := filepath.Join(t.TempDir(), "languages.json")
+	os.WriteFile(file, []byte(`{
+		"extensions": {".tpl": {"name": "Template", "line_comment": "##", "ignore_lines": ["^\\s*\\{\\{-?\\s*end\\s*\\}\\}$"]}},
+		"ignore_lines": {"c header": ["^\\s*#pragma once\\s*$"]}
+	}`), 0644)
+	if _, err := LoadLanguagesFile(file); err != nil {
+		t.Fatalf("LoadLanguagesFile() error = %v", err)
+	}
+	if len(builtin.IgnoreLines) != 0 {
+		t.Error("The built-in C Header rules should be left unchanged")
+	}
+
+	content := "#pragma once\n\n// Point is a point\nstruct point { int x; };\n  #pragma once  \n"
+	stats, err := CountReader(strings.NewReader(content), "point.h", Languages[".h"], CountOptions{})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.CodeLines != 1 || stats.CommentLines != 1 || stats.BlankLines != 1 || stats.TotalLines != 5 {
+		t.Errorf("CountReader() = code %d, comment %d, blank %d, total %d; want 1, 1, 1, 5",
+			stats.CodeLines, stats.CommentLines, stats.BlankLines, stats.TotalLines)
+	}
+
+	stats, err = CountReader(strings.NewReader("{{ if .x }}\n<p>x</p>\n{{- end }}\n"), "page.tpl", Languages[".tpl"], CountOptions{})
+	if err != nil {
+		t.Fatalf("CountReader failed: %v", err)
+	}
+	if stats.CodeLines != 2 || stats.TotalLines != 3 {
+		t.Errorf("CountReader() = code %d, total %d; want 2, 3", stats.CodeLines, stats.TotalLines)
+	}
+
+	for _, bad := range []string{
+		`{"ignore_lines": {"NoSuchLanguage": ["x"]}}`,
+		`{"ignore_lines": {"C": ["("]}}`,
+	} {
+		os.WriteFile(file, []byte(bad), 0644)
+		if _, err := LoadLanguagesFile(file); err == nil {
+			t.Errorf("LoadLanguagesFile(%s) succeeded, want an error", bad)
+		}
+	}
+}
@@ -1,14 +1,56 @@
 package main
 
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
 // Language represents a programming language with its comment patterns
 type Language struct {
 	Name              string
 	Extensions        []string
 	SingleLineComment string
+	ExtraLineComments []string // further single-line comment markers, e.g. "#" for PHP
+	NotLineComments   []string // code that starts like a line comment, e.g. "#[" for PHP attributes
 	MultiLineStart    string
 	MultiLineEnd      string
 	StringDelimiters  []string
 	NestedComments    bool
+	RegionMarkers     []string       // line prefixes of editor region markers, e.g. "#region"
+	FunctionPattern   *regexp.Regexp // matches function definitions in a code line, e.g. "func " for Go
+	TestFiles         []string       // base name patterns of test files, e.g. "*_test.go"
+	Notebook          bool           // counted cell by cell, see CountNotebook
+
+	// IgnoreLines match lines, such as "#pragma once", counted in the
+	// total only, as neither code nor comment. They are set by a languages
+	// file, see LoadLanguagesFile.
+	IgnoreLines []*regexp.Regexp
+
+	// FixedForm marks column-sensitive sources such as fixed-form Fortran:
+	// a C, c, * or ! in column 1 starts a comment line, and text past
+	// column 72 is ignored. Tabs are expanded to LineClassifier.TabWidth.
+	FixedForm bool
+}
+
+// LineComments returns every single-line comment marker of the language
+func (l *Language) LineComments() []string {
+	if l.SingleLineComment == "" {
+		return l.ExtraLineComments
+	}
+	return append([]string{l.SingleLineComment}, l.ExtraLineComments...)
+}
+
+// IsTestFile reports whether the file at path is a test file by the naming
+// conventions of the language, matching its base name against TestFiles
+func (l *Language) IsTestFile(path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range l.TestFiles {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // Languages defines all supported programming languages and their comment patterns
@@ -20,6 +62,8 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "`"},
+		FunctionPattern:   regexp.MustCompile(`^\s*func\b`),
+		TestFiles:         []string{"*_test.go"},
 	},
 	".js": {
 		Name:              "JavaScript",
@@ -28,6 +72,8 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'", "`"},
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b|=>`),
+		TestFiles:         []string{"*.test.js", "*.spec.js"},
 	},
 	".ts": {
 		Name:              "TypeScript",
@@ -36,6 +82,8 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'", "`"},
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b|=>`),
+		TestFiles:         []string{"*.test.ts", "*.spec.ts"},
 	},
 	".tsx": {
 		Name:              "TypeScript JSX",
@@ -43,6 +91,8 @@ var Languages = map[string]*Language{
 		SingleLineComment: "//",
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b|=>`),
+		TestFiles:         []string{"*.test.tsx", "*.spec.tsx"},
 	},
 	".jsx": {
 		Name:              "JavaScript JSX",
@@ -50,6 +100,8 @@ var Languages = map[string]*Language{
 		SingleLineComment: "//",
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b|=>`),
+		TestFiles:         []string{"*.test.jsx", "*.spec.jsx"},
 	},
 	".html": {
 		Name:              "HTML",
@@ -72,6 +124,8 @@ var Languages = map[string]*Language{
 		MultiLineStart:    `"""`,
 		MultiLineEnd:      `"""`,
 		StringDelimiters:  []string{"\"", "'"},
+		FunctionPattern:   regexp.MustCompile(`^\s*(async\s+)?def\s`),
+		TestFiles:         []string{"test_*.py", "*_test.py"},
 	},
 	".rb": {
 		Name:              "Ruby",
@@ -80,6 +134,8 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "=begin",
 		MultiLineEnd:      "=end",
 		StringDelimiters:  []string{"\"", "'"},
+		FunctionPattern:   regexp.MustCompile(`^\s*def\s`),
+		TestFiles:         []string{"*_test.rb", "*_spec.rb"},
 	},
 	".java": {
 		Name:              "Java",
@@ -88,6 +144,7 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'"},
+		TestFiles:         []string{"*Test.java", "*Tests.java"},
 	},
 	".c": {
 		Name:              "C",
@@ -121,6 +178,14 @@ var Languages = map[string]*Language{
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'"},
 	},
+	".cxx": {
+		Name:              "C++",
+		Extensions:        []string{".cpp", ".cc", ".cxx"},
+		SingleLineComment: "//",
+		MultiLineStart:    "/*",
+		MultiLineEnd:      "*/",
+		StringDelimiters:  []string{"\"", "'"},
+	},
 	".hpp": {
 		Name:              "C++ Header",
 		Extensions:        []string{".hpp"},
@@ -136,14 +201,18 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'"},
+		RegionMarkers:     []string{"#region", "#endregion"},
 	},
 	".php": {
 		Name:              "PHP",
 		Extensions:        []string{".php"},
 		SingleLineComment: "//",
+		ExtraLineComments: []string{"#"},
+		NotLineComments:   []string{"#["},
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'"},
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b`),
 	},
 	".swift": {
 		Name:              "Swift",
@@ -153,6 +222,8 @@ var Languages = map[string]*Language{
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\""},
 		NestedComments:    true,
+		RegionMarkers:     []string{"// MARK:"},
+		FunctionPattern:   regexp.MustCompile(`\bfunc\s`),
 	},
 	".kt": {
 		Name:              "Kotlin",
@@ -162,6 +233,7 @@ var Languages = map[string]*Language{
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\""},
 		NestedComments:    true,
+		FunctionPattern:   regexp.MustCompile(`\bfun\s`),
 	},
 	".rs": {
 		Name:              "Rust",
@@ -171,6 +243,17 @@ var Languages = map[string]*Language{
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\""},
 		NestedComments:    true,
+		FunctionPattern:   regexp.MustCompile(`\bfn\s+\w`),
+	},
+	// D: only the /* */ block comment is recognized, and it does not nest.
+	// The nesting /+ +/ form is counted as code.
+	".d": {
+		Name:              "D",
+		Extensions:        []string{".d"},
+		SingleLineComment: "//",
+		MultiLineStart:    "/*",
+		MultiLineEnd:      "*/",
+		StringDelimiters:  []string{"\"", "`"},
 	},
 	".scala": {
 		Name:              "Scala",
@@ -179,6 +262,7 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 		StringDelimiters:  []string{"\"", "'"},
+		NestedComments:    true,
 	},
 	".json": {
 		Name:              "JSON",
@@ -187,6 +271,10 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "",
 		MultiLineEnd:      "",
 	},
+	// YAML: lines starting with "#" after any indentation are comments; the
+	// "---" and "..." document markers have no comment marker and count as
+	// code. Quotes are not treated as strings because plain scalars such as
+	// "title: don't" contain unbalanced apostrophes.
 	".yaml": {
 		Name:              "YAML",
 		Extensions:        []string{".yaml", ".yml"},
@@ -240,6 +328,7 @@ var Languages = map[string]*Language{
 		Name:              "SQL",
 		Extensions:        []string{".sql"},
 		SingleLineComment: "--",
+		ExtraLineComments: []string{"#"},
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 	},
@@ -249,6 +338,7 @@ var Languages = map[string]*Language{
 		SingleLineComment: "#",
 		MultiLineStart:    "",
 		MultiLineEnd:      "",
+		FunctionPattern:   regexp.MustCompile(`^\s*(function\s+[\w.:-]+|[\w.:-]+\s*\(\s*\))`),
 	},
 	".bash": {
 		Name:              "Shell",
@@ -256,6 +346,7 @@ var Languages = map[string]*Language{
 		SingleLineComment: "#",
 		MultiLineStart:    "",
 		MultiLineEnd:      "",
+		FunctionPattern:   regexp.MustCompile(`^\s*(function\s+[\w.:-]+|[\w.:-]+\s*\(\s*\))`),
 	},
 	".xml": {
 		Name:              "XML",
@@ -284,6 +375,7 @@ var Languages = map[string]*Language{
 		SingleLineComment: "--",
 		MultiLineStart:    "--[[",
 		MultiLineEnd:      "]]",
+		FunctionPattern:   regexp.MustCompile(`\bfunction\b`),
 	},
 	".r": {
 		Name:              "R",
@@ -340,6 +432,7 @@ var Languages = map[string]*Language{
 		SingleLineComment: "--",
 		MultiLineStart:    "{-",
 		MultiLineEnd:      "-}",
+		NestedComments:    true,
 	},
 	".clj": {
 		Name:              "Clojure",
@@ -404,6 +497,11 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "",
 		MultiLineEnd:      "",
 	},
+	".ipynb": {
+		Name:       "Jupyter Notebook",
+		Extensions: []string{".ipynb"},
+		Notebook:   true,
+	},
 	".txt": {
 		Name:              "Text",
 		Extensions:        []string{".txt"},
@@ -460,6 +558,51 @@ var Languages = map[string]*Language{
 		MultiLineStart:    "/*",
 		MultiLineEnd:      "*/",
 	},
+	".f": {
+		Name:              "Fortran Legacy",
+		Extensions:        []string{".f", ".for", ".f77"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+		FixedForm:         true,
+	},
+	".for": {
+		Name:              "Fortran Legacy",
+		Extensions:        []string{".f", ".for", ".f77"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+		FixedForm:         true,
+	},
+	".f77": {
+		Name:              "Fortran Legacy",
+		Extensions:        []string{".f", ".for", ".f77"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+		FixedForm:         true,
+	},
+	".f90": {
+		Name:              "Fortran Modern",
+		Extensions:        []string{".f90", ".f95", ".f03", ".f08"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+	},
+	".f95": {
+		Name:              "Fortran Modern",
+		Extensions:        []string{".f90", ".f95", ".f03", ".f08"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+	},
+	".f03": {
+		Name:              "Fortran Modern",
+		Extensions:        []string{".f90", ".f95", ".f03", ".f08"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+	},
+	".f08": {
+		Name:              "Fortran Modern",
+		Extensions:        []string{".f90", ".f95", ".f03", ".f08"},
+		SingleLineComment: "!",
+		StringDelimiters:  []string{"'", "\""},
+	},
 }
 
 // BinaryExtensions contains file extensions that should be skipped
@@ -883,6 +1026,68 @@ func GetLanguageByFilename(filename string) *Language {
 	return nil
 }
 
+// CanonicalNames maps lower-cased variants of language names, such as "cpp"
+// or "golang", to the name reported for the language. Every detected name is
+// looked up here before files are aggregated, so each language gets one label.
+// Bash and Python 2 are reported apart on purpose, see ShebangLanguages. A
+// languages file can add entries, see LoadLanguagesFile.
+var CanonicalNames = map[string]string{
+	"cpp":       "C++",
+	"cplusplus": "C++",
+	"cxx":       "C++",
+	"csharp":    "C#",
+	"cs":        "C#",
+	"golang":    "Go",
+	"js":        "JavaScript",
+	"node":      "JavaScript",
+	"nodejs":    "JavaScript",
+	"ts":        "TypeScript",
+	"py":        "Python",
+	"python3":   "Python",
+	"rb":        "Ruby",
+	"rs":        "Rust",
+	"kt":        "Kotlin",
+	"sh":        "Shell",
+	"zsh":       "Shell",
+	"yml":       "YAML",
+	"md":        "Markdown",
+	"tf":        "Terraform",
+	"proto":     "Protocol Buffers",
+	"protobuf":  "Protocol Buffers",
+	"hs":        "Haskell",
+}
+
+// CanonicalLanguageName returns the name reported for the language called
+// name, following CanonicalNames, or name itself if it has no entry
+func CanonicalLanguageName(name string) string {
+	if canonical, ok := CanonicalNames[strings.ToLower(name)]; ok {
+		return canonical
+	}
+	return name
+}
+
+// GetLanguageByName returns the language definition with the given name,
+// ignoring case. Variants listed in CanonicalNames are accepted too. When
+// several definitions share the name, the one under the lowest key of the
+// first table holding any is returned, so the choice never depends on map
+// iteration order.
+func GetLanguageByName(name string) *Language {
+	name = CanonicalLanguageName(name)
+	for _, table := range []map[string]*Language{Languages, FilenameLanguages, HiddenFileLanguages, ShebangLanguages} {
+		var found *Language
+		var foundKey string
+		for key, lang := range table {
+			if strings.EqualFold(lang.Name, name) && (found == nil || key < foundKey) {
+				found, foundKey = lang, key
+			}
+		}
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
 // IsBinaryExtension checks if the file extension is a binary file
 func IsBinaryExtension(ext string) bool {
 	return BinaryExtensions[ext]
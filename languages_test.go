@@ -105,6 +105,7 @@ func TestLanguageCommentPatterns(t *testing.T) {
 		{".sql", "--", "/*", "*/"},
 		{".lua", "--", "--[[", "]]"},
 		{".hs", "--", "{-", "-}"},
+		{".d", "//", "/*", "*/"},
 	}
 
 	for _, tt := range tests {
@@ -127,6 +128,23 @@ func TestLanguageCommentPatterns(t *testing.T) {
 	}
 }
 
+func TestNestedCommentLanguages(t *testing.T) {
+	for ext, want := range map[string]bool{
+		".rs":    true,
+		".swift": true,
+		".kt":    true,
+		".scala": true,
+		".hs":    true,
+		".d":     false,
+		".go":    false,
+		".c":     false,
+	} {
+		if got := GetLanguage(ext).NestedComments; got != want {
+			t.Errorf("GetLanguage(%q).NestedComments = %v, want %v", ext, got, want)
+		}
+	}
+}
+
 func TestAllLanguagesHaveNames(t *testing.T) {
 	for ext, lang := range Languages {
 		if lang.Name == "" {
@@ -168,3 +186,39 @@ func TestGetLanguageByFilename(t *testing.T) {
 		})
 	}
 }
+
+func TestGetLanguageByName(t *testing.T) {
+	tests := []struct {
+		name     string
+		wantName string
+	}{
+		{"Go", "Go"},
+		{"go", "Go"},
+		{"PYTHON", "Python"},
+		{"Makefile", "Makefile"},
+		{"Git Config", "Git Config"},
+		{"NoSuchLang", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := GetLanguageByName(tt.name)
+			if tt.wantName == "" {
+				if lang != nil {
+					t.Errorf("GetLanguageByName(%q) = %v, want nil", tt.name, lang.Name)
+				}
+				return
+			}
+			if lang == nil || lang.Name != tt.wantName {
+				t.Errorf("GetLanguageByName(%q) = %v, want %q", tt.name, lang, tt.wantName)
+			}
+		})
+	}
+
+	// Perl is defined under both .pl and .pm; the lowest key always wins
+	for i := 0; i < 20; i++ {
+		if lang := GetLanguageByName("Perl"); lang != Languages[".pl"] {
+			t.Fatalf("GetLanguageByName(Perl) = %p, want the definition under .pl (%p)", lang, Languages[".pl"])
+		}
+	}
+}
@@ -38,10 +38,12 @@ type Logger struct {
 var defaultLogger *Logger
 
 func init() {
-	defaultLogger = NewLogger(LogLevelInfo, os.Stdout, os.Stderr)
+	// Log output never goes to stdout, which is reserved for results
+	defaultLogger = NewLogger(LogLevelInfo, os.Stderr, os.Stderr)
 }
 
-// NewLogger creates a new Logger instance
+// NewLogger creates a new Logger instance. Debug and info messages are
+// written to out, warnings and errors to errOut.
 func NewLogger(level LogLevel, out io.Writer, errOut io.Writer) *Logger {
 	return &Logger{
 		level:    level,
@@ -57,7 +59,7 @@ func (l *Logger) SetLevel(level LogLevel) {
 	l.level = level
 }
 
-// SetOutput sets the output writer
+// SetOutput sets the output writer of debug and info messages
 func (l *Logger) SetOutput(out io.Writer) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -82,13 +84,23 @@ func (l *Logger) Info(format string, args ...interface{}) {
 	}
 }
 
+// Summary logs a machine-readable line at info level. It is written to
+// errOut without a level prefix, so it can be parsed on its own.
+func (l *Logger) Summary(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.level <= LogLevelInfo {
+		l.errorLog.Printf(format, args...)
+	}
+}
+
 // Warn logs a warning message
 func (l *Logger) Warn(format string, args ...interface{}) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	if l.level <= LogLevelWarn {
 		l.warnCount++
-		l.logger.Printf("[WARN] "+format, args...)
+		l.errorLog.Printf("[WARN] "+format, args...)
 	}
 }
 
@@ -128,7 +140,8 @@ func SetLogOutput(out io.Writer) {
 	defaultLogger.SetOutput(out)
 }
 
-// SetLogErrorOutput sets the error output writer for the default logger
+// SetLogErrorOutput sets the output writer of warnings and errors for the
+// default logger
 func SetLogErrorOutput(errOut io.Writer) {
 	defaultLogger.mu.Lock()
 	defer defaultLogger.mu.Unlock()
@@ -145,6 +158,11 @@ func LogInfo(format string, args ...interface{}) {
 	defaultLogger.Info(format, args...)
 }
 
+// LogSummary logs a machine-readable line using the default logger
+func LogSummary(format string, args ...interface{}) {
+	defaultLogger.Summary(format, args...)
+}
+
 // LogWarn logs a warning message using the default logger
 func LogWarn(format string, args ...interface{}) {
 	defaultLogger.Warn(format, args...)
@@ -155,6 +173,36 @@ func LogError(format string, args ...interface{}) {
 	defaultLogger.Error(format, args...)
 }
 
+// DefaultMaxErrors is the number of errors kept for --show-errors and
+// --include-errors unless set with --max-errors
+const DefaultMaxErrors = 5000
+
+// ErrorList collects errors up to a limit, so a tree failing on every file
+// cannot exhaust memory. Errors beyond the limit are counted but not kept.
+type ErrorList struct {
+	Max    int // number of errors kept, unlimited if 0 or less
+	errors []error
+	count  int
+}
+
+// Add records err, keeping it if the limit has not been reached
+func (l *ErrorList) Add(err error) {
+	l.count++
+	if l.Max <= 0 || len(l.errors) < l.Max {
+		l.errors = append(l.errors, err)
+	}
+}
+
+// Errors returns the errors kept, in the order they were added
+func (l *ErrorList) Errors() []error {
+	return l.errors
+}
+
+// Count returns the number of errors added, including those not kept
+func (l *ErrorList) Count() int {
+	return l.count
+}
+
 // FileError represents an error that occurred while processing a file
 type FileError struct {
 	FilePath string
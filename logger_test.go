@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	"strings"
 	"testing"
@@ -31,9 +32,13 @@ func TestLogger(t *testing.T) {
 
 	t.Run("Warn", func(t *testing.T) {
 		out.Reset()
+		errOut.Reset()
 		logger.Warn("test %s", "warn")
-		if !strings.Contains(out.String(), "[WARN] test warn") {
-			t.Errorf("Expected log to contain '[WARN] test warn', got %q", out.String())
+		if !strings.Contains(errOut.String(), "[WARN] test warn") {
+			t.Errorf("Expected error log to contain '[WARN] test warn', got %q", errOut.String())
+		}
+		if out.Len() > 0 {
+			t.Errorf("Warnings should not be written to the output writer, got %q", out.String())
 		}
 		if logger.GetWarnCount() != 1 {
 			t.Errorf("Expected warn count 1, got %d", logger.GetWarnCount())
@@ -104,7 +109,7 @@ func TestGlobalLogFunctions(t *testing.T) {
 
 	// Reset to original outputs after test
 	defer func() {
-		SetLogOutput(os.Stdout)
+		SetLogOutput(os.Stderr)
 		SetLogErrorOutput(os.Stderr)
 	}()
 
@@ -126,9 +131,13 @@ func TestGlobalLogFunctions(t *testing.T) {
 
 	t.Run("LogWarn", func(t *testing.T) {
 		out.Reset()
+		errOut.Reset()
 		LogWarn("global warn")
-		if !strings.Contains(out.String(), "[WARN] global warn") {
-			t.Errorf("Expected output to contain global warn, got %q", out.String())
+		if !strings.Contains(errOut.String(), "[WARN] global warn") {
+			t.Errorf("Expected stderr to contain global warn, got %q", errOut.String())
+		}
+		if strings.Contains(out.String(), "global warn") {
+			t.Errorf("Warnings should not be written to the output writer, got %q", out.String())
 		}
 	})
 
@@ -157,7 +166,7 @@ func TestLogFileDirectoryErrors(t *testing.T) {
 	SetLogOutput(&out)
 	SetLogErrorOutput(&out)
 	defer func() {
-		SetLogOutput(os.Stdout)
+		SetLogOutput(os.Stderr)
 		SetLogErrorOutput(os.Stderr)
 	}()
 
@@ -195,3 +204,44 @@ func TestIsPermissionError(t *testing.T) {
 		t.Error("Expected IsPermissionError(other error) to be false")
 	}
 }
+
+func TestErrorList(t *testing.T) {
+	list := ErrorList{Max: 3}
+	for i := 0; i < 10; i++ {
+		list.Add(fmt.Errorf("error %d", i))
+	}
+	if list.Count() != 10 {
+		t.Errorf("Count() = %d, want 10", list.Count())
+	}
+	if len(list.Errors()) != 3 || list.Errors()[2].Error() != "error 2" {
+		t.Errorf("Errors() = %v, want the first 3", list.Errors())
+	}
+
+	unlimited := ErrorList{}
+	for i := 0; i < 10; i++ {
+		unlimited.Add(errors.New("error"))
+	}
+	if len(unlimited.Errors()) != 10 || unlimited.Count() != 10 {
+		t.Errorf("Without a limit, kept %d of %d errors", len(unlimited.Errors()), unlimited.Count())
+	}
+}
+
+func TestLoggerSummary(t *testing.T) {
+	var out, errOut bytes.Buffer
+	logger := NewLogger(LogLevelInfo, &out, &errOut)
+
+	logger.Summary("processed=%d skipped=%d", 3, 1)
+	if errOut.String() != "processed=3 skipped=1\n" {
+		t.Errorf("Expected an unprefixed summary line on errOut, got %q", errOut.String())
+	}
+	if out.Len() > 0 {
+		t.Errorf("Expected nothing on out, got %q", out.String())
+	}
+
+	errOut.Reset()
+	logger.SetLevel(LogLevelWarn)
+	logger.Summary("processed=%d", 3)
+	if errOut.Len() > 0 {
+		t.Errorf("Expected the summary to be suppressed above info level, got %q", errOut.String())
+	}
+}
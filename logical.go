@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// ContinuationRules tells when a physical line of a language continues on
+// the next one, so both make up a single logical line
+type ContinuationRules struct {
+	Backslash bool // a code line ending in \ continues, as in C macros
+	Brackets  bool // a code line leaving (, [ or { open continues, as in Python
+}
+
+// Continuations maps language names to their continuation rules. In other
+// languages every code line is a logical line of its own.
+var Continuations = map[string]ContinuationRules{
+	"C":          {Backslash: true},
+	"C Header":   {Backslash: true},
+	"C++":        {Backslash: true},
+	"C++ Header": {Backslash: true},
+	"Shell":      {Backslash: true},
+	"Makefile":   {Backslash: true},
+	"Dockerfile": {Backslash: true},
+	"Python":     {Backslash: true, Brackets: true},
+}
+
+// logicalCounter counts the logical lines of a file, fed every line in
+// order with its classification
+type logicalCounter struct {
+	rules ContinuationRules
+
+	lines     int  // logical lines found so far
+	depth     int  // brackets left open, with rules.Brackets
+	continued bool // the previous code line continues on this one
+}
+
+// newLogicalCounter returns a counter using the continuation rules of lang
+func newLogicalCounter(lang *Language) *logicalCounter {
+	return &logicalCounter{rules: Continuations[lang.Name]}
+}
+
+// add records the next line, classified as info
+func (l *logicalCounter) add(line []byte, info LineInfo) {
+	if info.Kind != LineCode {
+		// Blank and comment lines only carry on a continuation by brackets
+		if l.depth == 0 {
+			l.continued = false
+		}
+		return
+	}
+
+	if !l.continued {
+		l.lines++
+	}
+	if l.rules.Brackets {
+		l.depth = bracketDepth(line, l.depth)
+	}
+	l.continued = l.depth > 0 || (l.rules.Backslash && endsWithBackslash(line))
+}
+
+// endsWithBackslash reports whether line ends in \, ignoring trailing
+// whitespace
+func endsWithBackslash(line []byte) bool {
+	trimmed := bytes.TrimRightFunc(line, unicode.IsSpace)
+	return len(trimmed) > 0 && trimmed[len(trimmed)-1] == '\\'
+}
+
+// bracketDepth returns the number of brackets left open after the Python
+// code line, starting with depth open. Brackets in strings and after a #
+// comment are ignored; strings do not span lines.
+func bracketDepth(line []byte, depth int) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '#':
+			return depth
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth = max(depth-1, 0)
+		}
+	}
+	return depth
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCountReaderLogicalLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		ext         string
+		input       string
+		wantCode    int
+		wantLogical int
+	}{
+		{
+			name: "C backslash continuation",
+			ext:  ".c",
+			input: "#define MAX(a, b) \\\n" +
+				"    ((a) > (b) ? (a) : (b))\n" +
+				"int x = 1;\n" +
+				"// a comment \\\n" +
+				"int y = 2;\n" +
+				"#define LONG \\\n" +
+				"  one \\\n" +
+				"  two\n",
+			wantCode:    7,
+			wantLogical: 4,
+		},
+		{
+			name: "Python brackets and backslashes",
+			ext:  ".py",
+			input: "values = [\n" +
+				"    1,\n" +
+				"\n" +
+				"    # the last one\n" +
+				"    2,\n" +
+				"]\n" +
+				"total = f(1, \")\",\n" +
+				"          2)  # (\n" +
+				"x = 1 + \\\n" +
+				"    2\n" +
+				"print(x)\n",
+			wantCode:    9,
+			wantLogical: 4,
+		},
+		{
+			name:        "language without continuations",
+			ext:         ".go",
+			input:       "x := f(\n\t1,\n)\n",
+			wantCode:    3,
+			wantLogical: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, Languages[tt.ext], CountOptions{LogicalLines: true})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if stats.CodeLines != tt.wantCode || stats.LogicalLines != tt.wantLogical {
+				t.Errorf("CountReader() = code %d, logical %d; want %d, %d",
+					stats.CodeLines, stats.LogicalLines, tt.wantCode, tt.wantLogical)
+			}
+
+			plain, err := CountReader(strings.NewReader(tt.input), "test"+tt.ext, Languages[tt.ext], CountOptions{})
+			if err != nil {
+				t.Fatalf("CountReader failed: %v", err)
+			}
+			if plain.LogicalLines != 0 || plain.CodeLines != stats.CodeLines || plain.TotalLines != stats.TotalLines {
+				t.Errorf("Without LogicalLines, got logical %d, code %d and total %d lines", plain.LogicalLines, plain.CodeLines, plain.TotalLines)
+			}
+		})
+	}
+}
+
+func TestBracketDepth(t *testing.T) {
+	tests := []struct {
+		line  string
+		depth int
+		want  int
+	}{
+		{"f(a, [b,", 0, 2},
+		{"c])", 2, 0},
+		{"s = '(' + \"[\"", 0, 0},
+		{"s = 'it\\'s ('", 0, 0},
+		{"x = 1  # (", 0, 0},
+		{")))", 1, 0},
+	}
+	for _, tt := range tests {
+		if got := bracketDepth([]byte(tt.line), tt.depth); got != tt.want {
+			t.Errorf("bracketDepth(%q, %d) = %d, want %d", tt.line, tt.depth, got, tt.want)
+		}
+	}
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 )
@@ -21,22 +29,883 @@ type Config struct {
 	Path            string
 	Workers         int
 	IncludeHidden   bool
+	IncludeSubs     bool // count git submodules instead of skipping them
 	ExcludeDirs     []string
 	ExcludePatterns []string
+	IncludePatterns []string // count only files matching one of these
+	ExcludeFrom     string   // file of further ExcludePatterns
+	IncludeFrom     string   // file of further IncludePatterns
+	ExcludeFiles    []string // exact paths of files to skip, relative to the scan root
+	ExcludeFileFrom string   // file of further ExcludeFiles
+	Extensions      []string // count only these extensions, generically
+	ExcludeData     bool     // report data files under a separate Data row
+	DataExtensions  []string // replaces DefaultDataExtensions if set
+	SkipVendor      bool
+	VendorDirs      []string // pruned with SkipVendor, in addition to VendorDirs
 	OutputFormat    string
+	Columns         []string // csv and tsv columns in order, nil for all
 	ShowErrors      bool
+	ShowSkipped     bool
+	SummaryStderr   bool // log the scan summary as key=value pairs
+	IncludeErrors   bool
+	StrictJSON      bool // validate JSON output against report.schema.json
+	MaxErrors       int  // errors kept for ShowErrors and IncludeErrors, 0 for all
 	Verbose         bool
 	Quiet           bool
+	PrintConfig     bool
+	Groups          map[string]string // language name -> group name
+	GroupRegex      *regexp.Regexp    // group files by the first capture of this pattern on their path
+	Aliases         map[string]string // lower-cased alias -> canonical language name
+	Prefer          map[string]string // lower-cased extension -> language forced for it
+	DetectEmbedded  bool
+	ReportIndent    bool
+	TabWidth        int // columns per tab for the indent width and fixed-form Fortran
+	Regions         bool
+	CountFunctions  bool           // estimate function definitions with per-language patterns
+	CommentedCode   bool           // report comment lines that read like code
+	DocComments     bool           // add columns with the doc comment lines per language
+	DocCoverage     bool           // add columns with the share of comment lines in comment and code lines
+	LogicalLines    bool           // add a column with the logical lines of code
+	MaxLineLength   int            // add a column with the code lines longer than this many runes, if positive
+	SplitTests      bool           // report test and source code totals apart
+	Duplicates      bool           // report groups of files with identical content
+	TopFiles        bool           // report the file with the most code lines of every language
+	IgnoreHeader    int            // lines skipped at the start of every file
+	HeaderUntil     *regexp.Regexp // skip lines of every file until one matches
+	Stdin           bool
+	StdinLang       string
+	DiffDirs        []string
+	StrictLanguages bool
+	CodeOnly        bool
+	Bytes           bool
+	CacheDir        string
+	UseShebang      bool
+	UseModeline     bool
+	SniffContent    bool // skip binary content and count unknown text as Text
+	SkipEmpty       bool // skip zero-byte files instead of counting them
+	FollowSymlinks  bool // walk into linked directories, counting every real file once
+	ProgressDirs    bool // log a summary of every directory once its files are counted
+	Sort            string
+	NumericFormat   string // one of NumericFormats for the table counts, by --format if empty
+	OutputFile      string
+	Outputs         []ExtraOutput // further formats written to files from the same scan
+	AccumulateInto  string        // JSON report the counts of every run are added to
+	MergeStdin      bool          // add the counts of a JSON report read from stdin
+	LanguagesFile   string        // language definitions loaded over the built-ins, see UserLanguagesPath
+	CPUProfile      string        // write a CPU profile of the run to this file
+	MemProfile      string        // write a heap profile after the run to this file
+	Clone           string
+	GitStaged       bool
+	SinceTag        string // report lines added and removed since this git tag
+	Manifest        string // file listing the paths to scan, one per line
+	Jobs            int    // manifest paths scanned at once
+	Separate        bool   // report every manifest path before the combined total
+	NoTruncate      bool
+	FixedWidth      bool // keep the fixed column widths on a terminal
+	NoBlankCol      bool
+	NoCommentCol    bool
+	NoHeader        bool // omit the table header, for piping the rows
+	NoTotal         bool // omit the total row and the summary footer
+	SplitComments   bool
+	Bars            bool
+	Weights         map[string]float64 // lower-cased language -> --weights weight, nil without --weights
+	ByExtension     bool
+	ByFile          bool
+	Detailed        bool
+	SampleFiles     int
+	Timeout         time.Duration // stop counting after this long, 0 for no limit
+	PerFileTimeout  time.Duration // skip a file taking longer than this to count, 0 for no limit
+	RelativeTo      string
+	Label           string // name of the scanned project in the output, the base name of the scan root if empty
+}
+
+// groupFlag collects repeatable --group "Name=Lang1,Lang2" definitions
+// into a language -> group lookup
+type groupFlag map[string]string
+
+func (g groupFlag) String() string {
+	groups := make(map[string][]string)
+	names := make([]string, 0)
+	for lang, name := range g {
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], lang)
+	}
+	sort.Strings(names)
+
+	specs := make([]string, 0, len(names))
+	for _, name := range names {
+		sort.Strings(groups[name])
+		specs = append(specs, name+"="+strings.Join(groups[name], ","))
+	}
+	return strings.Join(specs, ";")
+}
+
+func (g groupFlag) Set(value string) error {
+	name, members, ok := strings.Cut(value, "=")
+	name = trimSpace(name)
+	langs := splitAndTrim(members, ",")
+	if !ok || name == "" || len(langs) == 0 {
+		return fmt.Errorf("invalid group %q, expected Name=Lang1,Lang2", value)
+	}
+	for _, lang := range langs {
+		g[lang] = name
+	}
+	return nil
+}
+
+// aliasFlag collects repeatable --alias "alias=Canonical" definitions into
+// a lower-cased alias -> canonical name lookup
+type aliasFlag map[string]string
+
+func (a aliasFlag) String() string {
+	specs := make([]string, 0, len(a))
+	for alias, name := range a {
+		specs = append(specs, alias+"="+name)
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (a aliasFlag) Set(value string) error {
+	alias, name, ok := strings.Cut(value, "=")
+	alias = trimSpace(alias)
+	name = trimSpace(name)
+	if !ok || alias == "" || name == "" {
+		return fmt.Errorf("invalid alias %q, expected alias=Language", value)
+	}
+	a[strings.ToLower(alias)] = name
+	return nil
+}
+
+// preferFlag collects repeatable --prefer "ext=Language,..." definitions
+// into a lower-cased extension, with the leading dot, -> language lookup
+type preferFlag map[string]string
+
+func (p preferFlag) String() string {
+	specs := make([]string, 0, len(p))
+	for ext, name := range p {
+		specs = append(specs, ext+"="+name)
+	}
+	sort.Strings(specs)
+	return strings.Join(specs, ",")
+}
+
+func (p preferFlag) Set(value string) error {
+	for _, spec := range splitAndTrim(value, ",") {
+		ext, name, ok := strings.Cut(spec, "=")
+		ext = strings.ToLower(trimSpace(ext))
+		name = trimSpace(name)
+		if !ok || strings.Trim(ext, ".") == "" || name == "" {
+			return fmt.Errorf("invalid preference %q, expected ext=Language", spec)
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		p[ext] = name
+	}
+	return nil
+}
+
+// preferredLanguages resolves the languages named by Prefer, failing on a
+// name that is not a known language
+func (c *Config) preferredLanguages() (map[string]*Language, error) {
+	if len(c.Prefer) == 0 {
+		return nil, nil
+	}
+	preferred := make(map[string]*Language, len(c.Prefer))
+	for ext, name := range c.Prefer {
+		lang := GetLanguageByName(name)
+		if lang == nil {
+			return nil, fmt.Errorf("--prefer %s=%s: unknown language %q", strings.TrimPrefix(ext, "."), name, name)
+		}
+		preferred[ext] = lang
+	}
+	return preferred, nil
 }
 
 func main() {
 	config := parseFlags()
 	if err := Run(config); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, ErrTimeout) {
+			os.Exit(ExitTimeout)
+		}
 		os.Exit(1)
 	}
 }
 
+// describeConfig returns the effective settings as "name: value" lines
+func describeConfig(config *Config) []string {
+	path := config.Path
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	orNone := func(values []string) string {
+		if len(values) == 0 {
+			return "(none)"
+		}
+		return strings.Join(values, ", ")
+	}
+
+	outputFile := "stdout"
+	if config.OutputFile != "" {
+		outputFile = config.OutputFile
+	}
+	var extraOutputs []string
+	for _, output := range config.Outputs {
+		extraOutputs = append(extraOutputs, output.Format+"="+output.File)
+	}
+	numericFormat := "by format"
+	if config.NumericFormat != "" {
+		numericFormat = config.NumericFormat
+	}
+	accumulateInto := "none"
+	if config.AccumulateInto != "" {
+		accumulateInto = config.AccumulateInto
+	}
+	languagesFile := "none"
+	if config.LanguagesFile != "" {
+		languagesFile = config.LanguagesFile
+	}
+
+	headerUntil := "none"
+	if config.HeaderUntil != nil {
+		headerUntil = config.HeaderUntil.String()
+	}
+	groupRegex := "none"
+	if config.GroupRegex != nil {
+		groupRegex = config.GroupRegex.String()
+	}
+
+	sortOrder := SortByCode
+	if config.Sort != "" {
+		sortOrder = config.Sort
+	}
+
+	cacheDir := "(none)"
+	if config.CacheDir != "" {
+		cacheDir = config.CacheDir
+	}
+
+	relativeTo := "(none)"
+	if config.RelativeTo != "" {
+		relativeTo = config.RelativeTo
+	}
+
+	input := "path " + path
+	if config.Clone != "" {
+		input = "clone " + config.Clone
+	} else if config.GitStaged {
+		input = "staged files in " + path
+	} else if config.SinceTag != "" {
+		input = "changes since tag " + config.SinceTag + " in " + path
+	} else if isGlobInput(config.Path) {
+		input = "files matching " + config.Path
+	} else if config.Manifest != "" {
+		input = fmt.Sprintf("paths listed in %s (%d at a time, separate: %t)", config.Manifest, config.Jobs, config.Separate)
+	} else if config.Stdin || config.StdinLang != "" {
+		input = "stdin"
+		if config.StdinLang != "" {
+			input += " as " + config.StdinLang
+		}
+	} else if config.DiffDirs != nil {
+		input = "diff " + orNone(config.DiffDirs)
+	}
+
+	return []string{
+		"input: " + input,
+		fmt.Sprintf("workers: %d", config.Workers),
+		fmt.Sprintf("include hidden: %t", config.IncludeHidden),
+		fmt.Sprintf("include submodules: %t", config.IncludeSubs),
+		"default excluded dirs: " + orNone(DefaultExcludeDirs),
+		"excluded dirs: " + orNone(config.ExcludeDirs),
+		fmt.Sprintf("skip vendor: %t", config.SkipVendor),
+		"extra vendor dirs: " + orNone(config.VendorDirs),
+		"ignore patterns: " + orNone(config.ExcludePatterns),
+		"include patterns: " + orNone(config.IncludePatterns),
+		"excluded files: " + orNone(config.ExcludeFiles),
+		"extensions: " + orNone(config.Extensions),
+		"data extensions: " + orNone(config.dataExtensions()),
+		"languages file: " + languagesFile,
+		"groups: " + orNone(splitAndTrim(groupFlag(config.Groups).String(), ";")),
+		"group by regex: " + groupRegex,
+		"aliases: " + orNone(splitAndTrim(aliasFlag(config.Aliases).String(), ",")),
+		"preferred languages: " + orNone(splitAndTrim(preferFlag(config.Prefer).String(), ",")),
+		"output format: " + config.OutputFormat,
+		"columns: " + orNone(config.Columns),
+		"output file: " + outputFile,
+		"extra outputs: " + orNone(extraOutputs),
+		"accumulate into: " + accumulateInto,
+		fmt.Sprintf("merge stdin: %t", config.MergeStdin),
+		"sort: " + sortOrder,
+		"numeric format: " + numericFormat,
+		fmt.Sprintf("show errors: %t, include errors: %t, max errors: %d", config.ShowErrors, config.IncludeErrors, config.MaxErrors),
+		fmt.Sprintf("show skipped: %t", config.ShowSkipped),
+		fmt.Sprintf("summary to stderr: %t", config.SummaryStderr),
+		fmt.Sprintf("detect embedded: %t", config.DetectEmbedded),
+		fmt.Sprintf("report indent: %t", config.ReportIndent),
+		fmt.Sprintf("tab width: %d", config.TabWidth),
+		fmt.Sprintf("regions: %t", config.Regions),
+		fmt.Sprintf("count functions: %t", config.CountFunctions),
+		fmt.Sprintf("detect commented code: %t", config.CommentedCode),
+		fmt.Sprintf("doc comments: %t", config.DocComments),
+		fmt.Sprintf("doc coverage: %t", config.DocCoverage),
+		fmt.Sprintf("logical lines: %t", config.LogicalLines),
+		fmt.Sprintf("max line length: %d", config.MaxLineLength),
+		fmt.Sprintf("split tests: %t", config.SplitTests),
+		fmt.Sprintf("duplicates: %t", config.Duplicates),
+		fmt.Sprintf("top file per language: %t", config.TopFiles),
+		fmt.Sprintf("ignore header: %d lines, until: %s", config.IgnoreHeader, headerUntil),
+		fmt.Sprintf("use shebang: %t", config.UseShebang),
+		fmt.Sprintf("use modeline: %t", config.UseModeline),
+		fmt.Sprintf("sniff content: %t", config.SniffContent),
+		fmt.Sprintf("skip empty: %t", config.SkipEmpty),
+		fmt.Sprintf("follow symlinks: %t", config.FollowSymlinks),
+		fmt.Sprintf("progress by directory: %t", config.ProgressDirs),
+		fmt.Sprintf("strict languages: %t", config.StrictLanguages),
+		fmt.Sprintf("code only: %t", config.CodeOnly),
+		fmt.Sprintf("bytes: %t", config.Bytes),
+		fmt.Sprintf("no blank column: %t, no comment column: %t", config.NoBlankCol, config.NoCommentCol),
+		fmt.Sprintf("no header: %t, no total: %t", config.NoHeader, config.NoTotal),
+		fmt.Sprintf("split comments: %t", config.SplitComments),
+		fmt.Sprintf("bars: %t", config.Bars),
+		fmt.Sprintf("by file: %t", config.ByFile),
+		fmt.Sprintf("by extension: %t", config.ByExtension),
+		fmt.Sprintf("detailed json: %t", config.Detailed),
+		"relative to: " + relativeTo,
+		"label: " + config.scanLabel(),
+		"cache dir: " + cacheDir,
+		fmt.Sprintf("sample files: %d", config.SampleFiles),
+		fmt.Sprintf("timeout: %v", config.Timeout),
+		fmt.Sprintf("per-file timeout: %v", config.PerFileTimeout),
+	}
+}
+
+// LogConfig logs the effective settings at Info level
+func LogConfig(config *Config) {
+	LogInfo("Effective configuration:")
+	for _, line := range describeConfig(config) {
+		LogInfo("  %s", line)
+	}
+}
+
+// ScanResult holds the outcome of counting a single input path
+type ScanResult struct {
+	FileStats      []*FileStats // only retained when a per-file mode needs them
+	LangStats      map[string]*LanguageStats
+	Embedded       map[string]int
+	Errors         []error // at most --max-errors of them
+	ErrorCount     int     // every error encountered, kept or not
+	ProcessedFiles int
+	SkippedFiles   int
+	UnknownFiles   []string      // skipped files with no recognized language
+	Skipped        []SkippedFile // every skipped file and why, sorted by path
+	CachedFiles    int           // processed files served from --cache-dir
+	Sampled        bool          // counting stopped at --sample-files
+	TimedOut       bool          // counting stopped at --timeout
+}
+
+// ErrTimeout is returned by Run when counting stopped at --timeout, after
+// the partial results were printed
+var ErrTimeout = errors.New("scan timed out, results are partial")
+
+// ExitTimeout is the exit status after ErrTimeout, the one used by timeout(1)
+const ExitTimeout = 124
+
+// scanContext returns the context counting stops at, done after
+// config.Timeout if it is set
+func (c *Config) scanContext() (context.Context, context.CancelFunc) {
+	if c.Timeout > 0 {
+		return context.WithTimeout(context.Background(), c.Timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Scan counts the file or directory at path using the given configuration
+func Scan(config *Config, path string) (*ScanResult, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Count the entries of a tar archive, such as an image layer
+	if !info.IsDir() && isTarPath(path) {
+		return ScanTar(config, path)
+	}
+
+	preferred, err := config.preferredLanguages()
+	if err != nil {
+		return nil, err
+	}
+
+	countOptions := config.countOptions()
+	result := &ScanResult{}
+
+	cache, saveCache, err := openCache(config, countOptions, result)
+	if err != nil {
+		return nil, err
+	}
+	defer saveCache()
+
+	if !info.IsDir() {
+		// Single file mode
+		scanFile(result, path, info, config, countOptions, cache, preferred)
+		result.LangStats = AggregateStats(result.FileStats)
+		result.Embedded = AggregateEmbedded(result.FileStats)
+		return result, nil
+	}
+
+	// Directory mode
+	ctx, cancel := config.scanContext()
+	defer cancel()
+	walker := NewWalker(path, config.Workers)
+	walker.SetContext(ctx)
+	walker.SetIncludeHidden(config.IncludeHidden)
+	walker.SetIncludeSubmodules(config.IncludeSubs)
+	walker.SetUseShebang(config.UseShebang)
+	walker.SetUseModeline(config.UseModeline)
+	walker.SetSniffContent(config.SniffContent)
+	walker.SetSkipEmpty(config.SkipEmpty)
+	walker.SetFollowSymlinks(config.FollowSymlinks)
+	walker.SetProgressDirs(config.ProgressDirs)
+	walker.SetPerFileTimeout(config.PerFileTimeout)
+	walker.SetExtensions(config.Extensions)
+	walker.SetPreferences(preferred)
+	walker.SetDataExtensions(config.dataExtensions())
+	walker.SetSampleFiles(config.SampleFiles)
+	walker.SetCountOptions(countOptions)
+	walker.SetMaxErrors(config.MaxErrors)
+	walker.SetRetainFiles(config.retainFileStats())
+	if cache != nil {
+		walker.SetCache(cache)
+	}
+
+	// Add any additional exclude directories
+	for _, dir := range config.ExcludeDirs {
+		walker.AddExcludeDir(dir)
+	}
+
+	// Prune vendored directories if requested
+	if config.SkipVendor {
+		for _, dir := range append(slices.Clone(VendorDirs), config.VendorDirs...) {
+			walker.AddExcludeDir(dir)
+		}
+	}
+
+	// Add exclude patterns
+	for _, pattern := range config.ExcludePatterns {
+		walker.AddExcludePattern(pattern)
+	}
+
+	// Add include patterns
+	for _, pattern := range config.IncludePatterns {
+		walker.AddIncludePattern(pattern)
+	}
+
+	// Add files excluded by exact path
+	for _, file := range config.ExcludeFiles {
+		walker.AddExcludeFile(file)
+	}
+
+	if config.Verbose {
+		LogDebug("Starting LOC count in: %s", path)
+		LogDebug("Using %d workers", config.Workers)
+	}
+
+	// Walk and count
+	result.FileStats, result.Errors = walker.Walk()
+	result.ErrorCount = walker.GetErrorCount()
+	result.LangStats = walker.GetLanguageStats()
+	result.Embedded = walker.GetEmbedded()
+	result.ProcessedFiles = walker.GetProcessedCount()
+	result.SkippedFiles = walker.GetSkippedCount()
+	result.UnknownFiles = walker.GetUnknownFiles()
+	result.Skipped = walker.GetSkippedFiles()
+	result.Sampled = walker.IsSampled()
+	result.TimedOut = walker.IsInterrupted()
+
+	return result, nil
+}
+
+// ScanFiles counts the given files through the same per-file logic as Scan
+// uses for a single file. Files that cannot be read are reported as errors.
+func ScanFiles(config *Config, paths []string) (*ScanResult, error) {
+	preferred, err := config.preferredLanguages()
+	if err != nil {
+		return nil, err
+	}
+
+	countOptions := config.countOptions()
+	result := &ScanResult{}
+
+	cache, saveCache, err := openCache(config, countOptions, result)
+	if err != nil {
+		return nil, err
+	}
+	defer saveCache()
+
+	ctx, cancel := config.scanContext()
+	defer cancel()
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			result.TimedOut = true
+			break
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			LogFileError(path, err)
+			result.addError(NewFileError(path, err), config.MaxErrors)
+			continue
+		}
+		scanFile(result, path, info, config, countOptions, cache, preferred)
+		if config.SampleFiles > 0 && result.ProcessedFiles >= config.SampleFiles {
+			result.Sampled = true
+			break
+		}
+	}
+	sortSkippedFiles(result.Skipped)
+
+	result.LangStats = AggregateStats(result.FileStats)
+	result.Embedded = AggregateEmbedded(result.FileStats)
+	return result, nil
+}
+
+// addError records err, keeping it unless maxErrors are already kept
+func (r *ScanResult) addError(err error, maxErrors int) {
+	list := ErrorList{Max: maxErrors, errors: r.Errors, count: r.ErrorCount}
+	list.Add(err)
+	r.Errors, r.ErrorCount = list.Errors(), list.Count()
+}
+
+// scanFile counts a single file and records the outcome in result.
+// preferred holds the languages forced by --prefer, see preferredLanguages.
+func scanFile(result *ScanResult, path string, info os.FileInfo, config *Config, countOptions CountOptions, cache *FileCache, preferred map[string]*Language) {
+	ext := strings.ToLower(filepath.Ext(path))
+	lang := GetLanguage(ext)
+	reason := "ext " + ext
+	if lang == nil {
+		lang = GetLanguageByFilename(filepath.Base(path))
+		reason = "filename"
+	}
+	if exts := extensionLanguages(config.Extensions); exts != nil {
+		var ok bool
+		if lang, ok = exts[ext]; !ok {
+			result.SkippedFiles++
+			result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipExcluded})
+			return
+		}
+		reason = "--ext " + ext
+	} else {
+		if config.UseShebang {
+			if shebangLang := DetectShebang(path); shebangLang != nil {
+				lang, reason = shebangLang, "shebang"
+			}
+		}
+		if config.UseModeline {
+			if modelineLang := DetectModeline(path); modelineLang != nil {
+				lang, reason = modelineLang, "modeline"
+			}
+		}
+		if isDataFile(filepath.Base(path), dataSuffixes(config.dataExtensions())) {
+			lang, reason = DataLanguage, "data suffix"
+		} else if config.SniffContent {
+			sniffed, text := sniffLanguage(path, lang)
+			if !text {
+				result.SkippedFiles++
+				result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipBinary})
+				return
+			}
+			if lang == nil {
+				reason = "content"
+			}
+			lang = sniffed
+		}
+		if preferredLang, ok := preferred[ext]; ok {
+			lang, reason = preferredLang, "--prefer "+ext
+		}
+	}
+
+	if lang == nil {
+		result.SkippedFiles++
+		result.UnknownFiles = append(result.UnknownFiles, path)
+		result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipUnknown})
+		return
+	}
+	if config.SkipEmpty && isEmptyFile(path, info) {
+		result.SkippedFiles++
+		result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipEmpty})
+		return
+	}
+	logClassified(path, lang, reason)
+
+	var stats *FileStats
+	var err error
+	cached := false
+	if cache != nil {
+		stats, cached = cache.Get(path, info, lang)
+	}
+	if !cached {
+		stats, err = countFileWithin(config.PerFileTimeout, path, lang, countOptions)
+		if err == nil && cache != nil {
+			cache.Put(path, info, lang, stats)
+		}
+	}
+	if errors.Is(err, ErrFileTimeout) {
+		LogWarn("Skipping %s: counting took longer than %v", path, config.PerFileTimeout)
+		result.SkippedFiles++
+		result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipTimeout})
+	} else if errors.Is(err, ErrMalformedNotebook) {
+		LogFileError(path, err)
+		result.SkippedFiles++
+		result.Skipped = append(result.Skipped, SkippedFile{Path: path, Reason: SkipMalformed})
+	} else if err != nil {
+		LogFileError(path, err)
+		result.addError(NewFileError(path, err), config.MaxErrors)
+	} else {
+		stats.Extension = ext
+		result.FileStats = append(result.FileStats, stats)
+		result.ProcessedFiles++
+	}
+}
+
+// openCache loads the --cache-dir cache, if one is configured. The returned
+// function saves it and records the number of cache hits in result.
+func openCache(config *Config, countOptions CountOptions, result *ScanResult) (*FileCache, func(), error) {
+	if config.CacheDir == "" {
+		return nil, func() {}, nil
+	}
+
+	cache, err := LoadFileCache(config.CacheDir, countOptions)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cache: %w", err)
+	}
+	save := func() {
+		result.CachedFiles = cache.Hits()
+		LogDebug("Reused cached counts for %d files", result.CachedFiles)
+		if err := cache.Save(); err != nil {
+			LogWarn("Failed to save cache %s: %v", config.CacheDir, err)
+		}
+	}
+	return cache, save, nil
+}
+
+// countOptions returns the per-file counting options selected by the
+// configuration
+func (c *Config) countOptions() CountOptions {
+	return CountOptions{
+		DetectEmbedded:    c.DetectEmbedded,
+		ReportIndent:      c.ReportIndent,
+		TabWidth:          c.TabWidth,
+		Regions:           c.Regions,
+		Functions:         c.CountFunctions,
+		CommentedCode:     c.CommentedCode,
+		DocComments:       c.DocComments,
+		LogicalLines:      c.LogicalLines,
+		MaxLineLength:     c.MaxLineLength,
+		IgnoreHeader:      c.IgnoreHeader,
+		IgnoreHeaderUntil: c.HeaderUntil,
+		CodeOnly:          c.CodeOnly,
+	}
+}
+
+// dataExtensions returns the suffixes of files reported as data, or nil
+// without --exclude-data
+func (c *Config) dataExtensions() []string {
+	if !c.ExcludeData {
+		return nil
+	}
+	if c.DataExtensions != nil {
+		return c.DataExtensions
+	}
+	return DefaultDataExtensions
+}
+
+// readPatternFiles appends the patterns read from ExcludeFrom and
+// IncludeFrom to ExcludePatterns and IncludePatterns, and the paths read
+// from ExcludeFileFrom to ExcludeFiles. The file names are cleared
+// afterwards so the patterns are only added once.
+func (c *Config) readPatternFiles() error {
+	if c.ExcludeFrom != "" {
+		patterns, err := readPatternFile(c.ExcludeFrom)
+		if err != nil {
+			return fmt.Errorf("exclude-from: %w", err)
+		}
+		c.ExcludePatterns = append(c.ExcludePatterns, patterns...)
+		c.ExcludeFrom = ""
+	}
+	if c.IncludeFrom != "" {
+		patterns, err := readPatternFile(c.IncludeFrom)
+		if err != nil {
+			return fmt.Errorf("include-from: %w", err)
+		}
+		c.IncludePatterns = append(c.IncludePatterns, patterns...)
+		c.IncludeFrom = ""
+	}
+	if c.ExcludeFileFrom != "" {
+		paths, err := readPatternFile(c.ExcludeFileFrom)
+		if err != nil {
+			return fmt.Errorf("exclude-file-from: %w", err)
+		}
+		c.ExcludeFiles = append(c.ExcludeFiles, paths...)
+		c.ExcludeFileFrom = ""
+	}
+	return nil
+}
+
+// readPatternFile returns the glob patterns listed one per line in the file
+// at path, skipping blank lines and lines starting with "#"
+func readPatternFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := filepath.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern %q: %w", path, line, err)
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, nil
+}
+
+// reportedStats returns the rows reported for result: its languages with
+// aliases merged and groups applied, or grouped by path with GroupRegex
+func (c *Config) reportedStats(result *ScanResult) map[string]*LanguageStats {
+	if c.GroupRegex != nil {
+		base := c.RelativeTo
+		if base == "" {
+			base = c.Path
+		}
+		return GroupByPath(result.FileStats, c.GroupRegex, base)
+	}
+	langStats := MergeLanguageAliases(result.LangStats, c.Aliases)
+	if len(c.Groups) > 0 {
+		langStats = GroupStats(langStats, c.Groups)
+	}
+	if c.Weights != nil {
+		ApplyWeights(langStats, c.Weights)
+	}
+	return langStats
+}
+
+// retainFileStats reports whether Scan must keep every per-file record.
+// Aggregate output only needs the per-language totals, which are merged as
+// files are counted; per-file output modes must be added here.
+func (c *Config) retainFileStats() bool {
+	return c.ByFile || c.ByExtension || c.SplitTests || c.Duplicates || c.TopFiles || c.GroupRegex != nil || c.OutputFormat == "ndjson" || c.OutputFormat == "tree-json" || (c.Detailed && c.OutputFormat == "json")
+}
+
+// tableOptions returns the table columns selected by the configuration
+func (c *Config) tableOptions(formatNumbers bool) TableOptions {
+	return TableOptions{
+		CodeOnly:      c.CodeOnly,
+		Bytes:         c.Bytes,
+		FormatNumbers: formatNumbers,
+		NumericFormat: c.NumericFormat,
+		SortBy:        c.Sort,
+		NoTruncate:    c.NoTruncate,
+		NoBlank:       c.NoBlankCol,
+		NoComment:     c.NoCommentCol,
+		NoHeader:      c.NoHeader,
+		NoTotal:       c.NoTotal,
+		SplitComments: c.SplitComments,
+		Bars:          c.Bars,
+		Functions:     c.CountFunctions,
+		DocComments:   c.DocComments,
+		DocCoverage:   c.DocCoverage,
+		Logical:       c.LogicalLines,
+		LongLines:     c.MaxLineLength > 0,
+		Weighted:      c.Weights != nil,
+	}
+}
+
+// csvColumnNames returns the csv and tsv columns selected by the
+// configuration: Columns if set, otherwise the default columns less those
+// omitted by NoBlankCol and NoCommentCol
+func (c *Config) csvColumnNames() []string {
+	if c.Columns != nil {
+		return c.Columns
+	}
+	var names []string
+	for _, name := range CSVColumnNames() {
+		if (name == "blank" && c.NoBlankCol) || (name == "comment" && c.NoCommentCol) {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// jsonColumns returns the JSON fields selected by the configuration
+func (c *Config) jsonColumns() JSONColumns {
+	return JSONColumns{NoBlank: c.NoBlankCol, NoComment: c.NoCommentCol, SplitComments: c.SplitComments, Functions: c.CountFunctions}
+}
+
+// jsonReport builds the JSON report of result, with the errors and files
+// selected by the configuration, and validates it with --strict-json
+func (c *Config) jsonReport(result *ScanResult, langStats map[string]*LanguageStats, total *LanguageStats) (*JSONReport, error) {
+	report := NewJSONReport(langStats, total, c.jsonColumns())
+	report.Project = c.scanLabel()
+	if c.IncludeErrors {
+		report.AddErrors(result.Errors, result.ErrorCount)
+	}
+	if c.Detailed {
+		report.AddFiles(result.FileStats, RowLanguage(result.LangStats, c.Aliases, c.Groups), c.RelativeTo)
+	}
+	if c.StrictJSON {
+		data, err := json.Marshal(report)
+		if err == nil {
+			err = ValidateJSONReport(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("strict json: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// scanLabel returns the name the output gives the scanned project: --label
+// if set, or else the base name of the repository to clone or of the scan
+// root, leaving out the wildcard segments of a glob
+func (c *Config) scanLabel() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	if c.Clone != "" {
+		return strings.TrimSuffix(path.Base(strings.TrimRight(c.Clone, "/")), ".git")
+	}
+	root := c.Path
+	if isGlobInput(root) {
+		segments := strings.Split(filepath.ToSlash(root), "/")
+		for i, segment := range segments {
+			if hasGlobMeta(segment) {
+				segments = segments[:i]
+				break
+			}
+		}
+		root = filepath.FromSlash(strings.Join(segments, "/"))
+	}
+	if abs, err := filepath.Abs(root); err == nil {
+		root = abs
+	}
+	return filepath.Base(root)
+}
+
+// customTable reports whether the language table differs from the one
+// printed by PrintResults
+func (c *Config) customTable() bool {
+	return c.CodeOnly || c.Bytes || c.NoTruncate || c.NoBlankCol || c.NoCommentCol || c.NoHeader || c.NoTotal || c.SplitComments || c.Bars || c.Weights != nil || c.CountFunctions || c.DocComments || c.DocCoverage || c.LogicalLines || c.MaxLineLength > 0 || c.NumericFormat != "" || (c.Sort != "" && c.Sort != SortByCode)
+}
+
 // Run executes the application logic with the given configuration
 func Run(config *Config) error {
 	if config.Verbose {
@@ -50,100 +919,332 @@ func Run(config *Config) error {
 		config.Path = "."
 	}
 
-	info, err := os.Stat(config.Path)
+	// Profile the run if requested
+	if config.CPUProfile != "" || config.MemProfile != "" {
+		stopProfiles, err := StartProfiles(config.CPUProfile, config.MemProfile)
+		if err != nil {
+			return fmt.Errorf("profile: %w", err)
+		}
+		defer func() {
+			if err := stopProfiles(); err != nil {
+				LogError("Failed to write profile: %v", err)
+			}
+		}()
+	}
+
+	// Add the patterns listed in --exclude-from and --include-from files
+	if err := config.readPatternFiles(); err != nil {
+		return err
+	}
+
+	// Layer the user's language definitions over the built-in ones
+	if config.LanguagesFile != "" {
+		n, err := LoadLanguagesFile(config.LanguagesFile)
+		if err != nil {
+			return fmt.Errorf("languages file: %w", err)
+		}
+		LogDebug("Loaded %d language definitions from %s", n, config.LanguagesFile)
+	}
+
+	if config.PrintConfig {
+		LogConfig(config)
+	}
+
+	render, err := LookupFormat(config.OutputFormat)
 	if err != nil {
 		return err
 	}
 
+	if config.Columns != nil && config.OutputFormat != "csv" && config.OutputFormat != "tsv" {
+		return fmt.Errorf("--columns applies to the csv and tsv formats, not %q", config.OutputFormat)
+	}
+
+	if config.NumericFormat != "" && !slices.Contains(NumericFormats, config.NumericFormat) {
+		return fmt.Errorf("unknown numeric format %q, expected one of: %s", config.NumericFormat, strings.Join(NumericFormats, ", "))
+	}
+
+	if config.Sort != "" && !slices.Contains(SortOrders, config.Sort) {
+		return fmt.Errorf("unknown sort order %q, expected one of: %s", config.Sort, strings.Join(SortOrders, ", "))
+	}
+
+	if config.DiffDirs != nil {
+		return RunDiff(config)
+	}
+
+	if config.SinceTag != "" {
+		return RunSinceTag(config)
+	}
+
+	// Name the project after the scan root, before a clone replaces it
+	labelSet := config.Label != ""
+	config.Label = config.scanLabel()
+
+	// Count a shallow clone of a remote repository if requested
+	if config.Clone != "" {
+		dir, cleanup, err := CloneRepository(config.Clone)
+		defer cleanup()
+		if err != nil {
+			LogError("Failed to clone %s: %v", config.Clone, err)
+			return err
+		}
+		config.Path = dir
+		if config.RelativeTo == "" {
+			config.RelativeTo = dir
+		}
+	}
+
+	readStdin := config.Stdin || config.StdinLang != ""
+	if config.MergeStdin && readStdin {
+		return errors.New("--merge-stdin reads a report from stdin and cannot be combined with --stdin or --stdin-lang")
+	}
+	if config.MergeStdin && config.GroupRegex != nil {
+		return errors.New("--merge-stdin cannot be combined with --group-by-regex, which groups scanned files by path")
+	}
+	if config.Manifest != "" && (readStdin || config.GitStaged || config.Clone != "") {
+		return errors.New("--manifest lists the paths to scan and cannot be combined with --stdin, --stdin-lang, --git-staged or --clone")
+	}
+	if config.Separate && config.Manifest == "" {
+		return errors.New("--separate reports the paths of a --manifest, which is not set")
+	}
+	if config.Separate && config.OutputFormat != "default" && config.OutputFormat != "formatted" {
+		return fmt.Errorf("--separate applies to the default and formatted formats, not %q", config.OutputFormat)
+	}
+
 	// Start timing
 	startTime := time.Now()
 
-	var fileStats []*FileStats
-	var errors []error
-	processedFiles := 0
-	skippedFiles := 0
+	var result *ScanResult
+	var manifestPaths []string
+	var manifestResults []*ScanResult
+	if readStdin {
+		// Stdin mode
+		stats, err := CountStdin(os.Stdin, config.StdinLang)
+		if err != nil {
+			return err
+		}
+		fileStats := []*FileStats{stats}
+		result = &ScanResult{
+			FileStats:      fileStats,
+			LangStats:      AggregateStats(fileStats),
+			Embedded:       AggregateEmbedded(fileStats),
+			ProcessedFiles: 1,
+		}
+	} else if config.Manifest != "" {
+		// Scan every path listed in the manifest and merge the results
+		var err error
+		if manifestPaths, err = ReadManifest(config.Manifest); err != nil {
+			return fmt.Errorf("manifest: %w", err)
+		}
+		if manifestResults, err = ScanManifest(config, manifestPaths); err != nil {
+			return err
+		}
+		result = MergeScanResults(manifestResults, config.MaxErrors)
+	} else if isGlobInput(config.Path) {
+		// Count the files matching a glob such as 'src/**/*.go'
+		paths, err := ExpandGlob(config.Path)
+		if err != nil {
+			return err
+		}
+		result, err = ScanFiles(config, paths)
+		if err != nil {
+			return err
+		}
+	} else if config.GitStaged {
+		// Count only the files staged in git
+		paths, err := StagedFiles(config.Path)
+		if err != nil {
+			LogError("Failed to list staged files in %s: %v", config.Path, err)
+			return err
+		}
+		result, err = ScanFiles(config, paths)
+		if err != nil {
+			return err
+		}
+	} else {
+		var err error
+		result, err = Scan(config, config.Path)
+		if err != nil {
+			return err
+		}
+	}
+	// Add the counts of a report piped on stdin if requested
+	if config.MergeStdin {
+		if err := MergeJSONReport(result.LangStats, os.Stdin); err != nil {
+			return fmt.Errorf("merge stdin: %w", err)
+		}
+	}
+
+	errs := result.Errors
 
-	if !info.IsDir() {
-		// Single file mode
-		ext := strings.ToLower(filepath.Ext(config.Path))
-		lang := GetLanguage(ext)
-		if lang == nil {
-			lang = GetLanguageByFilename(filepath.Base(config.Path))
+	// Calculate elapsed time
+	elapsed := time.Since(startTime)
+
+	// Aggregate statistics
+	langStats := config.reportedStats(result)
+	total := TotalStats(langStats)
+	errorCount := result.ErrorCount
+
+	// Build the JSON report up front so --strict-json fails before printing
+	var report *JSONReport
+	if config.OutputFormat == "json" || config.hasExtraOutput("json") {
+		if report, err = config.jsonReport(result, langStats, total); err != nil {
+			return err
 		}
+	}
 
-		if lang == nil {
-			skippedFiles = 1
-		} else {
-			stats, err := CountLines(config.Path, lang)
-			if err != nil {
-				errors = append(errors, err)
-			} else {
-				stats.Extension = ext
-				fileStats = append(fileStats, stats)
-				processedFiles = 1
+	printResults := func(w io.Writer) error {
+		// Show every manifest path on its own first if requested
+		if config.Separate {
+			for i, path := range manifestPaths {
+				fmt.Fprintf(w, "\nPath: %s\n", path)
+				pathStats := config.reportedStats(manifestResults[i])
+				section := &Report{Config: config, Result: manifestResults[i], LangStats: pathStats, Total: TotalStats(pathStats)}
+				if err := render(w, section); err != nil {
+					LogError("Failed to write %s output: %v", config.OutputFormat, err)
+				}
 			}
+			fmt.Fprintf(w, "\nAll paths:\n")
 		}
-	} else {
-		// Directory mode
-		walker := NewWalker(config.Path, config.Workers)
-		walker.SetIncludeHidden(config.IncludeHidden)
 
-		// Add any additional exclude directories
-		for _, dir := range config.ExcludeDirs {
-			walker.AddExcludeDir(dir)
+		// Name the project above the table if requested
+		if labelSet && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			fmt.Fprintf(w, "\nProject: %s\n", config.Label)
+		}
+
+		// Output results in the registered format
+		rendered := &Report{Config: config, Result: result, LangStats: langStats, Total: total, JSON: report}
+		if err := render(w, rendered); err != nil {
+			LogError("Failed to write %s output: %v", config.OutputFormat, err)
+		}
+
+		// Show per-extension results if requested
+		if config.ByExtension && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintExtensions(w, AggregateByExtension(result.FileStats), TotalStats(result.LangStats))
+		}
+
+		// Show per-file results if requested
+		if config.ByFile && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintFiles(w, result.FileStats, config.RelativeTo)
 		}
 
-		// Add exclude patterns
-		for _, pattern := range config.ExcludePatterns {
-			walker.AddExcludePattern(pattern)
+		// Show embedded language summary if requested
+		if config.DetectEmbedded && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintEmbedded(w, result.Embedded)
 		}
 
-		if config.Verbose {
-			LogDebug("Starting LOC count in: %s", config.Path)
-			LogDebug("Using %d workers", config.Workers)
+		// Show indentation summary if requested
+		if config.ReportIndent && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintIndent(w, langStats, total)
 		}
 
-		// Walk and count
-		fileStats, errors = walker.Walk()
-		processedFiles = walker.GetProcessedCount()
-		skippedFiles = walker.GetSkippedCount()
+		// Show region marker summary if requested
+		if config.Regions && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintRegions(w, langStats, total)
+		}
+
+		// Show commented-out code summary if requested
+		if config.CommentedCode && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintCommentedCode(w, langStats, total)
+		}
+
+		// Show test and source code totals if requested
+		if config.SplitTests && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			tests, source := SplitTests(result.FileStats)
+			PrintTestSplit(w, tests, source)
+		}
+
+		// Show the largest file of every language if requested
+		if config.TopFiles && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintTopFiles(w, TopFiles(result.FileStats, RowLanguage(result.LangStats, config.Aliases, config.Groups)), langStats, config.RelativeTo)
+		}
+
+		// Show groups of identical files if requested
+		if config.Duplicates && (config.OutputFormat == "default" || config.OutputFormat == "formatted") {
+			PrintDuplicates(w, FindDuplicates(result.FileStats, config.RelativeTo))
+		}
+		return nil
 	}
 
-	// Calculate elapsed time
-	elapsed := time.Since(startTime)
+	// Widen the language column to the terminal unless writing elsewhere
+	TerminalWidth = 0
+	if config.OutputFile == "" && !config.FixedWidth {
+		TerminalWidth = stdoutTerminalWidth()
+	}
 
-	// Aggregate statistics
-	langStats := AggregateStats(fileStats)
-	total := TotalStats(langStats)
-	errorCount := len(errors)
+	// Write the results to a file if requested
+	if config.OutputFile != "" {
+		if err := writeOutputFile(config.OutputFile, printResults); err != nil {
+			return fmt.Errorf("output file: %w", err)
+		}
+	} else {
+		printResults(os.Stdout)
+	}
+
+	// Write the same results in further formats if requested
+	if len(config.Outputs) > 0 {
+		extra := &Report{Config: config, Result: result, LangStats: langStats, Total: total, JSON: report}
+		if err := WriteExtraOutputs(config.Outputs, extra); err != nil {
+			return err
+		}
+	}
+
+	// Add the counts to a report tallied across runs if requested
+	if config.AccumulateInto != "" {
+		if err := AccumulateReport(config.AccumulateInto, langStats, config.jsonColumns()); err != nil {
+			return fmt.Errorf("accumulate: %w", err)
+		}
+		LogDebug("Added the counts to %s", config.AccumulateInto)
+	}
 
-	// Output results based on format
-	switch config.OutputFormat {
-	case "json":
-		PrintJSON(langStats, total)
-	case "compact":
-		PrintCompact(total)
-	case "formatted":
-		PrintResultsFormatted(langStats, total, processedFiles, skippedFiles, errorCount)
-	default:
-		PrintResults(langStats, total, processedFiles, skippedFiles, errorCount)
+	if result.Sampled {
+		LogWarn("Results are an estimate from a sample of the first %d files", config.SampleFiles)
+	}
+	if result.TimedOut {
+		LogWarn("Counting stopped after --timeout %v, results are partial", config.Timeout)
 	}
 
 	// Show errors if requested
-	if config.ShowErrors && len(errors) > 0 {
-		PrintErrors(errors)
+	if config.ShowErrors && len(errs) > 0 {
+		PrintErrors(errs, errorCount)
+	}
+	if errorCount > len(errs) && (config.ShowErrors || config.IncludeErrors) {
+		LogWarn("Only the first %d of %d errors were kept, see --max-errors", len(errs), errorCount)
 	}
 
-	// Print timing information
-	if !config.Quiet {
-		fmt.Printf("Time elapsed: %v\n", elapsed.Round(time.Millisecond))
+	// Show why files were skipped if requested, listing each one with -v
+	if config.ShowSkipped {
+		PrintSkipped(result.Skipped, config.Verbose)
 	}
 
+	// Log timing information, on stderr so it never mixes with the results
+	LogInfo("Time elapsed: %v", elapsed.Round(time.Millisecond))
+
+	// Log the summary for machine parsing if requested
+	if config.SummaryStderr {
+		LogSummary("processed=%d skipped=%d errors=%d elapsed=%v", result.ProcessedFiles, result.SkippedFiles, errorCount, elapsed.Round(time.Millisecond))
+	}
+
+	// Fail on files without a language mapping if requested
+	if config.StrictLanguages && len(result.UnknownFiles) > 0 {
+		fmt.Fprintln(os.Stderr, "Files with unrecognized languages:")
+		for _, path := range result.UnknownFiles {
+			fmt.Fprintf(os.Stderr, "  %s\n", path)
+		}
+		return fmt.Errorf("%d file(s) with unrecognized languages", len(result.UnknownFiles))
+	}
+
+	if result.TimedOut {
+		return ErrTimeout
+	}
 	return nil
 }
 
 func parseFlags() *Config {
-	config := &Config{}
+	config := &Config{
+		Groups:  make(map[string]string),
+		Aliases: make(map[string]string),
+		Prefer:  make(map[string]string),
+	}
 
 	// Define flags
 	flag.StringVar(&config.Path, "path", ".", "Path to the directory to analyze")
@@ -155,11 +1256,43 @@ func parseFlags() *Config {
 	flag.BoolVar(&config.IncludeHidden, "hidden", false, "Include hidden files and directories")
 	flag.BoolVar(&config.IncludeHidden, "H", false, "Include hidden files and directories (shorthand)")
 
-	flag.StringVar(&config.OutputFormat, "format", "default", "Output format: default, json, compact, formatted")
-	flag.StringVar(&config.OutputFormat, "f", "default", "Output format (shorthand)")
+	flag.StringVar(&config.OutputFormat, "format", DefaultFormat, "Output format: "+strings.Join(FormatNames(), ", "))
+	flag.Func("columns", "Comma-separated columns of csv and tsv output, in order, e.g. \"language,code,total\"", func(value string) (err error) {
+		config.Columns, err = ParseCSVColumns(value)
+		return err
+	})
+	flag.StringVar(&config.OutputFormat, "f", DefaultFormat, "Output format (shorthand)")
+	flag.StringVar(&config.OutputFile, "output-file", "", "Write the results to this file instead of stdout")
+	flag.Func("output", "Also write the results in another format to a file, as format=path; repeatable", func(value string) error {
+		output, err := ParseExtraOutput(value)
+		if err == nil {
+			config.Outputs = append(config.Outputs, output)
+		}
+		return err
+	})
+	flag.Func("also-json", "Also write the results as JSON to this file, like --output json=<path>", func(value string) error {
+		output, err := ParseExtraOutput("json=" + value)
+		if err == nil {
+			config.Outputs = append(config.Outputs, output)
+		}
+		return err
+	})
+	flag.StringVar(&config.AccumulateInto, "accumulate-into", "", "Add the counts to the JSON report in this file, creating it if missing")
+	flag.BoolVar(&config.MergeStdin, "merge-stdin", false, "Add the counts of a JSON report read from stdin to the scanned counts")
 
 	flag.BoolVar(&config.ShowErrors, "errors", false, "Show detailed error messages")
 	flag.BoolVar(&config.ShowErrors, "e", false, "Show detailed error messages (shorthand)")
+	flag.BoolVar(&config.ShowSkipped, "show-skipped", false, "Show how many files were skipped for each reason")
+	flag.BoolVar(&config.SummaryStderr, "summary-stderr", false, "Log the scan summary to stderr as key=value pairs")
+	flag.BoolVar(&config.ProgressDirs, "progress-dirs", false, "Log the files and code lines of every directory once it is counted")
+
+	flag.BoolVar(&config.IncludeErrors, "include-errors", false, "Include collected errors in JSON output")
+	flag.BoolVar(&config.StrictJSON, "strict-json", false, "Check JSON output against the report schema and fail if it does not match")
+	flag.IntVar(&config.MaxErrors, "max-errors", DefaultMaxErrors, "Maximum number of errors kept for --show-errors and --include-errors (0 for all)")
+	flag.BoolVar(&config.Detailed, "detailed", false, "Nest the files of each language in JSON output")
+
+	flag.StringVar(&config.CPUProfile, "cpuprofile", "", "Write a CPU profile of the run to this file")
+	flag.StringVar(&config.MemProfile, "memprofile", "", "Write a heap profile to this file after the run")
 
 	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose output")
 	flag.BoolVar(&config.Verbose, "v", false, "Enable verbose output (shorthand)")
@@ -167,15 +1300,140 @@ func parseFlags() *Config {
 	flag.BoolVar(&config.Quiet, "quiet", false, "Suppress non-essential output")
 	flag.BoolVar(&config.Quiet, "q", false, "Suppress non-essential output (shorthand)")
 
+	flag.BoolVar(&config.PrintConfig, "print-config", false, "Print the effective settings to stderr before the results")
+
 	// Custom exclude directories
 	var excludeDirs string
 	flag.StringVar(&excludeDirs, "exclude", "", "Comma-separated list of directories to exclude")
 	flag.StringVar(&excludeDirs, "x", "", "Comma-separated list of directories to exclude (shorthand)")
 
+	flag.BoolVar(&config.IncludeSubs, "include-submodules", false, "Count git submodules instead of skipping them")
+
+	// Vendored directories
+	var vendorDirs string
+	flag.BoolVar(&config.SkipVendor, "skip-vendor", false, "Skip vendored dependency, virtual environment and build directories")
+	flag.StringVar(&vendorDirs, "vendor-dir", "", "Comma-separated list of further directory names skipped by --skip-vendor")
+
 	// Custom exclude patterns
 	var excludePatterns string
 	flag.StringVar(&excludePatterns, "ignore", "", "Comma-separated list of patterns to exclude files (e.g., \"*_test.go,*.log\")")
 	flag.StringVar(&excludePatterns, "i", "", "Comma-separated list of patterns to exclude files (shorthand)")
+	flag.StringVar(&config.ExcludeFrom, "exclude-from", "", "Read further patterns to exclude files from this file, one per line")
+	flag.StringVar(&config.IncludeFrom, "include-from", "", "Count only files matching a pattern read from this file, one per line")
+	flag.Func("exclude-file", "Skip the file at this exact path, relative to the scan root (repeatable)", func(path string) error {
+		config.ExcludeFiles = append(config.ExcludeFiles, path)
+		return nil
+	})
+	flag.StringVar(&config.ExcludeFileFrom, "exclude-file-from", "", "Read further exact paths of files to skip from this file, one per line")
+
+	// Generic counting of selected extensions
+	var extensions string
+	flag.StringVar(&extensions, "ext", "", "Comma-separated list of extensions to count generically, bypassing language detection (e.g., \".go,.proto\")")
+
+	// Data files reported apart from code
+	var dataExtensions string
+	flag.BoolVar(&config.ExcludeData, "exclude-data", false, "Report data files such as .json, .lock and .min.js under a Data row instead of their language")
+	flag.StringVar(&dataExtensions, "data-ext", "", "Comma-separated list of file suffixes treated as data, replacing the defaults (implies --exclude-data)")
+
+	flag.BoolVar(&config.DetectEmbedded, "detect-embedded", false, "Report string blocks tagged with a language=<name> comment (experimental)")
+
+	flag.BoolVar(&config.ReportIndent, "report-indent", false, "Report how many code lines are indented with tabs, spaces or both")
+	flag.IntVar(&config.TabWidth, "tab-width", DefaultTabWidth, "Columns a tab advances to, for the indent width and fixed-form Fortran")
+
+	// License headers skipped before counting
+	flag.IntVar(&config.IgnoreHeader, "ignore-header", 0, "Skip the first N lines of every file before counting")
+	flag.Func("ignore-header-until", "Skip the lines of every file before the first one matching this regular expression", func(pattern string) (err error) {
+		config.HeaderUntil, err = regexp.Compile(pattern)
+		return err
+	})
+
+	flag.BoolVar(&config.Regions, "regions", false, "Report how many lines are region markers, such as #region in C# or // MARK: in Swift")
+	flag.BoolVar(&config.CountFunctions, "count-functions", false, "Add a Functions column estimating function definitions per language")
+	flag.BoolVar(&config.CommentedCode, "detect-commented-code", false, "Report how many comment lines look like commented-out code")
+	flag.BoolVar(&config.DocComments, "doc-comments", false, "Add DocComment and Doc% columns with the doc comment lines per language")
+	flag.BoolVar(&config.DocCoverage, "doc-coverage", false, "Add a Coverage column and bar with the comment lines over comment and code lines")
+	flag.IntVar(&config.MaxLineLength, "max-line-length", 0, "Add a LongLines column with the code lines longer than this many characters")
+	flag.BoolVar(&config.LogicalLines, "logical-lines", false, "Add a Logical column joining code lines continued by \\ or, in Python, open brackets")
+	flag.BoolVar(&config.SplitTests, "split-tests", false, "Report test code and source code totals and their ratio")
+	flag.BoolVar(&config.Duplicates, "duplicates", false, "Report groups of files with identical content")
+	flag.BoolVar(&config.TopFiles, "top-file-per-language", false, "Report the file with the most code lines of every language")
+
+	flag.BoolVar(&config.ByFile, "by-file", false, "Also report the counts of every file")
+	flag.BoolVar(&config.ByExtension, "by-extension", false, "Also report the counts of every extension within each language")
+	flag.StringVar(&config.RelativeTo, "relative-to", "", "Report per-file paths relative to this directory")
+	flag.StringVar(&config.Label, "label", "", "Name of the scanned project in the output (default: base name of the scan root)")
+
+	flag.IntVar(&config.SampleFiles, "sample-files", 0, "Stop after counting this many files, in sorted path order, for a quick estimate")
+	flag.DurationVar(&config.Timeout, "timeout", 0, "Stop counting after this long, e.g. 30s, print partial results and exit with status 124")
+	flag.DurationVar(&config.PerFileTimeout, "per-file-timeout", 0, "Skip a file with a warning if counting it takes longer than this, e.g. 5s")
+
+	flag.StringVar(&config.CacheDir, "cache-dir", "", "Cache per-file counts in this directory and reuse them for unchanged files")
+
+	flag.StringVar(&config.Sort, "sort", "", "Order languages by: code (default), files, name, comment-ratio")
+	flag.StringVar(&config.NumericFormat, "numeric-format", "", "Render table counts as: "+strings.Join(NumericFormats, ", ")+" (default: grouped for formatted, plain otherwise)")
+
+	flag.BoolVar(&config.NoTruncate, "no-truncate", false, "Show long language names in full, widening the language column")
+	flag.BoolVar(&config.FixedWidth, "fixed-width", false, "Keep the fixed column widths even when stdout is a wide terminal")
+
+	flag.StringVar(&TruncationIndicator, "ellipsis", TruncationIndicator, "Suffix marking a truncated language name, e.g. \"…\"")
+
+	flag.BoolVar(&config.NoBlankCol, "no-blank-col", false, "Omit the Blank column from the table and JSON output")
+	flag.BoolVar(&config.NoCommentCol, "no-comment-col", false, "Omit the Comment column from the table and JSON output")
+	flag.BoolVar(&config.NoHeader, "no-header", false, "Omit the table header and its separators")
+	flag.BoolVar(&config.NoTotal, "no-total", false, "Omit the total row and the summary footer from the table")
+	flag.BoolVar(&config.SplitComments, "split-comments", false, "Add columns splitting comment lines into single-line and block comments")
+	flag.BoolVar(&config.Bars, "bars", false, "Add a bar of '#' characters proportional to the code lines of each language")
+	flag.Func("weights", "Comma-separated weights of the code lines of languages for a Weighted column, e.g. \"Go=1.0,Assembly=2.5,YAML=0.2\"", func(value string) (err error) {
+		config.Weights, err = ParseWeights(value)
+		return err
+	})
+	flag.BoolVar(&config.Bytes, "bytes", false, "Add a column with the size of the counted files per language")
+
+	flag.BoolVar(&config.CodeOnly, "code-only", false, "Skip comment detection and report only code and total lines")
+
+	flag.BoolVar(&config.UseShebang, "use-shebang", false, "Let a #! line pick the language, e.g. Python 2 or Bash, overriding the extension")
+	flag.BoolVar(&config.UseModeline, "use-modeline", false, "Let a Vim or Emacs modeline pick the language, overriding the extension")
+	flag.BoolVar(&config.SniffContent, "sniff-content", false, "Skip files whose content looks binary and count unrecognized text files as Text")
+	flag.BoolVar(&config.SkipEmpty, "skip-empty", false, "Skip zero-byte files instead of counting them as files without lines")
+	flag.BoolVar(&config.FollowSymlinks, "follow-symlinks", false, "Walk into symlinked directories, counting each real file once however many links lead to it")
+
+	flag.BoolVar(&config.StrictLanguages, "strict-languages", false, "Exit with an error listing files whose language is not recognized")
+
+	flag.BoolVar(&config.GitStaged, "git-staged", false, "Count only the files staged in the git repository at the path")
+	flag.StringVar(&config.SinceTag, "since-tag", "", "Report the lines added and removed per language between this git tag and HEAD")
+	flag.StringVar(&config.Clone, "clone", "", "Shallow-clone the git repository at this URL into a temporary directory and count it")
+	flag.StringVar(&config.Manifest, "manifest", "", "File listing the paths to scan, one per line, merged into one result")
+	flag.IntVar(&config.Jobs, "jobs", runtime.NumCPU(), "Number of --manifest paths scanned at once")
+	flag.BoolVar(&config.Separate, "separate", false, "With --manifest, report every path before the combined total")
+
+	// Stdin mode
+	flag.BoolVar(&config.Stdin, "stdin", false, "Count content read from stdin")
+	flag.StringVar(&config.StdinLang, "stdin-lang", "", "Language to count stdin content as (implies --stdin)")
+
+	// Directory comparison
+	diffDirs := flag.Bool("diff-dirs", false, "Compare code lines per language between two directories given as arguments")
+
+	// Language groups
+	flag.Var(groupFlag(config.Groups), "group", "Group languages into a named category, e.g. \"Frontend=JavaScript,TypeScript\" (repeatable)")
+	flag.Func("group-by-regex", "Group files by the first capture group of this regular expression on their path, e.g. \"^services/([^/]+)/\"", func(pattern string) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		if re.NumSubexp() == 0 {
+			return fmt.Errorf("%q has no capture group", pattern)
+		}
+		config.GroupRegex = re
+		return nil
+	})
+
+	// Language aliases
+	flag.Var(preferFlag(config.Prefer), "prefer", "Force the language of ambiguous extensions, e.g. \"h=C++,m=Objective-C\" (repeatable)")
+	flag.Var(aliasFlag(config.Aliases), "alias", "Report a language name under a canonical one, e.g. \"golang=Go\" (repeatable)")
+
+	// Language definitions file, the user's one unless set
+	var languagesFile string
+	flag.StringVar(&languagesFile, "languages-file", "", "Load language definitions from this file instead of the user languages file, or \"none\" to load none")
 
 	// Version flag
 	version := flag.Bool("version", false, "Print version information")
@@ -191,6 +1449,7 @@ func parseFlags() *Config {
 	}
 
 	flag.Parse()
+	config.LanguagesFile = languagesFilePath(languagesFile)
 
 	// Handle version flag
 	if *version || *versionShort {
@@ -209,14 +1468,32 @@ func parseFlags() *Config {
 		config.ExcludeDirs = splitAndTrim(excludeDirs, ",")
 	}
 
+	// Parse vendor directories
+	if vendorDirs != "" {
+		config.VendorDirs = splitAndTrim(vendorDirs, ",")
+	}
+
 	// Parse exclude patterns
 	if excludePatterns != "" {
 		config.ExcludePatterns = splitAndTrim(excludePatterns, ",")
 	}
 
+	// Parse extensions
+	if extensions != "" {
+		config.Extensions = splitAndTrim(extensions, ",")
+	}
+
+	// Parse data extensions
+	if dataExtensions != "" {
+		config.DataExtensions = splitAndTrim(dataExtensions, ",")
+		config.ExcludeData = true
+	}
+
 	// Handle positional argument (path)
 	args := flag.Args()
-	if len(args) > 0 {
+	if *diffDirs {
+		config.DiffDirs = append([]string{}, args...)
+	} else if len(args) > 0 {
 		config.Path = args[0]
 	}
 
@@ -230,15 +1507,112 @@ Usage:
   %s [options] [path]
 
 Options:
-  -p, --path <path>       Path to the directory to analyze (default: current directory)
+  -p, --path <path>       Path to the directory, file or glob to analyze (default: current directory)
   -w, --workers <n>       Number of worker goroutines (default: number of CPUs)
   -H, --hidden            Include hidden files and directories
-  -f, --format <format>   Output format: default, json, compact, formatted
+  -f, --format <format>   Output format: default, json, ndjson, tree-json, prometheus, csv, tsv, compact, lines, formatted
+      --columns <list>    Columns of csv and tsv output, in order (default: all)
+      --output-file <path> Write the results to <path> instead of stdout
+      --output <format>=<path>
+                          Also write the results in <format> to <path>; repeatable
+      --also-json <path>  Also write the results as JSON to <path>, like --output json=<path>
+      --accumulate-into <path>
+                          Add the counts to the JSON report at <path>, creating it if missing
+      --merge-stdin       Add the counts of a JSON report piped on stdin to the scan
   -x, --exclude <dirs>    Comma-separated list of directories to exclude
+      --include-submodules Count git submodules instead of skipping them
+      --skip-vendor       Skip vendored dependency, virtual environment and build directories
+      --vendor-dir <dirs> Comma-separated list of further directories skipped by --skip-vendor
   -i, --ignore <patterns> Comma-separated list of patterns to exclude files
+      --exclude-from <file> Read further patterns to exclude files from <file>, one per line
+      --include-from <file> Count only files matching a pattern read from <file>, one per line
+      --exclude-file <path>
+                          Skip the file at this exact path, relative to the scan root (repeatable)
+      --exclude-file-from <file>
+                          Read further exact paths of files to skip from <file>, one per line
+      --ext <exts>        Count only these extensions, generically, without language detection
+      --exclude-data      Report data files such as .json, .lock and .min.js under a Data row
+      --data-ext <exts>   Comma-separated list of suffixes treated as data (implies --exclude-data)
+      --detect-embedded   Report string blocks tagged with a language=<name> comment
+                          as embedded code (experimental)
+      --report-indent     Report how many code lines are indented with tabs, spaces or both
+      --tab-width <n>     Columns a tab advances to, for the indent width and fixed-form Fortran (default: 8)
+      --ignore-header <n> Skip the first <n> lines of every file before counting
+      --ignore-header-until <regex>
+                          Skip the lines of every file before the first one matching <regex>
+      --regions           Report how many lines are region markers, such as #region or // MARK:
+      --count-functions   Add a Functions column estimating function definitions per language
+      --detect-commented-code
+                          Report how many comment lines look like commented-out code
+      --doc-comments      Add DocComment and Doc%% columns with the doc comment lines per language
+      --doc-coverage      Add a Coverage column and bar with the comment lines over comment and code lines
+      --max-line-length <n>
+                          Add a LongLines column with the code lines longer than <n> characters
+      --logical-lines     Add a Logical column joining code lines continued by \ or, in Python, open brackets
+      --split-tests       Report test and source code totals and their ratio
+      --duplicates        Report groups of files with identical content
+      --top-file-per-language
+                          Report the file with the most code lines of every language
+      --by-file           Also report the counts of every file
+      --by-extension      Also report the counts of every extension within each language
+      --relative-to <dir> Report per-file paths relative to this directory
+      --label <name>      Name of the scanned project in the output (default: base name of the scan root)
+      --sample-files <n>  Stop after counting n files, in sorted path order, for a quick estimate
+      --timeout <d>       Stop counting after duration d, e.g. 30s, print partial results and exit with status 124
+      --per-file-timeout <d>
+                          Skip a file with a warning if counting it takes longer than duration d, e.g. 5s
+      --cache-dir <dir>   Cache per-file counts in <dir> and reuse them for unchanged files
+      --sort <order>      Order languages by: code (default), files, name, comment-ratio
+      --numeric-format <format>
+                          Render table counts as plain, grouped or padded with zeros to the column
+      --no-truncate       Show long language names in full, widening the language column
+      --fixed-width       Keep the fixed column widths even when stdout is a wide terminal
+      --ellipsis <text>   Suffix marking a truncated language name (default: ...)
+      --no-blank-col      Omit the Blank column from the table and JSON output
+      --no-comment-col    Omit the Comment column from the table and JSON output
+      --no-header         Omit the table header and its separators
+      --no-total          Omit the total row and the summary footer from the table
+      --split-comments    Add LineComment and BlockComment columns
+      --bars              Add a bar of '#' proportional to the code lines of each language
+      --weights <spec>    Add a Weighted column of code lines times a weight per language:
+                          Language=weight,... (default weight: 1.0)
+      --bytes             Add a column with the size of the counted files per language
+      --code-only         Skip comment detection and report only code and total lines
+      --use-shebang       Let a #! line pick the language, overriding the extension
+      --use-modeline      Let a Vim or Emacs modeline pick the language, overriding the extension
+      --sniff-content     Skip files whose content looks binary and count unrecognized text files as Text
+      --skip-empty        Skip zero-byte files instead of counting them
+      --follow-symlinks   Walk into symlinked directories, counting each real file once
+      --strict-languages  Exit with an error listing files whose language is not recognized
+      --clone <url>       Shallow-clone a git repository into a temporary directory and count it
+      --git-staged        Count only files staged in git (added, copied or modified)
+      --since-tag <tag>   Report lines added and removed per language since <tag>
+      --manifest <file>   Scan the paths listed in <file>, one per line, and merge the results
+      --jobs <n>          Number of --manifest paths scanned at once (default: number of CPUs)
+      --separate          With --manifest, report every path before the combined total
+      --stdin             Count content read from stdin
+      --stdin-lang <lang> Language to count stdin content as (implies --stdin)
+      --diff-dirs <a> <b> Compare code lines per language between two directories
+      --group <spec>      Group languages into a category: Name=Lang1,Lang2 (repeatable)
+      --group-by-regex <re>
+                          Group files by the first capture group of <re> on their path
+      --prefer <spec>     Force the language of extensions: ext=Language,... (repeatable)
+      --alias <spec>      Report a language under a canonical name: alias=Language (repeatable)
+      --languages-file <file>
+                          Load language definitions from <file> instead of the user languages file ("none" for none)
   -e, --errors            Show detailed error messages
+      --show-skipped      Show how many files were skipped for each reason (with -v, list them)
+      --summary-stderr    Log the scan summary to stderr as key=value pairs
+      --progress-dirs     Log the files and code lines of every directory once it is counted
+      --include-errors    Include collected errors in JSON output
+      --strict-json       Check JSON output against the report schema and fail if it does not match
+      --max-errors <n>    Maximum number of errors kept for --show-errors and --include-errors (default: 5000, 0 for all)
+      --detailed          Nest the files of each language in JSON output
   -v, --verbose           Enable verbose output
   -q, --quiet             Suppress non-essential output
+      --print-config      Print the effective settings to stderr before the results
+      --cpuprofile <file> Write a CPU profile of the run to <file>
+      --memprofile <file> Write a heap profile to <file> after the run
   -V, --version           Print version information
   -h, --help              Print this help message
 
@@ -249,15 +1623,19 @@ Examples:
   %s -w 8 -H .            Use 8 workers and include hidden files
   %s -x "test,docs" .     Exclude test and docs directories
   %s -i "users_*.go,*log" . Exclude files matching patterns
+  cat main.go | %s --stdin-lang Go
+                          Count piped content as Go
+  %s --group "Frontend=JavaScript,TypeScript" .
+                          Report JavaScript and TypeScript as one Frontend row
 
 Supported Languages:
   Go, JavaScript, TypeScript, Python, Java, C, C++, C#, Ruby, PHP,
   Swift, Kotlin, Rust, Scala, HTML, CSS, SCSS, SQL, Shell, YAML,
   JSON, Markdown, XML, Vue, Svelte, Lua, R, Perl, Elixir, Erlang,
   Haskell, Clojure, TOML, INI, Terraform, Protocol Buffers, GraphQL,
-  Assembly
+  Assembly, D
 
-`, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName)
+`, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName, AppName)
 }
 
 func splitAndTrim(s string, sep string) []string {
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestSplitAndTrim(t *testing.T) {
@@ -177,6 +185,14 @@ func TestRun(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Unknown sort order",
+			config: &Config{
+				Path: tmpDir,
+				Sort: "lines",
+			},
+			wantErr: true,
+		},
 		{
 			name: "Show errors",
 			config: &Config{
@@ -206,3 +222,818 @@ func TestPrintUsage(t *testing.T) {
 		t.Errorf("printUsage output missing 'Usage:'")
 	}
 }
+
+func TestGroupFlag(t *testing.T) {
+	groups := make(map[string]string)
+	g := groupFlag(groups)
+
+	if err := g.Set("Frontend=JavaScript, TypeScript"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := g.Set("Systems=C,Rust"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	want := map[string]string{
+		"JavaScript": "Frontend",
+		"TypeScript": "Frontend",
+		"C":          "Systems",
+		"Rust":       "Systems",
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("groups = %v, want %v", groups, want)
+	}
+	if got := g.String(); got != "Frontend=JavaScript,TypeScript;Systems=C,Rust" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, bad := range []string{"Frontend", "=Go", "Frontend=", "Frontend= , "} {
+		if err := g.Set(bad); err == nil {
+			t.Errorf("Set(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestAliasFlag(t *testing.T) {
+	aliases := make(map[string]string)
+	a := aliasFlag(aliases)
+
+	if err := a.Set("golang=Go"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := a.Set(" PY = Python "); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	want := map[string]string{"golang": "Go", "py": "Python"}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("aliases = %v, want %v", aliases, want)
+	}
+	if got := a.String(); got != "golang=Go,py=Python" {
+		t.Errorf("String() = %q", got)
+	}
+
+	for _, bad := range []string{"golang", "=Go", "golang="} {
+		if err := a.Set(bad); err == nil {
+			t.Errorf("Set(%q) expected error, got nil", bad)
+		}
+	}
+}
+
+func TestLogConfig(t *testing.T) {
+	var out bytes.Buffer
+	SetLogLevel(LogLevelInfo)
+	SetLogOutput(&out)
+	defer SetLogOutput(os.Stderr)
+
+	tmpDir := t.TempDir()
+	config := &Config{
+		Path:            tmpDir,
+		Workers:         3,
+		OutputFormat:    "json",
+		ExcludeDirs:     []string{"docs"},
+		ExcludePatterns: []string{"*.log"},
+		Groups:          map[string]string{"Go": "Backend"},
+	}
+	LogConfig(config)
+
+	for _, want := range []string{
+		"[INFO] Effective configuration:",
+		"input: path " + tmpDir,
+		"workers: 3",
+		"excluded dirs: docs",
+		"ignore patterns: *.log",
+		"groups: Backend=Go",
+		"output format: json",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Config dump missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunStrictLanguages(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "data.unknown"), []byte("unknown\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "logo.png"), []byte("binary"), 0644)
+
+	config := &Config{
+		Path:            tmpDir,
+		OutputFormat:    "compact",
+		Quiet:           true,
+		StrictLanguages: true,
+	}
+
+	var err error
+	stderr := captureStderr(func() {
+		captureStdout(func() {
+			err = Run(config)
+		})
+	})
+
+	if err == nil {
+		t.Fatal("Expected an error for a file with an unknown extension")
+	}
+	if !strings.Contains(stderr, filepath.Join(tmpDir, "data.unknown")) {
+		t.Errorf("Expected unknown file to be listed, got %q", stderr)
+	}
+	if strings.Contains(stderr, "logo.png") || strings.Contains(stderr, "main.go") {
+		t.Errorf("Only unrecognized files should be listed, got %q", stderr)
+	}
+
+	config.StrictLanguages = false
+	captureStdout(func() {
+		err = Run(config)
+	})
+	if err != nil {
+		t.Errorf("Run() without --strict-languages error = %v", err)
+	}
+}
+
+func TestRunByFileRelativeTo(t *testing.T) {
+	root := t.TempDir()
+	sub := filepath.Join(root, "services", "api")
+	os.MkdirAll(sub, 0755)
+	os.WriteFile(filepath.Join(sub, "main.go"), []byte("package main\n"), 0644)
+
+	config := &Config{
+		Path:         sub,
+		OutputFormat: "default",
+		Quiet:        true,
+		ByFile:       true,
+		RelativeTo:   root,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	want := filepath.Join("services", "api", "main.go")
+	if !containsRow(output, want, "Go", "0", "0", "1", "1") {
+		t.Errorf("Expected per-file row for %s:\n%s", want, output)
+	}
+}
+
+func TestRunExtensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("// comment\npackage main\n\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "API.PROTO"), []byte("syntax = \"proto3\";\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "script.py"), []byte("x = 1\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.custom"), []byte("a\nb\n"), 0644)
+
+	config := &Config{
+		Path:         tmpDir,
+		OutputFormat: "default",
+		Quiet:        true,
+		Extensions:   []string{".go", "proto"},
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	if !containsRow(output, ".go", "1", "1", "0", "2", "3") {
+		t.Errorf("Expected .go counted generically:\n%s", output)
+	}
+	if !containsRow(output, ".proto", "1", "0", "0", "1", "1") {
+		t.Errorf("Expected .proto row:\n%s", output)
+	}
+	if !containsRow(output, "Total", "2", "1", "0", "3", "4") {
+		t.Errorf("Only the listed extensions should contribute:\n%s", output)
+	}
+
+	config.Path = filepath.Join(tmpDir, "script.py")
+	output = captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "Total", "0", "0", "0", "0", "0") {
+		t.Errorf("A single file with another extension should be skipped:\n%s", output)
+	}
+}
+
+func TestRunSkipVendor(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"main.go", "node_modules/lib/index.js", "venv/lib/site.py", "third_party/dep.go"} {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte("x\n"), 0644)
+	}
+
+	run := func(config *Config) string {
+		config.Path = tmpDir
+		config.OutputFormat = "compact"
+		config.Quiet = true
+		return captureStdout(func() {
+			if err := Run(config); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+		})
+	}
+
+	// node_modules is excluded by default; venv and third_party are not
+	if output := run(&Config{}); !strings.Contains(output, "Files: 3 ") {
+		t.Errorf("Without --skip-vendor, expected main.go, venv and third_party to be counted: %s", output)
+	}
+	if output := run(&Config{SkipVendor: true}); !strings.Contains(output, "Files: 2 ") {
+		t.Errorf("With --skip-vendor, expected node_modules and venv to be skipped: %s", output)
+	}
+	if output := run(&Config{SkipVendor: true, VendorDirs: []string{"third_party"}}); !strings.Contains(output, "Files: 1 ") {
+		t.Errorf("With --vendor-dir third_party, expected only main.go: %s", output)
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	walker.SetExcludeDirs(nil)
+	walker.Walk()
+	if walker.GetLanguageStats()["JavaScript"] == nil {
+		t.Error("Expected node_modules to be counted when no directories are excluded")
+	}
+}
+
+func TestRunExcludeFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"main.go", filepath.Join("gen", "schema.go"), filepath.Join("gen", "keep.go"), filepath.Join("pkg", "main.go")} {
+		os.MkdirAll(filepath.Dir(filepath.Join(tmpDir, name)), 0755)
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("package main\n"), 0644)
+	}
+	listFile := filepath.Join(t.TempDir(), "exclude-files.txt")
+	os.WriteFile(listFile, []byte("# a file in the root only\n./main.go\n"), 0644)
+
+	config := &Config{
+		Path:            tmpDir,
+		OutputFormat:    "default",
+		Quiet:           true,
+		Workers:         1,
+		ByFile:          true,
+		RelativeTo:      tmpDir,
+		ShowSkipped:     true,
+		ExcludeFiles:    []string{"gen//schema.go"},
+		ExcludeFileFrom: listFile,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	for _, name := range []string{"gen/keep.go", "pkg/main.go"} {
+		if !containsRow(output, filepath.FromSlash(name), "Go", "0", "0", "1", "1") {
+			t.Errorf("Expected %s to be counted:\n%s", name, output)
+		}
+	}
+	if !containsRow(output, "excluded", "2") {
+		t.Errorf("Expected main.go and gen/schema.go to be skipped as excluded:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "0", "0", "2", "2") {
+		t.Errorf("Expected 2 Go files counted:\n%s", output)
+	}
+}
+
+func TestRunPatternFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"main.go", "main_test.go", "gen.pb.go", "script.py", "notes.md"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("x\n"), 0644)
+	}
+
+	patternDir := t.TempDir()
+	excludeFile := filepath.Join(patternDir, "exclude.txt")
+	os.WriteFile(excludeFile, []byte("# generated code\n*.pb.go\n\n  *_test.go  \n"), 0644)
+	includeFile := filepath.Join(patternDir, "include.txt")
+	os.WriteFile(includeFile, []byte("*.go\n# and scripts\n*.py\n"), 0644)
+
+	patterns, err := readPatternFile(excludeFile)
+	if err != nil {
+		t.Fatalf("readPatternFile failed: %v", err)
+	}
+	if want := []string{"*.pb.go", "*_test.go"}; !reflect.DeepEqual(patterns, want) {
+		t.Errorf("readPatternFile() = %v, want %v", patterns, want)
+	}
+
+	config := &Config{
+		Path:            tmpDir,
+		OutputFormat:    "default",
+		Quiet:           true,
+		ByFile:          true,
+		RelativeTo:      tmpDir,
+		ExcludePatterns: []string{"script.py"},
+		ExcludeFrom:     excludeFile,
+		IncludeFrom:     includeFile,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "main.go", "Go", "0", "0", "1", "1") {
+		t.Errorf("Expected main.go to be counted:\n%s", output)
+	}
+	for _, name := range []string{"main_test.go", "gen.pb.go", "script.py", "notes.md"} {
+		if strings.Contains(output, name) {
+			t.Errorf("Expected %s to be skipped:\n%s", name, output)
+		}
+	}
+	if want := []string{"script.py", "*.pb.go", "*_test.go"}; !reflect.DeepEqual(config.ExcludePatterns, want) {
+		t.Errorf("ExcludePatterns = %v, want inline patterns followed by the file's %v", config.ExcludePatterns, want)
+	}
+
+	os.WriteFile(excludeFile, []byte("[unclosed\n"), 0644)
+	if err := Run(&Config{Path: tmpDir, Quiet: true, ExcludeFrom: excludeFile}); err == nil {
+		t.Error("Expected an error for an invalid pattern")
+	}
+	if err := Run(&Config{Path: tmpDir, Quiet: true, IncludeFrom: filepath.Join(patternDir, "missing.txt")}); err == nil {
+		t.Error("Expected an error for a missing pattern file")
+	}
+}
+
+func TestRunSingleFile(t *testing.T) {
+	tmpDir := t.TempDir()
+	file := filepath.Join(tmpDir, "main.go")
+	os.WriteFile(file, []byte("package main\n\n// main runs\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "other.go"), []byte("package main\n"), 0644)
+
+	result, err := Scan(&Config{Quiet: true}, file)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if result.ProcessedFiles != 1 || len(result.FileStats) != 1 || result.FileStats[0].FilePath != file {
+		t.Fatalf("Scan(%s) = %d processed, files %+v; want just that file", file, result.ProcessedFiles, result.FileStats)
+	}
+
+	config := &Config{Path: file, OutputFormat: "default", Quiet: true}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "Go", "1", "1", "1", "2", "4") || !containsRow(output, "Total", "1", "1", "1", "2", "4") {
+		t.Errorf("Expected only the given file to be counted:\n%s", output)
+	}
+}
+
+func TestRunNoFilesMatched(t *testing.T) {
+	emptyDir := t.TempDir()
+	filteredDir := t.TempDir()
+	os.WriteFile(filepath.Join(filteredDir, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(filteredDir, "notes.unknown"), []byte("notes\n"), 0644)
+
+	configs := map[string]*Config{
+		"empty directory": {Path: emptyDir},
+		"all filtered":    {Path: filteredDir, ExcludePatterns: []string{"*.go"}},
+		"custom table":    {Path: filteredDir, ExcludePatterns: []string{"*.go"}, CodeOnly: true},
+	}
+	for name, config := range configs {
+		for _, format := range []string{"default", "formatted"} {
+			config.OutputFormat = format
+			config.Quiet = true
+			var err error
+			output := captureStdout(func() {
+				err = Run(config)
+			})
+			if err != nil {
+				t.Errorf("%s, %s: Run() error = %v", name, format, err)
+			}
+			if !strings.Contains(output, noFilesMatched) {
+				t.Errorf("%s, %s: expected %q in output:\n%s", name, format, noFilesMatched, output)
+			}
+			if !strings.Contains(output, "Total ") {
+				t.Errorf("%s, %s: expected an all-zero Total row:\n%s", name, format, output)
+			}
+		}
+	}
+
+	var report struct {
+		Total struct {
+			Files *int `json:"files"`
+		} `json:"total"`
+	}
+	output := captureStdout(func() {
+		if err := Run(&Config{Path: emptyDir, OutputFormat: "json", Quiet: true}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Invalid JSON for an empty directory: %v\n%s", err, output)
+	}
+	if report.Total.Files == nil || *report.Total.Files != 0 {
+		t.Errorf("Expected a total of 0 files: %s", output)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%02d.go", i)), []byte("package main\n"), 0644)
+	}
+
+	// Simulate a slow file system
+	defer func() { countFile = CountLinesContext }()
+	countFile = func(ctx context.Context, path string, lang *Language, opts CountOptions) (*FileStats, error) {
+		time.Sleep(50 * time.Millisecond)
+		return CountLinesContext(ctx, path, lang, opts)
+	}
+
+	config := &Config{
+		Path:         tmpDir,
+		OutputFormat: "json",
+		Quiet:        true,
+		Workers:      1,
+		Timeout:      200 * time.Millisecond,
+	}
+	var err error
+	output := captureStdout(func() {
+		err = Run(config)
+	})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Run() error = %v, want %v", err, ErrTimeout)
+	}
+
+	var report struct {
+		Total struct {
+			Files int `json:"files"`
+		} `json:"total"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Partial results are not valid JSON: %v\n%s", err, output)
+	}
+	if report.Total.Files == 0 || report.Total.Files >= 20 {
+		t.Errorf("Expected partial results counting some of the 20 files, got %d", report.Total.Files)
+	}
+}
+
+// slowReader yields a line of Go code every delay until stop is closed,
+// counting its reads in reads if set
+type slowReader struct {
+	delay time.Duration
+	stop  chan struct{}
+	reads *atomic.Int64
+}
+
+func (r slowReader) Read(p []byte) (int, error) {
+	if r.reads != nil {
+		r.reads.Add(1)
+	}
+	select {
+	case <-r.stop:
+		return 0, io.EOF
+	case <-time.After(r.delay):
+		return copy(p, "x := 1\n"), nil
+	}
+}
+
+func TestRunLabel(t *testing.T) {
+	tmpDir := filepath.Join(t.TempDir(), "billing-service")
+	os.Mkdir(tmpDir, 0755)
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+
+	project := func(config *Config) string {
+		var err error
+		output := captureStdout(func() {
+			err = Run(config)
+		})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		var report struct {
+			Project string `json:"project"`
+		}
+		if err := json.Unmarshal([]byte(output), &report); err != nil {
+			t.Fatalf("Invalid JSON: %v\n%s", err, output)
+		}
+		return report.Project
+	}
+
+	if got := project(&Config{Path: tmpDir, OutputFormat: "json", Quiet: true, StrictJSON: true, Label: "billing"}); got != "billing" {
+		t.Errorf("project = %q, want %q", got, "billing")
+	}
+	if got := project(&Config{Path: tmpDir, OutputFormat: "json", Quiet: true}); got != "billing-service" {
+		t.Errorf("project = %q, want the base name of the scan root %q", got, "billing-service")
+	}
+
+	output := captureStdout(func() {
+		Run(&Config{Path: tmpDir, OutputFormat: "default", Quiet: true, Label: "billing"})
+	})
+	if !strings.Contains(output, "Project: billing\n") {
+		t.Errorf("Expected the label above the table:\n%s", output)
+	}
+}
+
+func TestRunTopFilePerLanguage(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":   "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+		"util.go":   "package main\n",
+		"script.py": "print(1)\nprint(2)\n",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644)
+	}
+
+	config := &Config{
+		Path:         tmpDir,
+		OutputFormat: "default",
+		Workers:      1,
+		TopFiles:     true,
+		RelativeTo:   tmpDir,
+	}
+	var err error
+	output := captureStdout(func() {
+		err = Run(config)
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !strings.Contains(output, "Top file per language:") {
+		t.Fatalf("Expected the top files section:\n%s", output)
+	}
+	section := output[strings.Index(output, "Top file per language:"):]
+	for _, want := range [][]string{{"Go", "4", "main.go"}, {"Python", "2", "script.py"}} {
+		if !containsRow(section, want...) {
+			t.Errorf("Expected row %v in:\n%s", want, section)
+		}
+	}
+	if strings.Contains(section, "util.go") {
+		t.Errorf("Only the largest Go file should be listed:\n%s", section)
+	}
+}
+
+func TestRunPerFileTimeout(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"a.go", "huge.go", "z.go"} {
+		os.WriteFile(filepath.Join(tmpDir, name), []byte("package main\n"), 0644)
+	}
+
+	// Reading huge.go would take far longer than the budget
+	stop := make(chan struct{})
+	defer close(stop)
+	var reads atomic.Int64
+	defer func() { countFile = CountLinesContext }()
+	countFile = func(ctx context.Context, path string, lang *Language, opts CountOptions) (*FileStats, error) {
+		if filepath.Base(path) == "huge.go" {
+			slow := slowReader{delay: 10 * time.Millisecond, stop: stop, reads: &reads}
+			return CountReader(contextReader{ctx: ctx, r: slow}, path, lang, opts)
+		}
+		return CountLinesContext(ctx, path, lang, opts)
+	}
+
+	var logs bytes.Buffer
+	SetLogLevel(LogLevelInfo)
+	SetLogErrorOutput(&logs)
+	defer SetLogErrorOutput(os.Stderr)
+
+	for _, workers := range []int{1, 4} {
+		logs.Reset()
+		config := &Config{
+			Path:           tmpDir,
+			OutputFormat:   "compact",
+			Workers:        workers,
+			PerFileTimeout: 100 * time.Millisecond,
+			ShowSkipped:    true,
+		}
+		start := time.Now()
+		var err error
+		output := captureStdout(func() {
+			err = Run(config)
+		})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Run took %v, the slow file should be given up after 100ms", elapsed)
+		}
+		if !strings.Contains(output, "Files: 2 |") || !strings.Contains(output, "timed out") {
+			t.Errorf("Expected 2 files counted and 1 timed out:\n%s", output)
+		}
+		if !strings.Contains(logs.String(), "Skipping "+filepath.Join(tmpDir, "huge.go")+": counting took longer than 100ms") {
+			t.Errorf("Expected a warning for the slow file:\n%s", logs.String())
+		}
+
+		// The abandoned count stops at its next read rather than going on
+		time.Sleep(50 * time.Millisecond)
+		before := reads.Load()
+		time.Sleep(100 * time.Millisecond)
+		if after := reads.Load(); after != before {
+			t.Errorf("The slow file was read %d more times after the timeout", after-before)
+		}
+	}
+}
+
+func TestScanFilesMaxErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	var paths []string
+	for i := 0; i < 25; i++ {
+		paths = append(paths, filepath.Join(tmpDir, fmt.Sprintf("missing%02d.go", i)))
+	}
+
+	SetLogLevel(LogLevelSilent)
+	defer SetLogLevel(LogLevelInfo)
+	result, err := ScanFiles(&Config{MaxErrors: 10}, paths)
+	if err != nil {
+		t.Fatalf("ScanFiles() error = %v", err)
+	}
+	if len(result.Errors) != 10 {
+		t.Errorf("Kept %d errors, want 10", len(result.Errors))
+	}
+	if result.ErrorCount != 25 {
+		t.Errorf("ErrorCount = %d, want 25", result.ErrorCount)
+	}
+
+	report := NewJSONReport(result.LangStats, TotalStats(result.LangStats), JSONColumns{})
+	report.AddErrors(result.Errors, result.ErrorCount)
+	if len(report.Errors) != 10 || report.ErrorsOmitted != 15 {
+		t.Errorf("JSON report lists %d errors and omits %d, want 10 and 15", len(report.Errors), report.ErrorsOmitted)
+	}
+}
+
+func TestRunProfiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	cpuProfile := filepath.Join(t.TempDir(), "cpu.pprof")
+	memProfile := filepath.Join(t.TempDir(), "mem.pprof")
+
+	captureStdout(func() {
+		err := Run(&Config{Path: tmpDir, OutputFormat: "compact", Quiet: true, CPUProfile: cpuProfile, MemProfile: memProfile})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	for _, path := range []string{cpuProfile, memProfile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("Profile not written: %v", err)
+		} else if info.Size() == 0 {
+			t.Errorf("Profile %s is empty", path)
+		}
+	}
+
+	err := Run(&Config{Path: tmpDir, CPUProfile: filepath.Join(tmpDir, "missing", "cpu.pprof")})
+	if err == nil {
+		t.Error("Expected an error for an unwritable CPU profile path")
+	}
+}
+
+func TestRunSummaryStderr(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "notes.unknown"), []byte("notes\n"), 0644)
+
+	var errOut bytes.Buffer
+	SetLogLevel(LogLevelInfo)
+	SetLogErrorOutput(&errOut)
+	defer SetLogErrorOutput(os.Stderr)
+
+	config := &Config{Path: tmpDir, OutputFormat: "json", SummaryStderr: true}
+	captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	line := strings.TrimSpace(errOut.String())
+	if !strings.HasPrefix(line, "processed=1 skipped=1 errors=0 elapsed=") || strings.Contains(line, "\n") {
+		t.Fatalf("Expected a single key=value summary line, got %q", errOut.String())
+	}
+	elapsed := strings.TrimPrefix(line, "processed=1 skipped=1 errors=0 elapsed=")
+	if _, err := time.ParseDuration(elapsed); err != nil {
+		t.Errorf("elapsed=%q is not a duration: %v", elapsed, err)
+	}
+}
+
+func TestRunManifest(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"api", "web"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+	}
+	os.WriteFile(filepath.Join(root, "api", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(root, "web", "app.js"), []byte("// app\nconsole.log(1);\n"), 0644)
+	os.WriteFile(filepath.Join(root, "web", "util.go"), []byte("package web\n"), 0644)
+	// Not listed, so not counted
+	os.WriteFile(filepath.Join(root, "other.go"), []byte("package other\n"), 0644)
+
+	manifest := filepath.Join(root, "manifest.txt")
+	os.WriteFile(manifest, []byte("# subprojects\napi\n\n"+filepath.Join(root, "web")+"\n"), 0644)
+
+	paths, err := ReadManifest(manifest)
+	if err != nil {
+		t.Fatalf("ReadManifest() error = %v", err)
+	}
+	if want := []string{filepath.Join(root, "api"), filepath.Join(root, "web")}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("ReadManifest() = %v, want %v", paths, want)
+	}
+
+	config := &Config{Manifest: manifest, Jobs: 2, OutputFormat: "default", Quiet: true}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "Go", "2", "1", "0", "3", "4") || !containsRow(output, "Total", "3", "1", "1", "4", "6") {
+		t.Errorf("Expected the listed paths to be merged:\n%s", output)
+	}
+	if strings.Contains(output, "Path:") {
+		t.Errorf("Expected no per-path sections without --separate:\n%s", output)
+	}
+
+	config = &Config{Manifest: manifest, Jobs: 2, Separate: true, OutputFormat: "default", Quiet: true}
+	output = captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	api := strings.Index(output, "Path: "+filepath.Join(root, "api"))
+	web := strings.Index(output, "Path: "+filepath.Join(root, "web"))
+	all := strings.Index(output, "All paths:")
+	if api < 0 || web < api || all < web {
+		t.Fatalf("Expected a section per path, then the combined total:\n%s", output)
+	}
+	if !containsRow(output[api:web], "Total", "1", "1", "0", "2", "3") || !containsRow(output[web:all], "Total", "2", "0", "1", "2", "3") {
+		t.Errorf("Expected the counts of each path in its section:\n%s", output)
+	}
+	if !containsRow(output[all:], "Total", "3", "1", "1", "4", "6") {
+		t.Errorf("Expected the combined total last:\n%s", output)
+	}
+
+	if err := Run(&Config{Separate: true, Quiet: true}); err == nil {
+		t.Error("Expected --separate without --manifest to fail")
+	}
+}
+
+func TestRunWeights(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "ci.yaml"), []byte("a: 1\nb: 2\nc: 3\nd: 4\ne: 5\n"), 0644)
+
+	weights, _ := ParseWeights("YAML=0.2,Go=2")
+	for _, format := range []string{"default", "formatted"} {
+		output := captureStdout(func() {
+			if err := Run(&Config{Path: tmpDir, OutputFormat: format, Weights: weights, Quiet: true}); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+		})
+		if !containsRow(output, "Language", "Files", "Blank", "Comment", "Code", "Total", "Weighted") ||
+			!containsRow(output, "Go", "1", "1", "0", "2", "3", "4.0") ||
+			!containsRow(output, "YAML", "1", "0", "0", "5", "5", "1.0") ||
+			!containsRow(output, "Total", "2", "1", "0", "7", "8", "5.0") {
+			t.Errorf("%s: expected a Weighted column and weighted total:\n%s", format, output)
+		}
+	}
+}
+
+func TestRunExtraOutputs(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\n// main runs\nfunc main() {}\n"), 0644)
+	jsonFile := filepath.Join(t.TempDir(), "loc.json")
+	csvFile := filepath.Join(t.TempDir(), "loc.csv")
+
+	config := &Config{
+		Path:         dir,
+		OutputFormat: "default",
+		Quiet:        true,
+		Outputs:      []ExtraOutput{{Format: "json", File: jsonFile}, {Format: "csv", File: csvFile}},
+	}
+	var err error
+	output := captureStdout(func() {
+		err = Run(config)
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if !containsRow(output, "Go", "1", "1", "1", "2", "4") {
+		t.Errorf("Expected the table on stdout:\n%s", output)
+	}
+
+	data, err := os.ReadFile(jsonFile)
+	if err != nil {
+		t.Fatalf("JSON output not written: %v", err)
+	}
+	var report JSONReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, data)
+	}
+	if report.Total.Code != 2 || report.Total.Comment == nil || *report.Total.Comment != 1 {
+		t.Errorf("JSON total = %+v, want 2 code and 1 comment lines", report.Total)
+	}
+
+	data, err = os.ReadFile(csvFile)
+	if err != nil {
+		t.Fatalf("CSV output not written: %v", err)
+	}
+	if !strings.Contains(string(data), "Go,1,1,1,2,4") {
+		t.Errorf("Expected the Go row in the CSV output:\n%s", data)
+	}
+}
+
+func TestParseExtraOutput(t *testing.T) {
+	output, err := ParseExtraOutput("json=out/loc.json")
+	if err != nil || output != (ExtraOutput{Format: "json", File: "out/loc.json"}) {
+		t.Errorf("ParseExtraOutput() = %+v, %v", output, err)
+	}
+	for _, value := range []string{"json", "=loc.json", "json=", "xml=loc.xml"} {
+		if _, err := ParseExtraOutput(value); err == nil {
+			t.Errorf("ParseExtraOutput(%q) succeeded, want an error", value)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ReadManifest reads the paths listed in the manifest file at path, one per
+// line. Blank lines and lines starting with # are ignored, and relative
+// paths are taken relative to the directory of the manifest.
+func ReadManifest(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(path), line)
+		}
+		paths = append(paths, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("%s lists no paths", path)
+	}
+	return paths, nil
+}
+
+// ScanManifest scans every path, up to config.Jobs of them at a time, and
+// returns their results in the order of paths. It fails with the error of
+// the first path that could not be scanned.
+func ScanManifest(config *Config, paths []string) ([]*ScanResult, error) {
+	jobs := config.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if config.CacheDir != "" && jobs > 1 {
+		// Every scan saves the whole cache, so concurrent scans would drop
+		// each other's entries
+		LogDebug("Scanning the manifest paths one at a time to share --cache-dir")
+		jobs = 1
+	}
+
+	results := make([]*ScanResult, len(paths))
+	errs := make([]error, len(paths))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, path := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			LogDebug("Scanning manifest path %s", path)
+			results[i], errs[i] = Scan(config, path)
+		}()
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+	return results, nil
+}
+
+// MergeScanResults combines the results of several scans into one, as if
+// their files had been found by a single scan
+func MergeScanResults(results []*ScanResult, maxErrors int) *ScanResult {
+	merged := &ScanResult{
+		LangStats: make(map[string]*LanguageStats),
+		Embedded:  make(map[string]int),
+	}
+	for _, result := range results {
+		merged.FileStats = append(merged.FileStats, result.FileStats...)
+		for lang, stats := range result.LangStats {
+			if _, ok := merged.LangStats[lang]; !ok {
+				merged.LangStats[lang] = &LanguageStats{Language: stats.Language}
+			}
+			merged.LangStats[lang].Add(stats)
+		}
+		for lang, lines := range result.Embedded {
+			merged.Embedded[lang] += lines
+		}
+		for _, err := range result.Errors {
+			merged.addError(err, maxErrors)
+		}
+		// Errors that were counted but not kept
+		merged.ErrorCount += result.ErrorCount - len(result.Errors)
+		merged.ProcessedFiles += result.ProcessedFiles
+		merged.SkippedFiles += result.SkippedFiles
+		merged.UnknownFiles = append(merged.UnknownFiles, result.UnknownFiles...)
+		merged.Skipped = append(merged.Skipped, result.Skipped...)
+		merged.CachedFiles += result.CachedFiles
+		merged.Sampled = merged.Sampled || result.Sampled
+		merged.TimedOut = merged.TimedOut || result.TimedOut
+	}
+	sortSkippedFiles(merged.Skipped)
+	return merged
+}
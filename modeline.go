@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+)
+
+// modelineLines is how many lines at the start and at the end of a file are
+// searched for a modeline, matching the default of Vim's 'modelines' option
+const modelineLines = 5
+
+// ModelineLanguages maps Vim filetypes and Emacs modes whose name differs
+// from both the language name and its file extension
+var ModelineLanguages = map[string]*Language{
+	"c++":          Languages[".cpp"],
+	"javascript":   Languages[".js"],
+	"typescript":   Languages[".ts"],
+	"csharp":       Languages[".cs"],
+	"perl":         Languages[".pl"],
+	"shell-script": Languages[".sh"],
+	"bash":         Languages[".sh"],
+	"zsh":          Languages[".sh"],
+	"make":         FilenameLanguages["Makefile"],
+	"dockerfile":   FilenameLanguages["Dockerfile"],
+	"terraform":    Languages[".tf"],
+}
+
+var (
+	// emacsModeline matches "-*- mode: python -*-" and "-*- python -*-"
+	emacsModeline = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+
+	// vimModeline matches "vim: set ft=go:" and "vi: filetype=python"
+	vimModeline = regexp.MustCompile(`(?:^|\s)(?:vi|vim|ex)(?:[<=>]?\d+)?:\s*(.*)`)
+
+	// vimFiletype matches the filetype option of a Vim modeline
+	vimFiletype = regexp.MustCompile(`(?:^|[\s:])(?:ft|filetype|syn|syntax)=([\w+.-]+)`)
+)
+
+// ParseModeline returns the Vim filetype or Emacs mode declared by line, or
+// "" if line holds no modeline
+func ParseModeline(line string) string {
+	if m := emacsModeline.FindStringSubmatch(line); m != nil {
+		vars := m[1]
+		if !strings.Contains(vars, ":") {
+			// The whole line is the mode: -*- python -*-
+			return strings.ToLower(vars)
+		}
+		for _, v := range strings.Split(vars, ";") {
+			key, value, ok := strings.Cut(v, ":")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "mode") {
+				return strings.ToLower(strings.TrimSpace(value))
+			}
+		}
+		return ""
+	}
+
+	if m := vimModeline.FindStringSubmatch(line); m != nil {
+		if ft := vimFiletype.FindStringSubmatch(m[1]); ft != nil {
+			return strings.ToLower(ft[1])
+		}
+	}
+	return ""
+}
+
+// GetLanguageByModeline returns the language for a Vim filetype or Emacs
+// mode. Names are looked up in ModelineLanguages, then as a language name,
+// then as a file extension, so "python", "Go" and "rs" all resolve.
+func GetLanguageByModeline(mode string) *Language {
+	mode = strings.TrimSuffix(strings.ToLower(mode), "-mode")
+	if mode == "" {
+		return nil
+	}
+	if lang, ok := ModelineLanguages[mode]; ok {
+		return lang
+	}
+	if lang := GetLanguageByName(mode); lang != nil {
+		return lang
+	}
+	return GetLanguage("." + mode)
+}
+
+// DetectModeline returns the language declared by a modeline in the first
+// or last modelineLines lines of the file at path, or nil if there is none
+func DetectModeline(path string) *Language {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var tail []string
+	scanner := newLineScanner(file)
+	for n := 0; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n < modelineLines {
+			if lang := GetLanguageByModeline(ParseModeline(line)); lang != nil {
+				return lang
+			}
+			continue
+		}
+		tail = append(tail, line)
+		if len(tail) > modelineLines {
+			tail = tail[1:]
+		}
+	}
+
+	for _, line := range tail {
+		if lang := GetLanguageByModeline(ParseModeline(line)); lang != nil {
+			return lang
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseModeline(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"# -*- mode: python -*-", "python"},
+		{"// -*- Mode: C++; tab-width: 4 -*-", "c++"},
+		{";; -*- emacs-lisp -*-", "emacs-lisp"},
+		{"# -*- coding: utf-8 -*-", ""},
+		{"// vim: set ft=go:", "go"},
+		{"# vim: filetype=python ts=4", "python"},
+		{"/* vi: set sw=2 syntax=javascript: */", "javascript"},
+		{"# vim600: set ft=sh :", "sh"},
+		{"# ex: ft=ruby", "ruby"},
+		{"// vim: set ts=4 sw=4:", ""},
+		{"let vim = 1; // ft=go", ""},
+		{"package main", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseModeline(tt.line); got != tt.want {
+			t.Errorf("ParseModeline(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGetLanguageByModeline(t *testing.T) {
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"python", "Python"},
+		{"Go", "Go"},
+		{"rs", "Rust"},
+		{"c++", "C++"},
+		{"js-mode", "JavaScript"},
+		{"shell-script", "Shell"},
+		{"make", "Makefile"},
+		{"cobol", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if lang := GetLanguageByModeline(tt.mode); lang != nil {
+			got = lang.Name
+		}
+		if got != tt.want {
+			t.Errorf("GetLanguageByModeline(%q) = %q, want %q", tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDetectModeline(t *testing.T) {
+	dir := t.TempDir()
+	middle := strings.Repeat("x = 1\n", 20)
+	files := map[string]string{
+		"emacs.txt":  "#!/bin/sh\n# -*- mode: python -*-\n" + middle,
+		"vim.txt":    middle + "// vim: set ft=go:\n",
+		"buried.txt": middle + "// vim: set ft=go:\n" + middle,
+		"none.txt":   middle,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	want := map[string]string{"emacs.txt": "Python", "vim.txt": "Go", "buried.txt": "", "none.txt": ""}
+	for name, lang := range want {
+		got := ""
+		if detected := DetectModeline(filepath.Join(dir, name)); detected != nil {
+			got = detected.Name
+		}
+		if got != lang {
+			t.Errorf("DetectModeline(%s) = %q, want %q", name, got, lang)
+		}
+	}
+
+	walker := NewWalker(dir, 2)
+	walker.SetUseModeline(true)
+	walker.Walk()
+	langStats := walker.GetLanguageStats()
+	if langStats["Python"] == nil || langStats["Go"] == nil || langStats["Text"].FileCount != 2 {
+		t.Errorf("Expected modelines to override the .txt extension, got %v", langStats)
+	}
+}
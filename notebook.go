@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrMalformedNotebook is returned when a .ipynb file is not a valid notebook
+var ErrMalformedNotebook = errors.New("malformed notebook")
+
+// notebook is the subset of the Jupyter notebook format needed for counting
+type notebook struct {
+	Cells    []notebookCell `json:"cells"`
+	Metadata struct {
+		Kernelspec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+}
+
+// notebookCell is a single notebook cell. Source is either a string or a
+// list of lines.
+type notebookCell struct {
+	CellType string          `json:"cell_type"`
+	Source   json.RawMessage `json:"source"`
+}
+
+// text returns the cell source as a single string
+func (c notebookCell) text() (string, error) {
+	if len(c.Source) == 0 {
+		return "", nil
+	}
+
+	var s string
+	if err := json.Unmarshal(c.Source, &s); err == nil {
+		return s, nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(c.Source, &lines); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, ""), nil
+}
+
+// kernelLanguage returns the language the notebook's code cells are written
+// in, defaulting to Python
+func (nb *notebook) kernelLanguage() *Language {
+	name := nb.Metadata.Kernelspec.Language
+	if name == "" {
+		name = nb.Metadata.LanguageInfo.Name
+	}
+	if name == "" {
+		name = "Python"
+	}
+
+	if lang := GetLanguageByName(name); lang != nil {
+		return lang
+	}
+	return &Language{Name: name}
+}
+
+// CountNotebook counts a Jupyter notebook. Code cells are counted with the
+// comment rules of the kernel language and markdown cells count as comments;
+// raw cells are ignored. The result is reported under the kernel language.
+func CountNotebook(filePath string, opts CountOptions) (*FileStats, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedNotebook, err)
+	}
+
+	// A notebook has no header to skip, and cells must not each lose theirs
+	opts.IgnoreHeader, opts.IgnoreHeaderUntil = 0, nil
+
+	lang := nb.kernelLanguage()
+	stats := &FileStats{
+		FilePath: filePath,
+		Language: lang.Name,
+	}
+
+	for i, cell := range nb.Cells {
+		src, err := cell.text()
+		if err != nil {
+			return nil, fmt.Errorf("%w: cell %d: %v", ErrMalformedNotebook, i, err)
+		}
+
+		switch cell.CellType {
+		case "code":
+			cellStats, err := CountReader(strings.NewReader(src), filePath, lang, opts)
+			if err != nil {
+				return nil, err
+			}
+			stats.Add(cellStats)
+		case "markdown":
+			if src == "" {
+				continue
+			}
+			for _, line := range strings.Split(strings.TrimSuffix(src, "\n"), "\n") {
+				stats.TotalLines++
+				if isBlankLine(line) {
+					stats.BlankLines++
+				} else if opts.CodeOnly {
+					stats.CodeLines++
+				} else {
+					// A markdown cell is a block of prose
+					stats.CommentLines++
+					stats.BlockCommentLines++
+				}
+			}
+		}
+	}
+
+	// The size is that of the notebook file, not of the cell sources
+	stats.Bytes = int64(len(data))
+	return stats, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testNotebook = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": ["# Analysis\n", "\n", "Load the data first."]
+  },
+  {
+   "cell_type": "code",
+   "metadata": {},
+   "source": ["# load\n", "import pandas as pd\n", "\n", "df = pd.read_csv('data.csv')"]
+  },
+  {
+   "cell_type": "code",
+   "metadata": {},
+   "source": "df.head()\n"
+  },
+  {
+   "cell_type": "raw",
+   "metadata": {},
+   "source": ["ignored\n"]
+  }
+ ],
+ "metadata": {
+  "kernelspec": {"name": "python3", "language": "python"}
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}`
+
+func TestCountNotebook(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "notebook-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	filePath := filepath.Join(tmpDir, "analysis.ipynb")
+	if err := os.WriteFile(filePath, []byte(testNotebook), 0644); err != nil {
+		t.Fatalf("Failed to create notebook: %v", err)
+	}
+
+	stats, err := CountLines(filePath, Languages[".ipynb"])
+	if err != nil {
+		t.Fatalf("CountLines failed: %v", err)
+	}
+
+	if stats.Language != "Python" {
+		t.Errorf("Language = %q, want %q", stats.Language, "Python")
+	}
+	// Markdown: 2 comment + 1 blank; code: 1 comment + 3 code + 1 blank
+	if stats.CommentLines != 3 {
+		t.Errorf("CommentLines = %d, want 3", stats.CommentLines)
+	}
+	if stats.CodeLines != 3 {
+		t.Errorf("CodeLines = %d, want 3", stats.CodeLines)
+	}
+	if stats.BlankLines != 2 {
+		t.Errorf("BlankLines = %d, want 2", stats.BlankLines)
+	}
+	if stats.TotalLines != 8 {
+		t.Errorf("TotalLines = %d, want 8", stats.TotalLines)
+	}
+}
+
+func TestCountNotebookKernelLanguage(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "notebook-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tests := []struct {
+		name     string
+		content  string
+		wantLang string
+	}{
+		{"No metadata", `{"cells": [], "metadata": {}}`, "Python"},
+		{"Language info", `{"cells": [], "metadata": {"language_info": {"name": "R"}}}`, "R"},
+		{"Unknown kernel", `{"cells": [], "metadata": {"kernelspec": {"language": "julia"}}}`, "julia"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(tmpDir, "nb.ipynb")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create notebook: %v", err)
+			}
+			stats, err := CountNotebook(filePath, CountOptions{})
+			if err != nil {
+				t.Fatalf("CountNotebook failed: %v", err)
+			}
+			if stats.Language != tt.wantLang {
+				t.Errorf("Language = %q, want %q", stats.Language, tt.wantLang)
+			}
+		})
+	}
+}
+
+func TestWalkerSkipsMalformedNotebook(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "notebook-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	os.WriteFile(filepath.Join(tmpDir, "good.ipynb"), []byte(testNotebook), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "bad.ipynb"), []byte(`{"cells": [`), 0644)
+
+	SetLogLevel(LogLevelSilent)
+	defer SetLogLevel(LogLevelInfo)
+
+	walker := NewWalker(tmpDir, 2)
+	stats, errs := walker.Walk()
+
+	if len(errs) != 0 {
+		t.Errorf("Malformed notebook should be skipped, not reported: %v", errs)
+	}
+	if len(stats) != 1 {
+		t.Errorf("Expected 1 counted notebook, got %d", len(stats))
+	}
+	if walker.GetSkippedCount() != 1 {
+		t.Errorf("SkippedCount = %d, want 1", walker.GetSkippedCount())
+	}
+}
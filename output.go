@@ -2,8 +2,13 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -14,79 +19,231 @@ const (
 	colComment  = 12
 	colCode     = 12
 	colTotal    = 12
+	colBytes    = 12
+	colBars     = 20 // width of the longest --bars bar
+	colCoverage = 10 // width of a full --doc-coverage bar
 )
 
-// PrintResults prints the results in a formatted table
-func PrintResults(langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
-	// Print header
-	printHeader()
+// defaultColumns are the numeric columns printed by printHeader and printCells
+var defaultColumns = []struct {
+	header string
+	width  int
+}{
+	{"Files", colFiles},
+	{"Blank", colBlank},
+	{"Comment", colComment},
+	{"Code", colCode},
+	{"Total", colTotal},
+}
+
+// defaultColumnWidths returns the widths of defaultColumns
+func defaultColumnWidths() []int {
+	widths := make([]int, len(defaultColumns))
+	for i, col := range defaultColumns {
+		widths[i] = col.width
+	}
+	return widths
+}
+
+// cellWidths returns the widths of defaultColumns widened to fit the cells of
+// every language and of the total row, as returned by cells, so the columns
+// stay aligned when a count has more digits than its column
+func cellWidths(langStats map[string]*LanguageStats, total *LanguageStats, cells func(*LanguageStats) []string) []int {
+	widths := defaultColumnWidths()
+	fit := func(stats *LanguageStats) {
+		for i, cell := range cells(stats) {
+			widths[i] = max(widths[i], utf8.RuneCountInString(cell))
+		}
+	}
+	for _, stats := range langStats {
+		fit(stats)
+	}
+	fit(total)
+	return widths
+}
+
+// tableWidth returns the width of a table row made of columns of the given
+// widths separated by single spaces
+func tableWidth(widths ...int) int {
+	width := len(widths) - 1
+	for _, w := range widths {
+		width += w
+	}
+	return max(width, 0)
+}
 
+// noFilesMatched takes the place of the language rows of a table when no
+// file was counted
+const noFilesMatched = "No files matched"
+
+// PrintResults prints the results in a formatted table
+func PrintResults(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
 	// Sort languages by code lines (descending)
 	sortedLangs := sortLanguagesByCode(langStats)
+	widths := cellWidths(langStats, total, plainCells)
+	langWidth := languageColumnWidth(sortedLangs, widths...)
+
+	// Print header
+	printHeader(w, langWidth, widths)
 
 	// Print each language row
+	if len(sortedLangs) == 0 {
+		fmt.Fprintln(w, noFilesMatched)
+	}
 	for _, lang := range sortedLangs {
 		stats := langStats[lang]
-		printRow(stats.Language, stats.FileCount, stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines)
+		printCells(w, langWidth, widths, truncateLanguage(stats.Language, langWidth), plainCells(stats))
 	}
 
 	// Print separator
-	printSeparator()
+	printSeparator(w, langWidth, widths)
 
 	// Print total row
-	printRow("Total", total.FileCount, total.BlankLines, total.CommentLines, total.CodeLines, total.TotalLines)
+	printCells(w, langWidth, widths, "Total", plainCells(total))
 
 	// Print footer with summary
-	printFooter(processedFiles, skippedFiles, errorCount)
+	printFooter(w, langWidth, widths, processedFiles, skippedFiles, errorCount)
 }
 
-// printHeader prints the table header
-func printHeader() {
-	fmt.Println()
-	printSeparator()
-	fmt.Printf("%-*s %*s %*s %*s %*s %*s\n",
-		colLanguage, "Language",
-		colFiles, "Files",
-		colBlank, "Blank",
-		colComment, "Comment",
-		colCode, "Code",
-		colTotal, "Total")
-	printSeparator()
+// languageColumnWidth returns the width of the language column of a table
+// whose other columns have the given widths. It is colLanguage unless
+// truncating names to that width would make two of them display
+// identically, in which case it widens to fit the longest name. With a
+// TerminalWidth set, it also widens into the room the table leaves, so long
+// names are shown in full if they fit.
+func languageColumnWidth(languages []string, otherWidths ...int) int {
+	width := fixedLanguageColumnWidth(languages)
+	if TerminalWidth <= 0 {
+		return width
+	}
+
+	longest := 0
+	for _, language := range languages {
+		longest = max(longest, utf8.RuneCountInString(language))
+	}
+	spare := TerminalWidth - tableWidth(append([]int{width}, otherWidths...)...)
+	if longest > width && spare > 0 {
+		width = min(longest, width+spare)
+	}
+	return width
+}
+
+// fixedLanguageColumnWidth returns the width of the language column
+// regardless of TerminalWidth, see languageColumnWidth
+func fixedLanguageColumnWidth(languages []string) int {
+	longest := 0
+	seen := make(map[string]bool)
+	collision := false
+
+	for _, language := range languages {
+		if n := utf8.RuneCountInString(language); n > longest {
+			longest = n
+		}
+		display := truncateLanguage(language, colLanguage)
+		if seen[display] {
+			collision = true
+		}
+		seen[display] = true
+	}
+
+	if collision && longest > colLanguage {
+		return longest
+	}
+	return colLanguage
+}
+
+// fullLanguageColumnWidth returns a language column width wide enough to show
+// every name in full, and never narrower than colLanguage
+func fullLanguageColumnWidth(languages []string) int {
+	width := colLanguage
+	for _, language := range languages {
+		if n := utf8.RuneCountInString(language); n > width {
+			width = n
+		}
+	}
+	return width
+}
+
+// TruncationIndicator marks where a language name was cut to fit its column
+var TruncationIndicator = "..."
+
+// truncateLanguage shortens a language name to fit width columns, marking
+// the cut with TruncationIndicator. Widths are counted in runes.
+func truncateLanguage(language string, width int) string {
+	runes := []rune(language)
+	if len(runes) <= width {
+		return language
+	}
+
+	indicator := []rune(TruncationIndicator)
+	keep := width - len(indicator)
+	if keep < 0 {
+		return string(indicator[:width])
+	}
+	return string(runes[:keep]) + TruncationIndicator
 }
 
-// printSeparator prints a separator line
-func printSeparator() {
-	totalWidth := colLanguage + colFiles + colBlank + colComment + colCode + colTotal + 5 // 5 spaces between columns
-	fmt.Println(strings.Repeat("-", totalWidth))
+// printHeader prints the table header, with the default columns in the
+// given widths
+func printHeader(w io.Writer, langWidth int, widths []int) {
+	fmt.Fprintln(w)
+	printSeparator(w, langWidth, widths)
+	headers := make([]string, len(defaultColumns))
+	for i, col := range defaultColumns {
+		headers[i] = col.header
+	}
+	printCells(w, langWidth, widths, "Language", headers)
+	printSeparator(w, langWidth, widths)
 }
 
-// printRow prints a single row of the table
-func printRow(language string, files, blank, comment, code, total int) {
-	// Truncate language name if too long
-	if len(language) > colLanguage {
-		language = language[:colLanguage-3] + "..."
+// printSeparator prints a separator line as wide as the default columns
+func printSeparator(w io.Writer, langWidth int, widths []int) {
+	fmt.Fprintln(w, strings.Repeat("-", tableWidth(append([]int{langWidth}, widths...)...)))
+}
+
+// plainCells returns the default columns of stats as plain numbers
+func plainCells(stats *LanguageStats) []string {
+	return countCells(stats, numberFormatter(NumbersPlain))
+}
+
+// countCells returns the default columns of stats rendered by number
+func countCells(stats *LanguageStats, number func(int) string) []string {
+	return []string{
+		number(stats.FileCount),
+		number(stats.BlankLines),
+		number(stats.CommentLines),
+		number(stats.CodeLines),
+		number(stats.TotalLines),
 	}
+}
 
-	fmt.Printf("%-*s %*d %*d %*d %*d %*d\n",
-		colLanguage, language,
-		colFiles, files,
-		colBlank, blank,
-		colComment, comment,
-		colCode, code,
-		colTotal, total)
+// printCells prints a row of the default columns, with cells right-aligned
+// in the given widths
+func printCells(w io.Writer, langWidth int, widths []int, label string, cells []string) {
+	var line strings.Builder
+	fmt.Fprintf(&line, "%-*s", langWidth, label)
+	for i, width := range widths {
+		fmt.Fprintf(&line, " %*s", width, cells[i])
+	}
+	fmt.Fprintln(w, line.String())
 }
 
 // printFooter prints the summary footer
-func printFooter(processedFiles, skippedFiles, errorCount int) {
-	printSeparator()
-	fmt.Println()
-	fmt.Printf("Summary:\n")
-	fmt.Printf("  Files processed: %d\n", processedFiles)
-	fmt.Printf("  Files skipped:   %d\n", skippedFiles)
+func printFooter(w io.Writer, langWidth int, widths []int, processedFiles, skippedFiles, errorCount int) {
+	printSeparator(w, langWidth, widths)
+	printSummary(w, processedFiles, skippedFiles, errorCount)
+}
+
+// printSummary prints the processed, skipped and error counts
+func printSummary(w io.Writer, processedFiles, skippedFiles, errorCount int) {
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Summary:\n")
+	fmt.Fprintf(w, "  Files processed: %d\n", processedFiles)
+	fmt.Fprintf(w, "  Files skipped:   %d\n", skippedFiles)
 	if errorCount > 0 {
-		fmt.Printf("  Errors:          %d\n", errorCount)
+		fmt.Fprintf(w, "  Errors:          %d\n", errorCount)
 	}
-	fmt.Println()
+	fmt.Fprintln(w)
 }
 
 // sortLanguagesByCode sorts languages by code lines in descending order
@@ -97,14 +254,71 @@ func sortLanguagesByCode(langStats map[string]*LanguageStats) []string {
 	}
 
 	sort.Slice(langs, func(i, j int) bool {
-		return langStats[langs[i]].CodeLines > langStats[langs[j]].CodeLines
+		if langStats[langs[i]].CodeLines != langStats[langs[j]].CodeLines {
+			return langStats[langs[i]].CodeLines > langStats[langs[j]].CodeLines
+		}
+		return langs[i] < langs[j]
 	})
 
 	return langs
 }
 
-// PrintErrors prints the list of errors encountered
-func PrintErrors(errors []error) {
+// Orders accepted by --sort
+const (
+	SortByCode         = "code"
+	SortByFiles        = "files"
+	SortByName         = "name"
+	SortByCommentRatio = "comment-ratio"
+)
+
+// SortOrders lists the orders accepted by --sort
+var SortOrders = []string{SortByCode, SortByFiles, SortByName, SortByCommentRatio}
+
+// sortLanguages returns the languages of langStats in the given order. An
+// empty order sorts by code lines like sortLanguagesByCode.
+func sortLanguages(langStats map[string]*LanguageStats, by string) []string {
+	langs := make([]string, 0, len(langStats))
+	for lang := range langStats {
+		langs = append(langs, lang)
+	}
+
+	var less func(a, b *LanguageStats) bool
+	switch by {
+	case SortByFiles:
+		less = func(a, b *LanguageStats) bool { return a.FileCount > b.FileCount }
+	case SortByName:
+		less = func(a, b *LanguageStats) bool { return false }
+	case SortByCommentRatio:
+		// Least documented first; languages without code lines go last
+		less = func(a, b *LanguageStats) bool {
+			if (a.CodeLines == 0) != (b.CodeLines == 0) {
+				return b.CodeLines == 0
+			}
+			if a.CodeLines == 0 {
+				return false
+			}
+			return a.CommentLines*b.CodeLines < b.CommentLines*a.CodeLines
+		}
+	default:
+		return sortLanguagesByCode(langStats)
+	}
+
+	sort.Slice(langs, func(i, j int) bool {
+		a, b := langStats[langs[i]], langStats[langs[j]]
+		if less(a, b) {
+			return true
+		}
+		if less(b, a) {
+			return false
+		}
+		return langs[i] < langs[j]
+	})
+	return langs
+}
+
+// PrintErrors prints the list of errors encountered. count is the number of
+// errors encountered, which may exceed len(errors) if not all were kept.
+func PrintErrors(errors []error, count int) {
 	if len(errors) == 0 {
 		return
 	}
@@ -112,47 +326,446 @@ func PrintErrors(errors []error) {
 	fmt.Println("\nErrors encountered:")
 	for i, err := range errors {
 		if i >= 10 {
-			fmt.Printf("  ... and %d more errors\n", len(errors)-10)
 			break
 		}
 		fmt.Printf("  - %v\n", err)
 	}
+	if count > 10 {
+		fmt.Printf("  ... and %d more errors\n", max(count, len(errors))-10)
+	}
 	fmt.Println()
 }
 
-// PrintCompact prints a compact summary
-func PrintCompact(total *LanguageStats) {
-	fmt.Printf("Files: %d | Blank: %d | Comment: %d | Code: %d | Total: %d\n",
-		total.FileCount, total.BlankLines, total.CommentLines, total.CodeLines, total.TotalLines)
+// PrintSkipped prints the number of skipped files per reason and, if
+// listFiles is set, every skipped file with its reason
+func PrintSkipped(skipped []SkippedFile, listFiles bool) {
+	if len(skipped) == 0 {
+		return
+	}
+
+	counts := CountSkipReasons(skipped)
+	fmt.Println("Skipped files:")
+	for _, reason := range SkipReasons {
+		if counts[reason] > 0 {
+			fmt.Printf("  %-*s %*d\n", colLanguage, reason, colFiles, counts[reason])
+		}
+	}
+
+	if listFiles {
+		fmt.Println()
+		for _, sf := range skipped {
+			fmt.Printf("  %s (%s)\n", sf.Path, sf.Reason)
+		}
+	}
+	fmt.Println()
 }
 
-// PrintJSON prints results in JSON format
-func PrintJSON(langStats map[string]*LanguageStats, total *LanguageStats) {
-	fmt.Println("{")
-	fmt.Println("  \"languages\": {")
+// PrintEmbedded prints the lines of embedded code found per language
+func PrintEmbedded(w io.Writer, embedded map[string]int) {
+	if len(embedded) == 0 {
+		return
+	}
+
+	langs := make([]string, 0, len(embedded))
+	for lang := range embedded {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if embedded[langs[i]] != embedded[langs[j]] {
+			return embedded[langs[i]] > embedded[langs[j]]
+		}
+		return langs[i] < langs[j]
+	})
+
+	fmt.Fprintln(w, "Embedded code:")
+	for _, lang := range langs {
+		fmt.Fprintf(w, "  %-*s %*d lines\n", colLanguage, lang, colCode, embedded[lang])
+	}
+	fmt.Fprintln(w)
+}
 
+// PrintIndent prints how code lines are indented per language
+func PrintIndent(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats) {
 	sortedLangs := sortLanguagesByCode(langStats)
-	for i, lang := range sortedLangs {
+	langWidth := languageColumnWidth(sortedLangs, colCode, colCode, colCode, colCode)
+	width := tableWidth(langWidth, colCode, colCode, colCode, colCode)
+
+	fmt.Fprintln(w, "Indentation of code lines:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*s %*s %*s %*s\n", langWidth, "Language", colCode, "Tabs", colCode, "Spaces", colCode, "Mixed", colCode, "Avg width")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for _, lang := range sortedLangs {
 		stats := langStats[lang]
-		comma := ","
-		if i == len(sortedLangs)-1 {
-			comma = ""
+		fmt.Fprintf(w, "%-*s %*d %*d %*d %*.1f\n", langWidth, truncateLanguage(stats.Language, langWidth),
+			colCode, stats.TabIndented, colCode, stats.SpaceIndented, colCode, stats.MixedIndented, colCode, averageIndent(stats))
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*d %*d %*d %*.1f\n", langWidth, "Total",
+		colCode, total.TabIndented, colCode, total.SpaceIndented, colCode, total.MixedIndented, colCode, averageIndent(total))
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
+
+// averageIndent returns the mean width in columns of the indentation of the
+// indented code lines of ls, or 0 if none is indented
+func averageIndent(ls *LanguageStats) float64 {
+	indented := ls.TabIndented + ls.SpaceIndented + ls.MixedIndented
+	if indented == 0 {
+		return 0
+	}
+	return float64(ls.IndentColumns) / float64(indented)
+}
+
+// PrintRegions prints the number of region marker lines of every language
+// that has any
+func PrintRegions(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats) {
+	var sortedLangs []string
+	for _, lang := range sortLanguagesByCode(langStats) {
+		if langStats[lang].RegionLines > 0 {
+			sortedLangs = append(sortedLangs, lang)
+		}
+	}
+	langWidth := languageColumnWidth(sortedLangs, colCode)
+	width := tableWidth(langWidth, colCode)
+
+	fmt.Fprintln(w, "Region markers:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*s\n", langWidth, "Language", colCode, "Regions")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for _, lang := range sortedLangs {
+		stats := langStats[lang]
+		fmt.Fprintf(w, "%-*s %*d\n", langWidth, truncateLanguage(stats.Language, langWidth), colCode, stats.RegionLines)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*d\n", langWidth, "Total", colCode, total.RegionLines)
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
+
+// PrintTestSplit prints the test and source code totals returned by
+// SplitTests, followed by the ratio of test code lines to source code lines
+func PrintTestSplit(w io.Writer, tests, source *LanguageStats) {
+	const colKind = 10
+	width := tableWidth(colKind, colFiles, colCode, colTotal)
+	row := func(kind string, stats *LanguageStats) {
+		fmt.Fprintf(w, "%-*s %*d %*d %*d\n", colKind, kind, colFiles, stats.FileCount, colCode, stats.CodeLines, colTotal, stats.TotalLines)
+	}
+
+	fmt.Fprintln(w, "Test code:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*s %*s %*s\n", colKind, "Kind", colFiles, "Files", colCode, "Code", colTotal, "Total")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	row("Source", source)
+	row("Test", tests)
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	if source.CodeLines > 0 {
+		fmt.Fprintf(w, "Test to source ratio: %.2f\n", float64(tests.CodeLines)/float64(source.CodeLines))
+	} else {
+		fmt.Fprintln(w, "Test to source ratio: n/a")
+	}
+	fmt.Fprintln(w)
+}
+
+// PrintTopFiles prints the file with the most code lines of every language,
+// as returned by TopFiles, in the order of the language table. Paths are
+// shown relative to relativeTo when it is set.
+func PrintTopFiles(w io.Writer, top map[string]*FileStats, langStats map[string]*LanguageStats, relativeTo string) {
+	var sortedLangs []string
+	for _, lang := range sortLanguagesByCode(langStats) {
+		if top[lang] != nil {
+			sortedLangs = append(sortedLangs, lang)
 		}
-		fmt.Printf("    \"%s\": {\"files\": %d, \"blank\": %d, \"comment\": %d, \"code\": %d, \"total\": %d}%s\n",
-			stats.Language, stats.FileCount, stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines, comma)
 	}
+	langWidth := languageColumnWidth(sortedLangs, colCode, colLanguage)
+	width := tableWidth(langWidth, colCode, colLanguage)
 
-	fmt.Println("  },")
-	fmt.Printf("  \"total\": {\"files\": %d, \"blank\": %d, \"comment\": %d, \"code\": %d, \"total\": %d}\n",
+	fmt.Fprintln(w, "Top file per language:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*s %s\n", langWidth, "Language", colCode, "Code", "File")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for _, lang := range sortedLangs {
+		fs := top[lang]
+		fmt.Fprintf(w, "%-*s %*d %s\n", langWidth, truncateLanguage(langStats[lang].Language, langWidth), colCode, fs.CodeLines, reportPath(fs.FilePath, relativeTo))
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
+
+// PrintCommentedCode prints, for every language with any, the number of
+// comment lines that read like commented-out code and their share of its
+// comment lines
+func PrintCommentedCode(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats) {
+	var sortedLangs []string
+	for _, lang := range sortLanguagesByCode(langStats) {
+		if langStats[lang].CommentedCodeLines > 0 {
+			sortedLangs = append(sortedLangs, lang)
+		}
+	}
+	langWidth := languageColumnWidth(sortedLangs, colComment, colCode, colCode)
+	width := tableWidth(langWidth, colComment, colCode, colCode)
+
+	row := func(language string, stats *LanguageStats) {
+		share := 0.0
+		if stats.CommentLines > 0 {
+			share = float64(stats.CommentedCodeLines) / float64(stats.CommentLines) * 100
+		}
+		fmt.Fprintf(w, "%-*s %*d %*d %*.1f%%\n", langWidth, language, colComment, stats.CommentLines, colCode, stats.CommentedCodeLines, colCode-1, share)
+	}
+
+	fmt.Fprintln(w, "Commented-out code:")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %*s %*s %*s\n", langWidth, "Language", colComment, "Comment", colCode, "Code-like", colCode, "Share")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for _, lang := range sortedLangs {
+		stats := langStats[lang]
+		row(truncateLanguage(stats.Language, langWidth), stats)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	row("Total", total)
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
+
+// PrintCompact prints a compact summary
+func PrintCompact(w io.Writer, total *LanguageStats) {
+	fmt.Fprintf(w, "Files: %d | Blank: %d | Comment: %d | Code: %d | Total: %d\n",
 		total.FileCount, total.BlankLines, total.CommentLines, total.CodeLines, total.TotalLines)
-	fmt.Println("}")
 }
 
-// PrintByFiles prints results sorted by file count
-func PrintByFiles(langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
-	// Print header
-	printHeader()
+// PrintLines writes one line per language, sorted by code lines, such as
+// "Go: 12,345 code / 1,200 comment / 500 blank", followed by the same line
+// for the total
+func PrintLines(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats) {
+	line := func(label string, stats *LanguageStats) {
+		fmt.Fprintf(w, "%s: %s code / %s comment / %s blank\n", label,
+			FormatNumber(int64(stats.CodeLines)), FormatNumber(int64(stats.CommentLines)), FormatNumber(int64(stats.BlankLines)))
+	}
+	if len(langStats) == 0 {
+		fmt.Fprintln(w, noFilesMatched)
+	}
+	for _, lang := range sortLanguagesByCode(langStats) {
+		line(langStats[lang].Language, langStats[lang])
+	}
+	line("Total", total)
+}
+
+// PrintCompactCodeOnly prints a compact summary without the blank and
+// comment counts
+func PrintCompactCodeOnly(w io.Writer, total *LanguageStats) {
+	fmt.Fprintf(w, "Files: %d | Code: %d | Total: %d\n", total.FileCount, total.CodeLines, total.TotalLines)
+}
+
+// TableOptions selects the columns printed by PrintTable
+type TableOptions struct {
+	CodeOnly      bool   // omit the blank and comment columns
+	Bytes         bool   // add a column with the size of the counted files
+	FormatNumbers bool   // add thousand separators, as in PrintResultsFormatted
+	NumericFormat string // one of NumericFormats, see numericFormat
+	SortBy        string // one of SortOrders, by code lines if empty
+	NoTruncate    bool   // widen the language column to fit every name
+	NoBlank       bool   // omit the blank column
+	NoComment     bool   // omit the comment column
+	NoHeader      bool   // omit the header and the separators around it
+	NoTotal       bool   // omit the total row and the summary footer
+	SplitComments bool   // add line and block comment columns
+	Bars          bool   // add a bar proportional to the code lines
+	Functions     bool   // add a column with the number of functions
+	DocComments   bool   // add columns with the doc comment lines and their share
+	DocCoverage   bool   // add columns with the comment share of comment and code lines
+	Logical       bool   // add a column with the logical lines of code
+	LongLines     bool   // add a column with the code lines over --max-line-length
+	Weighted      bool   // add a column with the --weights score
+}
+
+// tableColumn is a right-aligned column of a language table
+type tableColumn struct {
+	header string
+	width  int
+	value  func(*LanguageStats) string
+}
+
+// numericFormat returns the format of the counts of the table:
+// NumericFormat if set, otherwise grouped with FormatNumbers and plain
+// without
+func (opts TableOptions) numericFormat() string {
+	switch {
+	case opts.NumericFormat != "":
+		return opts.NumericFormat
+	case opts.FormatNumbers:
+		return NumbersGrouped
+	default:
+		return NumbersPlain
+	}
+}
+
+// columns returns the table columns selected by opts
+func (opts TableOptions) columns() []tableColumn {
+	number := numberFormatter(opts.numericFormat())
+	grouped := opts.numericFormat() == NumbersGrouped
+
+	columns := []tableColumn{
+		{"Files", colFiles, func(ls *LanguageStats) string { return number(ls.FileCount) }},
+	}
+	if !opts.CodeOnly && !opts.NoBlank {
+		columns = append(columns, tableColumn{"Blank", colBlank, func(ls *LanguageStats) string { return number(ls.BlankLines) }})
+	}
+	if !opts.CodeOnly && !opts.NoComment {
+		columns = append(columns, tableColumn{"Comment", colComment, func(ls *LanguageStats) string { return number(ls.CommentLines) }})
+	}
+	if !opts.CodeOnly && opts.SplitComments {
+		columns = append(columns,
+			tableColumn{"LineComment", colComment, func(ls *LanguageStats) string { return number(ls.LineCommentLines) }},
+			tableColumn{"BlockComment", colComment, func(ls *LanguageStats) string { return number(ls.BlockCommentLines) }},
+		)
+	}
+	columns = append(columns,
+		tableColumn{"Code", colCode, func(ls *LanguageStats) string { return number(ls.CodeLines) }},
+		tableColumn{"Total", colTotal, func(ls *LanguageStats) string { return number(ls.TotalLines) }},
+	)
+	if opts.Logical {
+		columns = append(columns, tableColumn{"Logical", colCode, func(ls *LanguageStats) string { return number(ls.LogicalLines) }})
+	}
+	if opts.LongLines {
+		columns = append(columns, tableColumn{"LongLines", colCode, func(ls *LanguageStats) string { return number(ls.LongLines) }})
+	}
+	if opts.Functions {
+		columns = append(columns, tableColumn{"Functions", colCode, func(ls *LanguageStats) string { return number(ls.Functions) }})
+	}
+	if opts.DocComments && !opts.CodeOnly {
+		columns = append(columns,
+			tableColumn{"DocComment", colComment, func(ls *LanguageStats) string { return number(ls.DocCommentLines) }},
+			tableColumn{"Doc%", colFiles, func(ls *LanguageStats) string { return docShare(ls) }},
+		)
+	}
+	if opts.DocCoverage {
+		columns = append(columns,
+			tableColumn{"Coverage", colFiles, func(ls *LanguageStats) string { return formatCoverage(ls) }},
+			tableColumn{"", colCoverage, func(ls *LanguageStats) string { return coverageBar(ls) }},
+		)
+	}
+	if opts.Weighted {
+		columns = append(columns, tableColumn{"Weighted", colCode, func(ls *LanguageStats) string { return formatWeighted(ls.Weighted, grouped) }})
+	}
+	if opts.Bytes {
+		columns = append(columns, tableColumn{"Bytes", colBytes, func(ls *LanguageStats) string { return FormatBytes(ls.Bytes) }})
+	}
+	return columns
+}
+
+// PrintTable prints the results like PrintResults, with the columns selected
+// by opts
+func PrintTable(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, opts TableOptions, processedFiles, skippedFiles, errorCount int) {
+	sortedLangs := sortLanguages(langStats, opts.SortBy)
+	columns := opts.columns()
+	padded := opts.numericFormat() == NumbersPadded
+
+	// Widen columns whose values do not fit, keeping the rows aligned
+	for i := range columns {
+		for _, stats := range langStats {
+			columns[i].width = max(columns[i].width, utf8.RuneCountInString(columns[i].value(stats)))
+		}
+		columns[i].width = max(columns[i].width, utf8.RuneCountInString(columns[i].value(total)))
+	}
+
+	var otherWidths []int
+	for _, col := range columns {
+		otherWidths = append(otherWidths, col.width)
+	}
+	if opts.Bars {
+		otherWidths = append(otherWidths, colBars)
+	}
+	langWidth := languageColumnWidth(sortedLangs, otherWidths...)
+	if opts.NoTruncate {
+		langWidth = fullLanguageColumnWidth(sortedLangs)
+	}
+	separator := strings.Repeat("-", tableWidth(append([]int{langWidth}, otherWidths...)...))
+
+	// Bars are left-aligned after the last column, scaled to the largest
+	// language; the header and total rows have none
+	maxCode := 0
+	for _, ls := range langStats {
+		maxCode = max(maxCode, ls.CodeLines)
+	}
+	row := func(language string, cell func(tableColumn) string, bar int) {
+		var line strings.Builder
+		fmt.Fprintf(&line, "%-*s", langWidth, truncateLanguage(language, langWidth))
+		for _, col := range columns {
+			fmt.Fprintf(&line, " %*s", col.width, cell(col))
+		}
+		if bar > 0 {
+			line.WriteString(" " + strings.Repeat("#", bar))
+		}
+		// Empty cells, such as the header of the --doc-coverage bar, end
+		// some rows
+		fmt.Fprintln(w, strings.TrimRight(line.String(), " "))
+	}
+	statsRow := func(stats *LanguageStats, bar int) {
+		row(stats.Language, func(col tableColumn) string {
+			if padded {
+				return padNumber(col.value(stats), col.width)
+			}
+			return col.value(stats)
+		}, bar)
+	}
+
+	if !opts.NoHeader {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, separator)
+		row("Language", func(col tableColumn) string { return col.header }, 0)
+		fmt.Fprintln(w, separator)
+		if len(sortedLangs) == 0 {
+			fmt.Fprintln(w, noFilesMatched)
+		}
+	}
+	for _, lang := range sortedLangs {
+		bar := 0
+		if opts.Bars {
+			bar = barLength(langStats[lang].CodeLines, maxCode, colBars)
+		}
+		statsRow(langStats[lang], bar)
+	}
+	if opts.NoTotal {
+		// Close the table the header opened
+		if !opts.NoHeader {
+			fmt.Fprintln(w, separator)
+		}
+		return
+	}
+	fmt.Fprintln(w, separator)
+	statsRow(total, 0)
+	fmt.Fprintln(w, separator)
+
+	printSummary(w, processedFiles, skippedFiles, errorCount)
+}
+
+// barLength returns the length of a bar for value, scaled so that maxValue
+// fills width, rounded to the nearest character
+func barLength(value, maxValue, width int) int {
+	if maxValue <= 0 || value <= 0 {
+		return 0
+	}
+	return (value*width + maxValue/2) / maxValue
+}
 
+// FormatBytes formats a byte count using binary units, e.g. "1.5 KB"
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value := float64(n) / unit
+	suffixes := []string{"KB", "MB", "GB", "TB"}
+	i := 0
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f %s", value, suffixes[i])
+}
+
+// PrintByFiles prints results sorted by file count
+func PrintByFiles(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
 	// Sort languages by file count (descending)
 	langs := make([]string, 0, len(langStats))
 	for lang := range langStats {
@@ -161,31 +774,87 @@ func PrintByFiles(langStats map[string]*LanguageStats, total *LanguageStats, pro
 	sort.Slice(langs, func(i, j int) bool {
 		return langStats[langs[i]].FileCount > langStats[langs[j]].FileCount
 	})
+	widths := cellWidths(langStats, total, plainCells)
+	langWidth := languageColumnWidth(langs, widths...)
+
+	// Print header
+	printHeader(w, langWidth, widths)
 
 	// Print each language row
 	for _, lang := range langs {
 		stats := langStats[lang]
-		printRow(stats.Language, stats.FileCount, stats.BlankLines, stats.CommentLines, stats.CodeLines, stats.TotalLines)
+		printCells(w, langWidth, widths, truncateLanguage(stats.Language, langWidth), plainCells(stats))
 	}
 
 	// Print separator
-	printSeparator()
+	printSeparator(w, langWidth, widths)
 
 	// Print total row
-	printRow("Total", total.FileCount, total.BlankLines, total.CommentLines, total.CodeLines, total.TotalLines)
+	printCells(w, langWidth, widths, "Total", plainCells(total))
 
 	// Print footer with summary
-	printFooter(processedFiles, skippedFiles, errorCount)
+	printFooter(w, langWidth, widths, processedFiles, skippedFiles, errorCount)
+}
+
+// formatWeighted formats a weighted score with one decimal, and with
+// thousand separators in its whole part if separators is set
+func formatWeighted(score float64, separators bool) string {
+	s := strconv.FormatFloat(score, 'f', 1, 64)
+	if !separators {
+		return s
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return s
+	}
+	return FormatNumber(n) + "." + fraction
 }
 
-// FormatNumber formats a number with thousand separators
-func FormatNumber(n int) string {
-	if n < 1000 {
-		return fmt.Sprintf("%d", n)
+// Formats accepted by --numeric-format
+const (
+	NumbersPlain   = "plain"
+	NumbersGrouped = "grouped"
+	NumbersPadded  = "padded"
+)
+
+// NumericFormats lists the formats accepted by --numeric-format
+var NumericFormats = []string{NumbersPlain, NumbersGrouped, NumbersPadded}
+
+// numberFormatter returns the function rendering counts in format, one of
+// NumericFormats. Padded counts are plain digits, zero-padded to the width
+// of their column by padNumber once it is known.
+func numberFormatter(format string) func(int) string {
+	if format == NumbersGrouped {
+		return func(n int) string { return FormatNumber(int64(n)) }
+	}
+	return strconv.Itoa
+}
+
+// padNumber left-pads cell with zeros to width if it is a number, such as
+// "42" or "12.5", and returns other cells, such as "12 KB", unchanged
+func padNumber(cell string, width int) string {
+	if cell == "" || strings.Trim(cell, "0123456789.") != "" || len(cell) >= width {
+		return cell
+	}
+	return strings.Repeat("0", width-len(cell)) + cell
+}
+
+// FormatNumber formats a number with thousand separators. It takes an int64
+// so that byte counts and totals beyond the range of a 32-bit int are
+// grouped correctly on every platform.
+func FormatNumber(n int64) string {
+	str := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, str = "-", str[1:]
+	}
+	if len(str) <= 3 {
+		return sign + str
 	}
 
-	str := fmt.Sprintf("%d", n)
 	var result strings.Builder
+	result.WriteString(sign)
 	length := len(str)
 
 	for i, char := range str {
@@ -199,47 +868,213 @@ func FormatNumber(n int) string {
 }
 
 // PrintResultsFormatted prints results with formatted numbers
-func PrintResultsFormatted(langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
-	fmt.Println()
-	printSeparator()
-	fmt.Printf("%-*s %*s %*s %*s %*s %*s\n",
+func PrintResultsFormatted(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats, processedFiles, skippedFiles, errorCount int) {
+	// Sort languages by code lines (descending)
+	sortedLangs := sortLanguagesByCode(langStats)
+	widths := cellWidths(langStats, total, formattedCells)
+	langWidth := languageColumnWidth(sortedLangs, widths...)
+
+	printHeader(w, langWidth, widths)
+
+	// Print each language row with formatted numbers
+	if len(sortedLangs) == 0 {
+		fmt.Fprintln(w, noFilesMatched)
+	}
+	for _, lang := range sortedLangs {
+		stats := langStats[lang]
+		printCells(w, langWidth, widths, truncateLanguage(stats.Language, langWidth), formattedCells(stats))
+	}
+
+	printSeparator(w, langWidth, widths)
+
+	// Print total row with formatted numbers
+	printCells(w, langWidth, widths, "Total", formattedCells(total))
+
+	printFooter(w, langWidth, widths, processedFiles, skippedFiles, errorCount)
+}
+
+// formattedCells returns the default columns of stats with thousand separators
+func formattedCells(stats *LanguageStats) []string {
+	return countCells(stats, numberFormatter(NumbersGrouped))
+}
+
+// reportPath returns path as displayed in per-file output: relative to base
+// when one is given, or unchanged if it cannot be made relative to it
+func reportPath(path, base string) string {
+	if base == "" {
+		return path
+	}
+
+	absBase, err := filepath.Abs(base)
+	if err != nil {
+		return path
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(absBase, absPath)
+	if err != nil {
+		return path
+	}
+	return rel
+}
+
+// PrintExtensions prints one row per language and extension, as returned by
+// AggregateByExtension, followed by the total row
+func PrintExtensions(w io.Writer, rows []*ExtensionStats, total *LanguageStats) {
+	const colExtension = 10
+	width := tableWidth(colExtension, colLanguage, colFiles, colBlank, colComment, colCode, colTotal)
+	line := func(extension, language string, files, blank, comment, code, total int) {
+		fmt.Fprintf(w, "%-*s %-*s %*d %*d %*d %*d %*d\n",
+			colExtension, extension,
+			colLanguage, truncateLanguage(language, colLanguage),
+			colFiles, files,
+			colBlank, blank,
+			colComment, comment,
+			colCode, code,
+			colTotal, total)
+	}
+
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %-*s %*s %*s %*s %*s %*s\n",
+		colExtension, "Extension",
 		colLanguage, "Language",
 		colFiles, "Files",
 		colBlank, "Blank",
 		colComment, "Comment",
 		colCode, "Code",
 		colTotal, "Total")
-	printSeparator()
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for _, es := range rows {
+		extension := es.Extension
+		if extension == "" {
+			extension = "(none)"
+		}
+		line(extension, es.Language, es.FileCount, es.BlankLines, es.CommentLines, es.CodeLines, es.TotalLines)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	line("Total", "", total.FileCount, total.BlankLines, total.CommentLines, total.CodeLines, total.TotalLines)
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
 
-	// Sort languages by code lines (descending)
-	sortedLangs := sortLanguagesByCode(langStats)
+// sortFilesByPath returns the non-nil file statistics sorted by their
+// reported path, along with those paths
+func sortFilesByPath(fileStats []*FileStats, relativeTo string) ([]*FileStats, []string) {
+	files := make([]*FileStats, 0, len(fileStats))
+	reported := make(map[*FileStats]string, len(fileStats))
+	for _, fs := range fileStats {
+		if fs == nil {
+			continue
+		}
+		files = append(files, fs)
+		reported[fs] = reportPath(fs.FilePath, relativeTo)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return reported[files[i]] < reported[files[j]]
+	})
 
-	// Print each language row with formatted numbers
-	for _, lang := range sortedLangs {
-		stats := langStats[lang]
-		language := stats.Language
-		if len(language) > colLanguage {
-			language = language[:colLanguage-3] + "..."
+	paths := make([]string, len(files))
+	for i, fs := range files {
+		paths[i] = reported[fs]
+	}
+	return files, paths
+}
+
+// PrintFiles prints one row per counted file, sorted by path. Paths are
+// reported relative to relativeTo when it is set.
+func PrintFiles(w io.Writer, fileStats []*FileStats, relativeTo string) {
+	files, paths := sortFilesByPath(fileStats, relativeTo)
+	pathWidth := len("File")
+	for _, path := range paths {
+		if len(path) > pathWidth {
+			pathWidth = len(path)
 		}
-		fmt.Printf("%-*s %*s %*s %*s %*s %*s\n",
-			colLanguage, language,
-			colFiles, FormatNumber(stats.FileCount),
-			colBlank, FormatNumber(stats.BlankLines),
-			colComment, FormatNumber(stats.CommentLines),
-			colCode, FormatNumber(stats.CodeLines),
-			colTotal, FormatNumber(stats.TotalLines))
 	}
+	width := tableWidth(pathWidth, colLanguage, colBlank, colComment, colCode, colTotal)
 
-	printSeparator()
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintf(w, "%-*s %-*s %*s %*s %*s %*s\n",
+		pathWidth, "File",
+		colLanguage, "Language",
+		colBlank, "Blank",
+		colComment, "Comment",
+		colCode, "Code",
+		colTotal, "Total")
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	for i, fs := range files {
+		fmt.Fprintf(w, "%-*s %-*s %*d %*d %*d %*d\n",
+			pathWidth, paths[i],
+			colLanguage, truncateLanguage(fs.Language, colLanguage),
+			colBlank, fs.BlankLines,
+			colComment, fs.CommentLines,
+			colCode, fs.CodeLines,
+			colTotal, fs.TotalLines)
+	}
+	fmt.Fprintln(w, strings.Repeat("-", width))
+	fmt.Fprintln(w)
+}
 
-	// Print total row with formatted numbers
-	fmt.Printf("%-*s %*s %*s %*s %*s %*s\n",
-		colLanguage, "Total",
-		colFiles, FormatNumber(total.FileCount),
-		colBlank, FormatNumber(total.BlankLines),
-		colComment, FormatNumber(total.CommentLines),
-		colCode, FormatNumber(total.CodeLines),
-		colTotal, FormatNumber(total.TotalLines))
-
-	printFooter(processedFiles, skippedFiles, errorCount)
+// writeOutputFile runs write on a temporary file, then renames it to path
+// so readers never see a partial file
+func writeOutputFile(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// docCoverage returns the comment lines of ls as a share of its comment and
+// code lines, and false if it has no code lines
+func docCoverage(ls *LanguageStats) (float64, bool) {
+	if ls.CodeLines == 0 {
+		return 0, false
+	}
+	return float64(ls.CommentLines) / float64(ls.CommentLines+ls.CodeLines), true
+}
+
+// formatCoverage formats the doc coverage of ls as a percentage, or "N/A" if
+// it has no code lines
+func formatCoverage(ls *LanguageStats) string {
+	share, ok := docCoverage(ls)
+	if !ok {
+		return "N/A"
+	}
+	return fmt.Sprintf("%.1f%%", share*100)
+}
+
+// coverageBar draws the doc coverage of ls as colCoverage characters, the
+// covered share as # and the rest as dots, or an empty bar if it has no code
+// lines
+func coverageBar(ls *LanguageStats) string {
+	if _, ok := docCoverage(ls); !ok {
+		return ""
+	}
+	filled := barLength(ls.CommentLines, ls.CommentLines+ls.CodeLines, colCoverage)
+	return strings.Repeat("#", filled) + strings.Repeat(".", colCoverage-filled)
+}
+
+// docShare formats the doc comment lines of ls as a percentage of its
+// comment lines, or "-" if it has none
+func docShare(ls *LanguageStats) string {
+	if ls.CommentLines == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(ls.DocCommentLines)/float64(ls.CommentLines)*100)
 }
@@ -2,8 +2,14 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"unicode/utf8"
 )
 
 func TestPrintResults(t *testing.T) {
@@ -28,7 +34,7 @@ func TestPrintResults(t *testing.T) {
 
 	t.Run("Default format", func(t *testing.T) {
 		output := captureStdout(func() {
-			PrintResults(langStats, total, 1, 0, 0)
+			PrintResults(os.Stdout, langStats, total, 1, 0, 0)
 		})
 		if !strings.Contains(output, "Go") || !strings.Contains(output, "Total") {
 			t.Errorf("Output missing expected content: %s", output)
@@ -37,7 +43,7 @@ func TestPrintResults(t *testing.T) {
 
 	t.Run("Formatted format", func(t *testing.T) {
 		output := captureStdout(func() {
-			PrintResultsFormatted(langStats, total, 1, 0, 0)
+			PrintResultsFormatted(os.Stdout, langStats, total, 1, 0, 0)
 		})
 		if !strings.Contains(output, "Go") || !strings.Contains(output, "Total") {
 			t.Errorf("Output missing expected content: %s", output)
@@ -46,7 +52,7 @@ func TestPrintResults(t *testing.T) {
 
 	t.Run("JSON format", func(t *testing.T) {
 		output := captureStdout(func() {
-			PrintJSON(langStats, total)
+			PrintJSON(os.Stdout, langStats, total, JSONColumns{})
 		})
 		if !strings.Contains(output, "\"languages\"") || !strings.Contains(output, "\"Go\"") {
 			t.Errorf("Output missing expected content: %s", output)
@@ -55,7 +61,7 @@ func TestPrintResults(t *testing.T) {
 
 	t.Run("Compact format", func(t *testing.T) {
 		output := captureStdout(func() {
-			PrintCompact(total)
+			PrintCompact(os.Stdout, total)
 		})
 		if !strings.Contains(output, "Code: 70") {
 			t.Errorf("Output missing expected content: %s", output)
@@ -64,7 +70,7 @@ func TestPrintResults(t *testing.T) {
 
 	t.Run("ByFiles format", func(t *testing.T) {
 		output := captureStdout(func() {
-			PrintByFiles(langStats, total, 1, 0, 0)
+			PrintByFiles(os.Stdout, langStats, total, 1, 0, 0)
 		})
 		if !strings.Contains(output, "Go") {
 			t.Errorf("Output missing expected content: %s", output)
@@ -75,7 +81,7 @@ func TestPrintResults(t *testing.T) {
 func TestPrintErrors(t *testing.T) {
 	errs := []error{errors.New("error 1"), errors.New("error 2")}
 	output := captureStdout(func() {
-		PrintErrors(errs)
+		PrintErrors(errs, len(errs))
 	})
 	if !strings.Contains(output, "error 1") || !strings.Contains(output, "error 2") {
 		t.Errorf("Output missing expected errors: %s", output)
@@ -87,16 +93,24 @@ func TestPrintErrors(t *testing.T) {
 		manyErrs[i] = errors.New("error")
 	}
 	output = captureStdout(func() {
-		PrintErrors(manyErrs)
+		PrintErrors(manyErrs, len(manyErrs))
 	})
 	if !strings.Contains(output, "and 5 more errors") {
 		t.Errorf("Output missing 'more errors' message: %s", output)
 	}
+
+	// Errors that were counted but not kept are included in the total
+	output = captureStdout(func() {
+		PrintErrors(manyErrs, 1000)
+	})
+	if !strings.Contains(output, "and 990 more errors") {
+		t.Errorf("Output should count errors that were not kept: %s", output)
+	}
 }
 
 func TestFormatNumber(t *testing.T) {
 	tests := []struct {
-		n    int
+		n    int64
 		want string
 	}{
 		{0, "0"},
@@ -104,6 +118,14 @@ func TestFormatNumber(t *testing.T) {
 		{1000, "1,000"},
 		{1000000, "1,000,000"},
 		{1234567, "1,234,567"},
+		{math.MaxInt32, "2,147,483,647"},
+		{math.MaxInt32 + 1, "2,147,483,648"},
+		{1 << 32, "4,294,967,296"},
+		{5_000_000_000_000, "5,000,000,000,000"},
+		{math.MaxInt64, "9,223,372,036,854,775,807"},
+		{-999, "-999"},
+		{-1500, "-1,500"},
+		{math.MinInt64, "-9,223,372,036,854,775,808"},
 	}
 	for _, tt := range tests {
 		if got := FormatNumber(tt.n); got != tt.want {
@@ -111,3 +133,711 @@ func TestFormatNumber(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatWeightedLarge(t *testing.T) {
+	if got, want := formatWeighted(3_000_000_000.5, true), "3,000,000,000.5"; got != want {
+		t.Errorf("formatWeighted = %q, want %q", got, want)
+	}
+}
+
+func TestTruncateLanguageCollision(t *testing.T) {
+	alpha := "Custom Template Language A"
+	beta := "Custom Template Language B"
+
+	// Plain truncation to the default width makes the names identical
+	if truncateLanguage(alpha, colLanguage) != truncateLanguage(beta, colLanguage) {
+		t.Fatalf("Expected %q and %q to collide at width %d", alpha, beta, colLanguage)
+	}
+
+	if got := languageColumnWidth([]string{"Go", "Python"}); got != colLanguage {
+		t.Errorf("languageColumnWidth without collisions = %d, want %d", got, colLanguage)
+	}
+	if got := languageColumnWidth([]string{"Go", "A Very Long Language Name Indeed"}); got != colLanguage {
+		t.Errorf("languageColumnWidth for a single long name = %d, want %d", got, colLanguage)
+	}
+	if got := languageColumnWidth([]string{"Go", alpha, beta}); got != len(alpha) {
+		t.Errorf("languageColumnWidth with collision = %d, want %d", got, len(alpha))
+	}
+
+	langStats := map[string]*LanguageStats{
+		alpha: {Language: alpha, FileCount: 1, CodeLines: 20, TotalLines: 20},
+		beta:  {Language: beta, FileCount: 1, CodeLines: 10, TotalLines: 10},
+	}
+	output := captureStdout(func() {
+		PrintResults(os.Stdout, langStats, TotalStats(langStats), 2, 0, 0)
+	})
+	if !strings.Contains(output, alpha) || !strings.Contains(output, beta) {
+		t.Errorf("Colliding names should be printed in full:\n%s", output)
+	}
+
+	lines := strings.Split(output, "\n")
+	var header, separator string
+	for i, line := range lines {
+		if strings.HasPrefix(line, "Language") {
+			header, separator = line, lines[i-1]
+			break
+		}
+	}
+	if len(header) != len(separator) {
+		t.Errorf("Header width %d does not match separator width %d", len(header), len(separator))
+	}
+}
+
+func TestLanguageColumnWidthTerminal(t *testing.T) {
+	defer func() { TerminalWidth = 0 }()
+	long := "A Very Long Language Name Indeed"
+	languages := []string{"Go", long}
+	fixed := tableWidth(append([]int{colLanguage}, defaultColumnWidths()...)...)
+
+	tests := []struct {
+		name      string
+		terminal  int
+		languages []string
+		want      int
+	}{
+		{"not a terminal", 0, languages, colLanguage},
+		{"wide terminal fits the longest name", 200, languages, len(long)},
+		{"narrow terminal widens into the spare room", fixed + 5, languages, colLanguage + 5},
+		{"terminal narrower than the table", 60, languages, colLanguage},
+		{"short names keep the fixed width", 200, []string{"Go", "Python"}, colLanguage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			TerminalWidth = tt.terminal
+			if got := languageColumnWidth(tt.languages, defaultColumnWidths()...); got != tt.want {
+				t.Errorf("languageColumnWidth with TerminalWidth %d = %d, want %d", tt.terminal, got, tt.want)
+			}
+		})
+	}
+
+	TerminalWidth = 200
+	langStats := map[string]*LanguageStats{
+		long: {Language: long, FileCount: 1, CodeLines: 20, TotalLines: 20},
+	}
+	output := captureStdout(func() {
+		PrintResults(os.Stdout, langStats, TotalStats(langStats), 1, 0, 0)
+	})
+	if !strings.Contains(output, long) {
+		t.Errorf("Expected the long name in full on a wide terminal:\n%s", output)
+	}
+}
+
+func TestPrintFilesRelativeTo(t *testing.T) {
+	root := t.TempDir()
+	fileStats := []*FileStats{
+		{FilePath: filepath.Join(root, "services", "api", "main.go"), Language: "Go", CodeLines: 3, TotalLines: 3},
+		{FilePath: filepath.Join(root, "services", "api", "util.go"), Language: "Go", CodeLines: 1, TotalLines: 1},
+	}
+
+	output := captureStdout(func() {
+		PrintFiles(os.Stdout, fileStats, root)
+	})
+	if !containsRow(output, filepath.Join("services", "api", "main.go"), "Go", "0", "0", "3", "3") {
+		t.Errorf("Expected path relative to %s:\n%s", root, output)
+	}
+	if strings.Contains(output, root) {
+		t.Errorf("Reported paths should not contain the base directory:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintFiles(os.Stdout, fileStats, "")
+	})
+	if !containsRow(output, filepath.Join(root, "services", "api", "util.go"), "Go", "0", "0", "1", "1") {
+		t.Errorf("Expected unchanged path without a base:\n%s", output)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KB"},
+		{1536, "1.5 KB"},
+		{5 * 1024 * 1024, "5.0 MB"},
+		{3 * 1024 * 1024 * 1024, "3.0 GB"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatBytes(tt.input); result != tt.expected {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestPrintTableColumns(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go": {Language: "Go", FileCount: 2, BlankLines: 3, CommentLines: 4, CodeLines: 1500, TotalLines: 1507, Bytes: 2048},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{Bytes: true}, 2, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Blank", "Comment", "Code", "Total", "Bytes") {
+		t.Errorf("Missing Bytes header:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "3", "4", "1500", "1507", "2.0", "KB") {
+		t.Errorf("Missing Go row with bytes:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{CodeOnly: true, FormatNumbers: true}, 2, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Code", "Total") {
+		t.Errorf("Missing code-only header:\n%s", output)
+	}
+	if !containsRow(output, "Total", "2", "1,500", "1,507") {
+		t.Errorf("Missing formatted code-only total row:\n%s", output)
+	}
+}
+
+func TestPrintTableSuppressedColumns(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go": {Language: "Go", FileCount: 2, BlankLines: 3, CommentLines: 4, CodeLines: 15, TotalLines: 22},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoBlank: true}, 2, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Comment", "Code", "Total") {
+		t.Errorf("Missing header without Blank:\n%s", output)
+	}
+	if !containsRow(output, "Total", "2", "4", "15", "22") {
+		t.Errorf("Missing total row without Blank:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoBlank: true, NoComment: true}, 2, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Code", "Total") {
+		t.Errorf("Missing header without Blank and Comment:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "15", "22") {
+		t.Errorf("Missing Go row without Blank and Comment:\n%s", output)
+	}
+	separator := strings.Repeat("-", colLanguage+colFiles+colCode+colTotal+3)
+	if !strings.Contains(output, "\n"+separator+"\n") || strings.Contains(output, separator+"-") {
+		t.Errorf("Separator should be %d wide:\n%s", len(separator), output)
+	}
+
+	output = captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{NoComment: true})
+	})
+	if strings.Contains(output, `"comment"`) || !strings.Contains(output, `"blank": 3`) {
+		t.Errorf("JSON should have blank but no comment fields:\n%s", output)
+	}
+}
+
+func TestPrintTableSplitComments(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go": {Language: "Go", FileCount: 1, CommentLines: 7, LineCommentLines: 3, BlockCommentLines: 4, CodeLines: 10, TotalLines: 17},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{SplitComments: true}, 1, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Blank", "Comment", "LineComment", "BlockComment", "Code", "Total") {
+		t.Errorf("Missing split comment header:\n%s", output)
+	}
+	if !containsRow(output, "Go", "1", "0", "7", "3", "4", "10", "17") {
+		t.Errorf("Missing split comment row:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{SplitComments: true})
+	})
+	if !strings.Contains(output, `"line_comment": 3`) || !strings.Contains(output, `"block_comment": 4`) {
+		t.Errorf("JSON should include line and block comment counts:\n%s", output)
+	}
+	output = captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{})
+	})
+	if strings.Contains(output, "line_comment") {
+		t.Errorf("JSON should not split comments unless requested:\n%s", output)
+	}
+}
+
+func TestPrintTableFunctions(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":   {Language: "Go", FileCount: 2, CodeLines: 40, TotalLines: 40, Functions: 6},
+		"Java": {Language: "Java", FileCount: 1, CodeLines: 10, TotalLines: 10},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{Functions: true}, 3, 0, 0)
+	})
+	if !containsRow(output, "Language", "Files", "Blank", "Comment", "Code", "Total", "Functions") {
+		t.Errorf("Missing Functions header:\n%s", output)
+	}
+	if !containsRow(output, "Go", "2", "0", "0", "40", "40", "6") || !containsRow(output, "Total", "3", "0", "0", "50", "50", "6") {
+		t.Errorf("Missing function counts:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintJSON(os.Stdout, langStats, total, JSONColumns{Functions: true})
+	})
+	if !strings.Contains(output, `"functions": 6`) {
+		t.Errorf("JSON should include the function count:\n%s", output)
+	}
+}
+
+func TestSortLanguagesCommentRatio(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", CommentLines: 30, CodeLines: 100},    // 0.30
+		"Python": {Language: "Python", CommentLines: 5, CodeLines: 100}, // 0.05
+		"Rust":   {Language: "Rust", CommentLines: 10, CodeLines: 20},   // 0.50
+		"Ruby":   {Language: "Ruby", CommentLines: 0, CodeLines: 10},    // 0.00
+		"Empty":  {Language: "Empty", CommentLines: 4, CodeLines: 0},
+		"Blank":  {Language: "Blank"},
+	}
+
+	got := sortLanguages(langStats, SortByCommentRatio)
+	want := []string{"Ruby", "Python", "Go", "Rust", "Blank", "Empty"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortLanguages(comment-ratio) = %v, want %v", got, want)
+	}
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, TotalStats(langStats), TableOptions{SortBy: SortByCommentRatio}, 6, 0, 0)
+	})
+	if strings.Index(output, "Ruby") > strings.Index(output, "Rust") {
+		t.Errorf("Table not in comment-ratio order:\n%s", output)
+	}
+
+	if got := sortLanguages(langStats, SortByName); !reflect.DeepEqual(got, []string{"Blank", "Empty", "Go", "Python", "Ruby", "Rust"}) {
+		t.Errorf("sortLanguages(name) = %v", got)
+	}
+}
+
+func TestPrintTableNoTruncate(t *testing.T) {
+	long := "Extremely Long Custom Template Language"
+	langStats := map[string]*LanguageStats{
+		long: {Language: long, FileCount: 1, CodeLines: 10, TotalLines: 10},
+		"Go": {Language: "Go", FileCount: 1, CodeLines: 5, TotalLines: 5},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{}, 2, 0, 0)
+	})
+	if strings.Contains(output, long) {
+		t.Errorf("Long name should be truncated by default:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoTruncate: true}, 2, 0, 0)
+	})
+	if !strings.Contains(output, long+" ") {
+		t.Errorf("Long name should be printed in full:\n%s", output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Go ") && len(line) != len(strings.Split(output, "\n")[1]) {
+			t.Errorf("Row width %d does not match separator width:\n%s", len(line), output)
+		}
+	}
+}
+
+func TestTruncationIndicator(t *testing.T) {
+	defer func(old string) { TruncationIndicator = old }(TruncationIndicator)
+
+	name := "Custom Template Language"
+	if got := truncateLanguage(name, colLanguage); got != "Custom Template L..." {
+		t.Errorf("truncateLanguage with default indicator = %q", got)
+	}
+
+	TruncationIndicator = "…"
+	got := truncateLanguage(name, colLanguage)
+	if got != "Custom Template Lan…" {
+		t.Errorf("truncateLanguage with single-rune indicator = %q", got)
+	}
+	if n := utf8.RuneCountInString(got); n != colLanguage {
+		t.Errorf("Truncated name is %d runes wide, want %d", n, colLanguage)
+	}
+
+	langStats := map[string]*LanguageStats{
+		name: {Language: name, FileCount: 1, CodeLines: 1, TotalLines: 1},
+	}
+	output := captureStdout(func() {
+		PrintResults(os.Stdout, langStats, TotalStats(langStats), 1, 0, 0)
+	})
+	lines := strings.Split(output, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Custom") && utf8.RuneCountInString(line) != utf8.RuneCountInString(lines[1]) {
+			t.Errorf("Row is %d runes wide, separator %d:\n%s", utf8.RuneCountInString(line), utf8.RuneCountInString(lines[1]), output)
+		}
+	}
+
+	if got := truncateLanguage("Go", 20); got != "Go" {
+		t.Errorf("Short names should not be truncated, got %q", got)
+	}
+}
+
+func TestPrintSkipped(t *testing.T) {
+	skipped := []SkippedFile{
+		{"a.png", SkipBinary},
+		{"b.xyz", SkipUnknown},
+		{"c.jpg", SkipBinary},
+	}
+
+	output := captureStdout(func() {
+		PrintSkipped(skipped, false)
+	})
+	if !containsRow(output, "binary", "2") || !containsRow(output, "unknown", "type", "1") {
+		t.Errorf("Missing skip reason counts:\n%s", output)
+	}
+	if strings.Contains(output, "a.png") || strings.Contains(output, "excluded") {
+		t.Errorf("Only reasons with skipped files should be listed, without paths:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintSkipped(skipped, true)
+	})
+	if !containsRow(output, "a.png", "(binary)") || !containsRow(output, "b.xyz", "(unknown", "type)") {
+		t.Errorf("Missing skipped file list:\n%s", output)
+	}
+
+	if output := captureStdout(func() { PrintSkipped(nil, true) }); output != "" {
+		t.Errorf("Expected no output without skipped files, got:\n%s", output)
+	}
+}
+
+// checkSeparatorWidth fails the test unless every separator line in output
+// is as wide as the header row starting with header
+func checkSeparatorWidth(t *testing.T, name, output, header string) {
+	t.Helper()
+	headerWidth := -1
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, header+" ") {
+			headerWidth = utf8.RuneCountInString(line)
+		}
+	}
+	if headerWidth < 0 {
+		t.Fatalf("%s: no %q header row:\n%s", name, header, output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if line != "" && strings.Trim(line, "-") == "" && len(line) != headerWidth {
+			t.Errorf("%s: separator is %d wide, header %d:\n%s", name, len(line), headerWidth, output)
+			return
+		}
+	}
+}
+
+func TestSeparatorMatchesHeaderWidth(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":                            {Language: "Go", FileCount: 1, CodeLines: 1, TotalLines: 1},
+		"A Very Long Language Name One": {Language: "A Very Long Language Name One", FileCount: 1},
+		"A Very Long Language Name Two": {Language: "A Very Long Language Name Two", FileCount: 1},
+	}
+	total := TotalStats(langStats)
+
+	checkSeparatorWidth(t, "PrintResults", captureStdout(func() {
+		PrintResults(os.Stdout, langStats, total, 3, 0, 0)
+	}), "Language")
+	checkSeparatorWidth(t, "PrintResultsFormatted", captureStdout(func() {
+		PrintResultsFormatted(os.Stdout, langStats, total, 3, 0, 0)
+	}), "Language")
+
+	for _, opts := range []TableOptions{
+		{},
+		{CodeOnly: true},
+		{Bytes: true},
+		{NoBlank: true},
+		{NoBlank: true, NoComment: true, Bytes: true},
+		{SplitComments: true, NoTruncate: true},
+	} {
+		checkSeparatorWidth(t, fmt.Sprintf("PrintTable(os.Stdout, %+v)", opts), captureStdout(func() {
+			PrintTable(os.Stdout, langStats, total, opts, 3, 0, 0)
+		}), "Language")
+	}
+
+	checkSeparatorWidth(t, "PrintIndent", captureStdout(func() {
+		PrintIndent(os.Stdout, langStats, total)
+	}), "Language")
+	checkSeparatorWidth(t, "PrintRegions", captureStdout(func() {
+		PrintRegions(os.Stdout, langStats, total)
+	}), "Language")
+	checkSeparatorWidth(t, "PrintExtensions", captureStdout(func() {
+		PrintExtensions(os.Stdout, []*ExtensionStats{{Extension: ".go", LanguageStats: LanguageStats{Language: "Go", FileCount: 1}}}, total)
+	}), "Extension")
+	checkSeparatorWidth(t, "PrintFiles", captureStdout(func() {
+		PrintFiles(os.Stdout, []*FileStats{{FilePath: "some/long/path/main.go", Language: "Go"}}, "")
+	}), "File")
+}
+
+func TestPrintTableBars(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", CodeLines: 1000},
+		"Python": {Language: "Python", CodeLines: 500},
+		"Shell":  {Language: "Shell", CodeLines: 124},
+		"Text":   {Language: "Text", CodeLines: 10},
+		"Empty":  {Language: "Empty"},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{Bars: true}, 5, 0, 0)
+	})
+
+	want := map[string]int{"Go": 20, "Python": 10, "Shell": 2, "Text": 0, "Empty": 0, "Total": 0}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		wantLen, ok := want[fields[0]]
+		if !ok {
+			continue
+		}
+		delete(want, fields[0])
+		if got := strings.Count(line, "#"); got != wantLen {
+			t.Errorf("%s bar is %d long, want %d:\n%s", fields[0], got, wantLen, output)
+		}
+		if line != strings.TrimRight(line, " ") {
+			t.Errorf("Row %q has trailing spaces", line)
+		}
+	}
+	if len(want) > 0 {
+		t.Errorf("Missing rows %v:\n%s", want, output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if strings.HasPrefix(line, "Go ") && len(line) != len(strings.Split(output, "\n")[1]) {
+			t.Errorf("The longest bar should end at the separator:\n%s", output)
+		}
+	}
+}
+
+func TestDocCoverage(t *testing.T) {
+	tests := []struct {
+		name    string
+		stats   *LanguageStats
+		percent string
+		bar     string
+	}{
+		{"Quarter", &LanguageStats{CommentLines: 25, CodeLines: 75}, "25.0%", "###......."},
+		{"No comments", &LanguageStats{CodeLines: 40}, "0.0%", ".........."},
+		{"Rounded", &LanguageStats{CommentLines: 1, CodeLines: 2}, "33.3%", "###......."},
+		{"No code", &LanguageStats{CommentLines: 12}, "N/A", ""},
+		{"Empty", &LanguageStats{}, "N/A", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatCoverage(tt.stats); got != tt.percent {
+				t.Errorf("formatCoverage = %q, want %q", got, tt.percent)
+			}
+			if got := coverageBar(tt.stats); got != tt.bar {
+				t.Errorf("coverageBar = %q, want %q", got, tt.bar)
+			}
+		})
+	}
+
+	langStats := map[string]*LanguageStats{
+		"Go":       {Language: "Go", FileCount: 2, CommentLines: 50, CodeLines: 50, TotalLines: 100},
+		"Markdown": {Language: "Markdown", FileCount: 1, CommentLines: 10, TotalLines: 10},
+	}
+	total := TotalStats(langStats)
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{DocCoverage: true}, 3, 0, 0)
+	})
+	for _, want := range [][]string{
+		{"Language", "Files", "Blank", "Comment", "Code", "Total", "Coverage"},
+		{"Go", "2", "0", "50", "50", "100", "50.0%", "#####....."},
+		{"Markdown", "1", "0", "10", "0", "10", "N/A"},
+		{"Total", "3", "0", "60", "50", "110", "54.5%", "#####....."},
+	} {
+		if !containsRow(output, want...) {
+			t.Errorf("Expected row %v:\n%s", want, output)
+		}
+	}
+	checkSeparatorWidth(t, "PrintTable(os.Stdout, DocCoverage)", output, "Go")
+}
+
+func TestPrintCommentedCode(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", CommentLines: 40, CodeLines: 100, CommentedCodeLines: 10},
+		"Python": {Language: "Python", CommentLines: 10, CodeLines: 50},
+	}
+	output := captureStdout(func() {
+		PrintCommentedCode(os.Stdout, langStats, TotalStats(langStats))
+	})
+
+	if !containsRow(output, "Go", "40", "10", "25.0%") || !containsRow(output, "Total", "50", "10", "20.0%") {
+		t.Errorf("Expected Go and Total commented-code rows:\n%s", output)
+	}
+	if strings.Contains(output, "Python") {
+		t.Errorf("Languages without commented-out code should not be listed:\n%s", output)
+	}
+}
+
+func TestPrintTestSplit(t *testing.T) {
+	tests := &LanguageStats{FileCount: 2, CodeLines: 30, TotalLines: 35}
+	source := &LanguageStats{FileCount: 5, CodeLines: 120, TotalLines: 140}
+	output := captureStdout(func() {
+		PrintTestSplit(os.Stdout, tests, source)
+	})
+	if !containsRow(output, "Source", "5", "120", "140") || !containsRow(output, "Test", "2", "30", "35") {
+		t.Errorf("Expected Source and Test rows:\n%s", output)
+	}
+	if !strings.Contains(output, "Test to source ratio: 0.25") {
+		t.Errorf("Expected the test to source ratio:\n%s", output)
+	}
+}
+
+func TestPrintRegions(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"C#":    {Language: "C#", CodeLines: 10, RegionLines: 4},
+		"Swift": {Language: "Swift", CodeLines: 5, RegionLines: 2},
+		"Go":    {Language: "Go", CodeLines: 20},
+	}
+	output := captureStdout(func() {
+		PrintRegions(os.Stdout, langStats, TotalStats(langStats))
+	})
+
+	if !containsRow(output, "C#", "4") || !containsRow(output, "Swift", "2") || !containsRow(output, "Total", "6") {
+		t.Errorf("Expected C#, Swift and Total region rows:\n%s", output)
+	}
+	if strings.Contains(output, "Go") {
+		t.Errorf("Languages without region markers should not be listed:\n%s", output)
+	}
+}
+
+func TestColumnsWidenForLargeCounts(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 2, CodeLines: 1_000_000_000, TotalLines: 1_234_567_890},
+		"Python": {Language: "Python", FileCount: 1, CodeLines: 999_999_999, TotalLines: 1_000_000_000},
+	}
+	total := TotalStats(langStats)
+
+	outputs := map[string]string{
+		"PrintResults": captureStdout(func() {
+			PrintResults(os.Stdout, langStats, total, 3, 0, 0)
+		}),
+		"PrintResultsFormatted": captureStdout(func() {
+			PrintResultsFormatted(os.Stdout, langStats, total, 3, 0, 0)
+		}),
+		"PrintTable": captureStdout(func() {
+			PrintTable(os.Stdout, langStats, total, TableOptions{FormatNumbers: true, SplitComments: true}, 3, 0, 0)
+		}),
+	}
+	for name, out := range outputs {
+		if !strings.Contains(out, "2,234,567,890") && !strings.Contains(out, "2234567890") {
+			t.Errorf("%s: total lines missing:\n%s", name, out)
+		}
+		var header string
+		for _, line := range strings.Split(out, "\n") {
+			if strings.HasPrefix(line, "Language") {
+				header = line
+			}
+			if header == "" || strings.HasPrefix(line, "-") || line == "" {
+				continue
+			}
+			if !strings.HasPrefix(line, "Go") && !strings.HasPrefix(line, "Python") && !strings.HasPrefix(line, "Total") {
+				continue
+			}
+			// Every row ends where the header does, and its cells end where
+			// the header's cells do
+			if len(line) != len(header) {
+				t.Errorf("%s: row %q is %d wide, header %q is %d", name, line, len(line), header, len(header))
+				continue
+			}
+			for i := len("Language"); i < len(header); i++ {
+				cellEnd := func(s string) bool { return s[i] != ' ' && (i+1 == len(s) || s[i+1] == ' ') }
+				if cellEnd(header) != cellEnd(line) {
+					t.Errorf("%s: row %q is not aligned with header %q", name, line, header)
+					break
+				}
+			}
+		}
+		checkSeparatorWidth(t, name, out, "Language")
+	}
+}
+
+func TestPrintLines(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 3, BlankLines: 500, CommentLines: 1200, CodeLines: 12345},
+		"Python": {Language: "Python", FileCount: 1, BlankLines: 2, CommentLines: 0, CodeLines: 40},
+	}
+	var out strings.Builder
+	PrintLines(&out, langStats, TotalStats(langStats))
+
+	want := "Go: 12,345 code / 1,200 comment / 500 blank\n" +
+		"Python: 40 code / 0 comment / 2 blank\n" +
+		"Total: 12,385 code / 1,200 comment / 502 blank\n"
+	if out.String() != want {
+		t.Errorf("PrintLines() =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestPrintTableNoHeaderNoTotal(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 2, BlankLines: 1, CommentLines: 2, CodeLines: 30, TotalLines: 33},
+		"Python": {Language: "Python", FileCount: 1, CodeLines: 10, TotalLines: 10},
+	}
+	total := TotalStats(langStats)
+
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoHeader: true, NoTotal: true}, 3, 0, 0)
+	})
+	lines := strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	if len(lines) != 2 || !containsRow(lines[0], "Go", "2", "1", "2", "30", "33") || !containsRow(lines[1], "Python", "1", "0", "0", "10", "10") {
+		t.Errorf("Expected only the data rows, got:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoHeader: true}, 3, 0, 0)
+	})
+	if strings.Contains(output, "Language") || !containsRow(output, "Total", "3", "1", "2", "40", "43") || !strings.Contains(output, "Summary:") {
+		t.Errorf("Expected the total and footer without the header:\n%s", output)
+	}
+
+	output = captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NoTotal: true}, 3, 0, 0)
+	})
+	if !strings.Contains(output, "Language") || containsRow(output, "Total", "3", "1", "2", "40", "43") || strings.Contains(output, "Summary:") {
+		t.Errorf("Expected the header without the total and footer:\n%s", output)
+	}
+	checkSeparatorWidth(t, "PrintTable(os.Stdout, NoTotal)", output, "Language")
+}
+
+func TestPrintTableNumericFormats(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go": {Language: "Go", FileCount: 12, BlankLines: 1500, CommentLines: 800, CodeLines: 12345, TotalLines: 14645, Bytes: 2048},
+	}
+	total := TotalStats(langStats)
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{NumbersPlain, []string{"Go", "12", "1500", "800", "12345", "14645", "2.0", "KB"}},
+		{NumbersGrouped, []string{"Go", "12", "1,500", "800", "12,345", "14,645", "2.0", "KB"}},
+		{NumbersPadded, []string{"Go", "0000000012", "000000001500", "000000000800", "000000012345", "000000014645", "2.0", "KB"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			output := captureStdout(func() {
+				PrintTable(os.Stdout, langStats, total, TableOptions{NumericFormat: tt.format, Bytes: true}, 12, 0, 0)
+			})
+			if !containsRow(output, tt.want...) {
+				t.Errorf("Expected row %v:\n%s", tt.want, output)
+			}
+			if !containsRow(output, "Language", "Files", "Blank", "Comment", "Code", "Total", "Bytes") {
+				t.Errorf("Expected the header unchanged:\n%s", output)
+			}
+			checkSeparatorWidth(t, "PrintTable(os.Stdout, "+tt.format+")", output, "Language")
+		})
+	}
+
+	// The format overrides the grouping of the formatted output
+	output := captureStdout(func() {
+		PrintTable(os.Stdout, langStats, total, TableOptions{NumericFormat: NumbersPlain, FormatNumbers: true}, 12, 0, 0)
+	})
+	if !containsRow(output, "Go", "12", "1500", "800", "12345", "14645") {
+		t.Errorf("Expected plain numbers despite FormatNumbers:\n%s", output)
+	}
+}
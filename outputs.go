@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExtraOutput is an output written to a file in addition to the main one,
+// from the same scan
+type ExtraOutput struct {
+	Format string // one of FormatNames
+	File   string
+}
+
+// ParseExtraOutput parses a --output value of the form format=path
+func ParseExtraOutput(value string) (ExtraOutput, error) {
+	format, file, ok := strings.Cut(value, "=")
+	format, file = trimSpace(format), trimSpace(file)
+	if !ok || format == "" || file == "" {
+		return ExtraOutput{}, fmt.Errorf("invalid output %q, expected format=path", value)
+	}
+	if _, err := LookupFormat(format); err != nil {
+		return ExtraOutput{}, err
+	}
+	return ExtraOutput{Format: format, File: file}, nil
+}
+
+// hasExtraOutput reports whether one of the extra outputs is in format
+func (c *Config) hasExtraOutput(format string) bool {
+	for _, output := range c.Outputs {
+		if output.Format == format {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteExtraOutputs renders report into the file of every extra output.
+// Only the format itself is written, the sections added by options such as
+// --by-file appear in the main output alone.
+func WriteExtraOutputs(outputs []ExtraOutput, report *Report) error {
+	// Files are not terminals, whatever the main output is
+	width := TerminalWidth
+	TerminalWidth = 0
+	defer func() { TerminalWidth = width }()
+
+	for _, output := range outputs {
+		render, err := LookupFormat(output.Format)
+		if err != nil {
+			return err
+		}
+		err = writeOutputFile(output.File, func(w io.Writer) error {
+			return render(w, report)
+		})
+		if err != nil {
+			return fmt.Errorf("output %s: %w", output.File, err)
+		}
+		LogDebug("Wrote the %s output to %s", output.Format, output.File)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// prometheusMetric is a per-language gauge written by PrintPrometheus
+type prometheusMetric struct {
+	name  string
+	help  string
+	value func(*LanguageStats) int
+}
+
+var prometheusMetrics = []prometheusMetric{
+	{"files", "Number of counted files", func(ls *LanguageStats) int { return ls.FileCount }},
+	{"blank_lines", "Number of blank lines", func(ls *LanguageStats) int { return ls.BlankLines }},
+	{"comment_lines", "Number of comment lines", func(ls *LanguageStats) int { return ls.CommentLines }},
+	{"code_lines", "Number of code lines", func(ls *LanguageStats) int { return ls.CodeLines }},
+	{"total_lines", "Number of lines", func(ls *LanguageStats) int { return ls.TotalLines }},
+}
+
+// escapeLabelValue escapes a Prometheus label value
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// PrintPrometheus writes the results in the Prometheus text exposition
+// format, as read by the node_exporter textfile collector. Every metric is
+// written once per language, labeled language="<name>", and once more as a
+// countloc_total_* gauge across all languages.
+func PrintPrometheus(w io.Writer, langStats map[string]*LanguageStats, total *LanguageStats) {
+	langs := make([]string, 0, len(langStats))
+	for lang := range langStats {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+
+	for _, metric := range prometheusMetrics {
+		name := "countloc_" + metric.name
+		fmt.Fprintf(w, "# HELP %s %s per language.\n", name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		for _, lang := range langs {
+			fmt.Fprintf(w, "%s{language=\"%s\"} %d\n", name, escapeLabelValue(lang), metric.value(langStats[lang]))
+		}
+	}
+
+	for _, metric := range prometheusMetrics {
+		name := "countloc_total_" + metric.name
+		fmt.Fprintf(w, "# HELP %s %s across all languages.\n", name, metric.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", name)
+		fmt.Fprintf(w, "%s %d\n", name, metric.value(total))
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrintPrometheus(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":          {Language: "Go", FileCount: 3, BlankLines: 10, CommentLines: 5, CodeLines: 12345, TotalLines: 12360},
+		`My "DSL"\v2`: {Language: `My "DSL"\v2`, FileCount: 1, CodeLines: 7, TotalLines: 7},
+	}
+
+	var buf bytes.Buffer
+	PrintPrometheus(&buf, langStats, TotalStats(langStats))
+	output := buf.String()
+
+	for _, want := range []string{
+		"# TYPE countloc_code_lines gauge",
+		`countloc_code_lines{language="Go"} 12345`,
+		`countloc_files{language="Go"} 3`,
+		`countloc_code_lines{language="My \"DSL\"\\v2"} 7`,
+		"countloc_total_code_lines 12352",
+		"countloc_total_files 4",
+	} {
+		if !strings.Contains(output, want+"\n") {
+			t.Errorf("Output missing line %q:\n%s", want, output)
+		}
+	}
+}
+
+func TestRunOutputFile(t *testing.T) {
+	srcDir := t.TempDir()
+	os.WriteFile(filepath.Join(srcDir, "main.go"), []byte("package main\n"), 0644)
+	outPath := filepath.Join(t.TempDir(), "locc.prom")
+
+	config := &Config{
+		Path:         srcDir,
+		OutputFormat: "prometheus",
+		OutputFile:   outPath,
+	}
+	stdout := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if stdout != "" {
+		t.Errorf("Nothing should be written to stdout, got %q", stdout)
+	}
+
+	data, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatalf("Output file not written: %v", err)
+	}
+	if !strings.Contains(string(data), `countloc_code_lines{language="Go"} 1`+"\n") {
+		t.Errorf("Unexpected output file contents:\n%s", data)
+	}
+}
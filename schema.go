@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// reportSchemaJSON is the JSON Schema of the document printed by the json
+// output format, checked by --strict-json
+//
+//go:embed report.schema.json
+var reportSchemaJSON []byte
+
+// jsonSchema is the subset of JSON Schema used by report.schema.json: type,
+// properties, required, additionalProperties, items, minimum, oneOf and
+// local $ref.
+// The boolean schemas true and false accept and reject every value.
+type jsonSchema struct {
+	Type                 string                 `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Minimum              *json.Number           `json:"minimum"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Ref                  string                 `json:"$ref"`
+	Defs                 map[string]*jsonSchema `json:"$defs"`
+
+	reject bool // the schema is false
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting boolean schemas
+func (s *jsonSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		*s = jsonSchema{}
+		return nil
+	case "false":
+		*s = jsonSchema{reject: true}
+		return nil
+	}
+	type plain jsonSchema
+	return json.Unmarshal(data, (*plain)(s))
+}
+
+// ValidateJSONReport checks an encoded JSON report against the embedded
+// report schema, returning an error naming the first value that does not
+// match it
+func ValidateJSONReport(data []byte) error {
+	var schema jsonSchema
+	if err := json.Unmarshal(reportSchemaJSON, &schema); err != nil {
+		return fmt.Errorf("invalid report schema: %w", err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	return schema.validate(&schema, value, "$")
+}
+
+// validate checks value, found at path, against s. root holds the $defs
+// that references resolve against.
+func (s *jsonSchema) validate(root *jsonSchema, value any, path string) error {
+	if s.reject {
+		return fmt.Errorf("%s: unexpected value", path)
+	}
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def := root.Defs[name]
+		if !ok || def == nil {
+			return fmt.Errorf("%s: unknown schema reference %s", path, s.Ref)
+		}
+		return def.validate(root, value, path)
+	}
+	if s.OneOf != nil {
+		return s.validateOneOf(root, value, path)
+	}
+
+	switch s.Type {
+	case "":
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		return s.validateObject(root, object, path)
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		if s.Items != nil {
+			for i, item := range array {
+				if err := s.Items.validate(root, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case "string":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+		n, err := number.Int64()
+		if err != nil {
+			return fmt.Errorf("%s: expected an integer, got %s", path, number)
+		}
+		if s.Minimum != nil {
+			if minimum, err := s.Minimum.Int64(); err == nil && n < minimum {
+				return fmt.Errorf("%s: %d is less than the minimum %d", path, n, minimum)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %q", path, s.Type)
+	}
+	return nil
+}
+
+// validateOneOf checks that value matches exactly one of the schemas of
+// s.OneOf, reporting why it matches none of them otherwise
+func (s *jsonSchema) validateOneOf(root *jsonSchema, value any, path string) error {
+	var errs []string
+	for _, schema := range s.OneOf {
+		if err := schema.validate(root, value, path); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	switch matched := len(s.OneOf) - len(errs); {
+	case matched == 0:
+		return fmt.Errorf("%s: matches no allowed form: %s", path, strings.Join(errs, "; "))
+	case matched > 1:
+		return fmt.Errorf("%s: matches %d allowed forms, want exactly 1", path, matched)
+	}
+	return nil
+}
+
+// validateObject checks the required keys and the properties of object,
+// in key order so the same error is always reported first
+func (s *jsonSchema) validateObject(root *jsonSchema, object map[string]any, path string) error {
+	for _, key := range s.Required {
+		if _, ok := object[key]; !ok {
+			return fmt.Errorf("%s: missing required key %q", path, key)
+		}
+	}
+
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		property, ok := s.Properties[key]
+		if !ok {
+			property = s.AdditionalProperties
+		}
+		if property == nil {
+			continue
+		}
+		if err := property.validate(root, object[key], path+"."+key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
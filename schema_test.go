@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateJSONReportAcceptsReports(t *testing.T) {
+	langStats := map[string]*LanguageStats{
+		"Go":     {Language: "Go", FileCount: 1, BlankLines: 1, CommentLines: 2, CodeLines: 10, TotalLines: 13, Bytes: 120},
+		"Python": {Language: "Python", FileCount: 1, CodeLines: 4, TotalLines: 4, Bytes: 40},
+	}
+	fileStats := []*FileStats{
+		{FilePath: "main.go", Language: "Go", BlankLines: 1, CommentLines: 2, CodeLines: 10, TotalLines: 13},
+		{FilePath: "run.py", Language: "Python", CodeLines: 4, TotalLines: 4},
+	}
+
+	for _, cols := range []JSONColumns{{}, {NoBlank: true, NoComment: true}, {SplitComments: true}} {
+		report := NewJSONReport(langStats, TotalStats(langStats), cols)
+		report.AddErrors([]error{errors.New("walk failed"), &FileError{FilePath: "x.go", Err: errors.New("denied")}}, 3)
+		report.AddFiles(fileStats, func(lang string) string { return lang }, "")
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if err := ValidateJSONReport(data); err != nil {
+			t.Errorf("ValidateJSONReport(%+v) = %v, want nil for\n%s", cols, err, data)
+		}
+	}
+}
+
+func TestValidateJSONReportRejectsMalformed(t *testing.T) {
+	stats := `{"files": 1, "code": 2, "total": 3, "bytes": 4}`
+	tests := []struct {
+		name   string
+		report string
+		want   string
+	}{
+		{"not an object", `[]`, "$: expected an object"},
+		{"missing total", `{"languages": {}}`, `missing required key "total"`},
+		{"string count", `{"languages": {"Go": {"files": "1", "code": 2, "total": 3, "bytes": 4}}, "total": ` + stats + `}`, "$.languages.Go.files: expected an integer"},
+		{"fractional count", `{"languages": {}, "total": {"files": 1.5, "code": 2, "total": 3, "bytes": 4}}`, "$.total.files: expected an integer"},
+		{"negative count", `{"languages": {}, "total": {"files": -1, "code": 2, "total": 3, "bytes": 4}}`, "less than the minimum"},
+		{"unknown key", `{"languages": {}, "total": ` + stats + `, "elapsed": 1}`, "$.elapsed: unexpected value"},
+		{"unknown stats key", `{"languages": {"Go": {"files": 1, "code": 2, "total": 3, "bytes": 4, "lines": 5}}, "total": ` + stats + `}`, "$.languages.Go.lines"},
+		{"error without message", `{"languages": {}, "total": ` + stats + `, "errors": [{"path": "a"}]}`, `$.errors[0]: missing required key "message"`},
+		{"file list not an array", `{"languages": {"Go": {"files": {"count": 1, "list": {}}, "code": 2, "total": 3, "bytes": 4}}, "total": ` + stats + `}`, "$.languages.Go.files.list: expected an array"},
+		{"file list without count", `{"languages": {"Go": {"files": {"list": []}, "code": 2, "total": 3, "bytes": 4}}, "total": ` + stats + `}`, `$.languages.Go.files: missing required key "count"`},
+		{"invalid JSON", `{"languages":`, "unexpected EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateJSONReport([]byte(tt.report))
+			if err == nil {
+				t.Fatalf("ValidateJSONReport(%s) = nil, want an error", tt.report)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateJSONReport(%s) = %v, want an error containing %q", tt.report, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunStrictJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n"), 0644)
+
+	config := &Config{
+		Path:          tmpDir,
+		OutputFormat:  "json",
+		Quiet:         true,
+		Detailed:      true,
+		IncludeErrors: true,
+		StrictJSON:    true,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !strings.Contains(output, `"Go"`) {
+		t.Errorf("Expected the validated report to be printed:\n%s", output)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ShebangLanguages maps interpreter names found in a "#!" line to the
+// language of the scripts they run. Python 2 and Bash reuse the Python and
+// Shell rules under their own names so they are reported separately.
+var ShebangLanguages = map[string]*Language{
+	"python":  Languages[".py"],
+	"python3": Languages[".py"],
+	"python2": renameLanguage(Languages[".py"], "Python 2"),
+	"sh":      Languages[".sh"],
+	"dash":    Languages[".sh"],
+	"ash":     Languages[".sh"],
+	"bash":    renameLanguage(Languages[".sh"], "Bash"),
+	"node":    Languages[".js"],
+	"ruby":    Languages[".rb"],
+	"perl":    Languages[".pl"],
+	"php":     Languages[".php"],
+	"lua":     Languages[".lua"],
+	"Rscript": Languages[".r"],
+}
+
+// renameLanguage returns a copy of lang with a different display name
+func renameLanguage(lang *Language, name string) *Language {
+	renamed := *lang
+	renamed.Name = name
+	return &renamed
+}
+
+// ParseShebang returns the interpreter named by a "#!" line, skipping an
+// env wrapper and its options, or "" if line is not a shebang
+func ParseShebang(line string) string {
+	if !strings.HasPrefix(line, "#!") {
+		return ""
+	}
+
+	fields := strings.Fields(line[2:])
+	if len(fields) == 0 {
+		return ""
+	}
+
+	interpreter := filepath.Base(fields[0])
+	if interpreter == "env" {
+		interpreter = ""
+		for _, arg := range fields[1:] {
+			// Skip env options such as -S and variable assignments
+			if strings.HasPrefix(arg, "-") || strings.Contains(arg, "=") {
+				continue
+			}
+			interpreter = filepath.Base(arg)
+			break
+		}
+	}
+	return interpreter
+}
+
+// GetLanguageByShebang returns the language for an interpreter name. Version
+// suffixes fall back to the longest known prefix, so "python3.11" resolves
+// through "python3".
+func GetLanguageByShebang(interpreter string) *Language {
+	for name := interpreter; name != ""; name = name[:len(name)-1] {
+		if lang, ok := ShebangLanguages[name]; ok {
+			return lang
+		}
+		if last := name[len(name)-1]; last != '.' && (last < '0' || last > '9') {
+			break
+		}
+	}
+	return nil
+}
+
+// DetectShebang returns the language named by the shebang line of the file
+// at path, or nil if it has none or names an unknown interpreter
+func DetectShebang(path string) *Language {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 256)
+	line, err := reader.ReadSlice('\n')
+	if err != nil && err != bufio.ErrBufferFull && len(line) == 0 {
+		return nil
+	}
+	return GetLanguageByShebang(ParseShebang(strings.TrimRight(string(line), "\r\n")))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseShebang(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"#!/bin/sh", "sh"},
+		{"#!/bin/bash -e", "bash"},
+		{"#! /usr/bin/python2", "python2"},
+		{"#!/usr/bin/env python3", "python3"},
+		{"#!/usr/bin/env -S node --experimental-modules", "node"},
+		{"#!/usr/bin/env LANG=C perl", "perl"},
+		{"#!", ""},
+		{"# not a shebang", ""},
+		{"package main", ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseShebang(tt.line); got != tt.want {
+			t.Errorf("ParseShebang(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestGetLanguageByShebang(t *testing.T) {
+	tests := []struct {
+		interpreter string
+		want        string
+	}{
+		{"python", "Python"},
+		{"python3", "Python"},
+		{"python3.11", "Python"},
+		{"python2", "Python 2"},
+		{"python2.7", "Python 2"},
+		{"sh", "Shell"},
+		{"bash", "Bash"},
+		{"perl5", "Perl"},
+		{"bashful", ""},
+		{"unknown", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		got := ""
+		if lang := GetLanguageByShebang(tt.interpreter); lang != nil {
+			got = lang.Name
+		}
+		if got != tt.want {
+			t.Errorf("GetLanguageByShebang(%q) = %q, want %q", tt.interpreter, got, tt.want)
+		}
+	}
+}
+
+func TestWalkerUseShebang(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"legacy.py":  "#!/usr/bin/env python2\nprint 'hi'\n",
+		"modern.py":  "#!/usr/bin/env python3\nprint('hi')\n",
+		"plain.py":   "print('hi')\n",
+		"deploy.sh":  "#!/bin/bash\n# comment\necho hi\n",
+		"posix.sh":   "#!/bin/sh\necho hi\n",
+		"run-server": "#!/usr/bin/env node\nconsole.log('hi')\n",
+		"notes":      "no shebang here\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	languages := func(useShebang bool) map[string]string {
+		walker := NewWalker(tmpDir, 2)
+		walker.SetUseShebang(useShebang)
+		stats, _ := walker.Walk()
+		found := make(map[string]string)
+		for _, fs := range stats {
+			found[filepath.Base(fs.FilePath)] = fs.Language
+		}
+		return found
+	}
+
+	want := map[string]string{
+		"legacy.py":  "Python 2",
+		"modern.py":  "Python",
+		"plain.py":   "Python",
+		"deploy.sh":  "Bash",
+		"posix.sh":   "Shell",
+		"run-server": "JavaScript",
+	}
+	got := languages(true)
+	for name, lang := range want {
+		if got[name] != lang {
+			t.Errorf("With --use-shebang, %s = %q, want %q", name, got[name], lang)
+		}
+	}
+	if _, ok := got["notes"]; ok {
+		t.Errorf("Extensionless file without a shebang should be skipped, got %q", got["notes"])
+	}
+
+	got = languages(false)
+	if got["legacy.py"] != "Python" || got["deploy.sh"] != "Shell" {
+		t.Errorf("Without --use-shebang, extensions should decide: %v", got)
+	}
+	if _, ok := got["run-server"]; ok {
+		t.Errorf("Extensionless script should be skipped without --use-shebang")
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileChange holds the lines added to and removed from a file between two
+// commits
+type FileChange struct {
+	Path    string // joined onto the directory the changes were listed in
+	Added   int
+	Removed int
+}
+
+// ChangeRow holds the lines added and removed in the files of one language
+type ChangeRow struct {
+	Language string
+	Files    int
+	Added    int
+	Removed  int
+}
+
+// gitOutput runs git with args in dir and returns its standard output
+func gitOutput(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// ChangesSinceTag lists the files under dir, in the git repository containing
+// it, that changed between the commit tagged tag and HEAD, with their added
+// and removed lines. Renamed files are listed under their new path and binary
+// files are left out.
+func ChangesSinceTag(dir, tag string) ([]FileChange, error) {
+	// Tell a directory outside a repository apart from an unknown tag
+	if _, err := gitOutput(dir, "rev-parse", "--git-dir"); err != nil {
+		return nil, err
+	}
+	commit, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "refs/tags/"+tag+"^{commit}")
+	if err != nil {
+		return nil, fmt.Errorf("unknown tag %q", tag)
+	}
+	commit = strings.TrimSpace(commit)
+
+	out, err := gitOutput(dir, "diff", "--numstat", "-z", "--relative", commit, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	// Each entry is "added\tremoved\tpath", or "added\tremoved\t" followed by
+	// the old and new paths for a rename; binary files count "-" lines
+	var changes []FileChange
+	fields := strings.Split(out, "\x00")
+	for i := 0; i < len(fields); i++ {
+		counts := strings.SplitN(fields[i], "\t", 3)
+		if len(counts) != 3 {
+			continue
+		}
+		path := counts[2]
+		if path == "" && i+2 < len(fields) {
+			path = fields[i+2]
+			i += 2
+		}
+		added, errAdded := strconv.Atoi(counts[0])
+		removed, errRemoved := strconv.Atoi(counts[1])
+		if errAdded != nil || errRemoved != nil {
+			LogDebug("Skipping binary change: %s", path)
+			continue
+		}
+		changes = append(changes, FileChange{
+			Path:    filepath.Join(dir, filepath.FromSlash(path)),
+			Added:   added,
+			Removed: removed,
+		})
+	}
+	LogDebug("Found %d files changed since %s (%s) in %s", len(changes), tag, commit, dir)
+	return changes, nil
+}
+
+// pathLanguage returns the language of a file from its extension or name
+// alone, since a file removed since the tag cannot be read
+func pathLanguage(path string) *Language {
+	ext := filepath.Ext(path)
+	if lang := GetLanguage(strings.ToLower(ext)); lang != nil {
+		return lang
+	}
+	if lang := GetLanguage(ext); lang != nil {
+		return lang
+	}
+	return GetLanguageByFilename(filepath.Base(path))
+}
+
+// AggregateChanges sums the changes per language, detected by pathLanguage.
+// Files without a known language are left out. rename maps the canonical
+// language name to the row it is reported under. Rows are sorted by lines
+// changed (descending), then by name.
+func AggregateChanges(changes []FileChange, rename func(string) string) []ChangeRow {
+	rows := make(map[string]*ChangeRow)
+	for _, change := range changes {
+		lang := pathLanguage(change.Path)
+		if lang == nil {
+			LogDebug("Skipping change to unsupported file: %s", change.Path)
+			continue
+		}
+		name := rename(CanonicalLanguageName(lang.Name))
+		if _, ok := rows[name]; !ok {
+			rows[name] = &ChangeRow{Language: name}
+		}
+		rows[name].Files++
+		rows[name].Added += change.Added
+		rows[name].Removed += change.Removed
+	}
+
+	result := make([]ChangeRow, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, *row)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ci, cj := result[i].Added+result[i].Removed, result[j].Added+result[j].Removed
+		if ci != cj {
+			return ci > cj
+		}
+		return result[i].Language < result[j].Language
+	})
+	return result
+}
+
+// RunSinceTag prints the lines added and removed per language between the
+// tag in config.SinceTag and HEAD
+func RunSinceTag(config *Config) error {
+	startTime := time.Now()
+
+	changes, err := ChangesSinceTag(config.Path, config.SinceTag)
+	if err != nil {
+		LogError("Failed to list the changes since %s in %s: %v", config.SinceTag, config.Path, err)
+		return err
+	}
+
+	// Report aliases and groups as the other outputs do
+	langStats := make(map[string]*LanguageStats)
+	for _, change := range changes {
+		if lang := pathLanguage(change.Path); lang != nil {
+			name := CanonicalLanguageName(lang.Name)
+			langStats[name] = &LanguageStats{Language: name}
+		}
+	}
+	rows := AggregateChanges(changes, RowLanguage(langStats, config.Aliases, config.Groups))
+
+	PrintChanges(config.SinceTag, rows)
+
+	LogInfo("Time elapsed: %v", time.Since(startTime).Round(time.Millisecond))
+	return nil
+}
+
+// PrintChanges prints the rows produced by AggregateChanges, followed by the
+// total row
+func PrintChanges(tag string, rows []ChangeRow) {
+	languages := make([]string, 0, len(rows))
+	for _, row := range rows {
+		languages = append(languages, row.Language)
+	}
+	langWidth := languageColumnWidth(languages, colFiles, colCode, colCode, colCode)
+	width := tableWidth(langWidth, colFiles, colCode, colCode, colCode)
+
+	line := func(language string, files, added, removed int) {
+		fmt.Printf("%-*s %*d %*s %*s %*s\n", langWidth, language, colFiles, files,
+			colCode, fmt.Sprintf("+%d", added), colCode, fmt.Sprintf("-%d", removed), colCode, formatDelta(added-removed))
+	}
+
+	fmt.Println()
+	fmt.Printf("Since: %s\n", tag)
+	fmt.Println(strings.Repeat("-", width))
+	fmt.Printf("%-*s %*s %*s %*s %*s\n", langWidth, "Language", colFiles, "Files", colCode, "Added", colCode, "Removed", colCode, "Net")
+	fmt.Println(strings.Repeat("-", width))
+
+	var total ChangeRow
+	for _, row := range rows {
+		line(truncateLanguage(row.Language, langWidth), row.Files, row.Added, row.Removed)
+		total.Files += row.Files
+		total.Added += row.Added
+		total.Removed += row.Removed
+	}
+
+	fmt.Println(strings.Repeat("-", width))
+	line("Total", total.Files, total.Added, total.Removed)
+	fmt.Println(strings.Repeat("-", width))
+	fmt.Println()
+}
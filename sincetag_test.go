@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// createTaggedRepo creates a repository with commits tagged v1 and v2,
+// followed by an untagged commit
+func createTaggedRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	write("main.go", "package main\n\nfunc main() {}\n")
+	write("old.py", "x = 1\ny = 2\n")
+	write("logo.png", "\x89PNG\r\n\x1a\n\x00")
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "first")
+	runGit(t, dir, "tag", "v1")
+
+	write("main.go", "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n")
+	write("lib/util.go", "package lib\n")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "second")
+	runGit(t, dir, "tag", "-a", "v2", "-m", "release 2")
+
+	write("logo.png", "\x89PNG\r\n\x1a\n\x00\x01")
+	write("notes.unknown", "a\n")
+	runGit(t, dir, "rm", "--quiet", "old.py")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "third")
+
+	return dir
+}
+
+func TestChangesSinceTag(t *testing.T) {
+	dir := createTaggedRepo(t)
+
+	changes, err := ChangesSinceTag(dir, "v1")
+	if err != nil {
+		t.Fatalf("ChangesSinceTag(v1) error = %v", err)
+	}
+	rows := AggregateChanges(changes, func(lang string) string { return lang })
+	want := []ChangeRow{
+		{Language: "Go", Files: 2, Added: 6, Removed: 1},
+		{Language: "Python", Files: 1, Removed: 2},
+	}
+	if len(rows) != len(want) {
+		t.Fatalf("AggregateChanges(v1) = %+v, want %+v", rows, want)
+	}
+	for i := range want {
+		if rows[i] != want[i] {
+			t.Errorf("Row %d = %+v, want %+v", i, rows[i], want[i])
+		}
+	}
+
+	// Annotated tags resolve to the commit they point at
+	changes, err = ChangesSinceTag(dir, "v2")
+	if err != nil {
+		t.Fatalf("ChangesSinceTag(v2) error = %v", err)
+	}
+	rows = AggregateChanges(changes, func(lang string) string { return lang })
+	if len(rows) != 1 || rows[0] != (ChangeRow{Language: "Python", Files: 1, Removed: 2}) {
+		t.Errorf("AggregateChanges(v2) = %+v, want only the removed Python file", rows)
+	}
+
+	if _, err := ChangesSinceTag(dir, "v9"); err == nil {
+		t.Error("ChangesSinceTag should fail for an unknown tag")
+	}
+	if _, err := ChangesSinceTag(t.TempDir(), "v1"); err == nil {
+		t.Error("ChangesSinceTag should fail outside a git repository")
+	}
+}
+
+func TestRunSinceTag(t *testing.T) {
+	dir := createTaggedRepo(t)
+
+	config := &Config{Path: dir, SinceTag: "v1", Quiet: true, Groups: map[string]string{"Go": "Backend", "Python": "Backend"}}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+	if !containsRow(output, "Backend", "3", "+6", "-3", "+3") || !containsRow(output, "Total", "3", "+6", "-3", "+3") {
+		t.Errorf("Expected a Backend row with the changes since v1:\n%s", output)
+	}
+
+	err := Run(&Config{Path: dir, SinceTag: "v9", Quiet: true})
+	if err == nil || !strings.Contains(err.Error(), `unknown tag "v9"`) {
+		t.Errorf("Run() error = %v, want an unknown tag error", err)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import "sort"
+
+// SkipReason tells why a file was not counted
+type SkipReason int
+
+const (
+	SkipExcluded  SkipReason = iota // matched an --ignore pattern
+	SkipBinary                      // binary file extension
+	SkipHidden                      // hidden file without a known language
+	SkipUnknown                     // no language for the extension or name
+	SkipMalformed                   // unreadable notebook
+	SkipEmpty                       // zero-byte file, with --skip-empty
+	SkipWhiteout                    // whiteout entry of an image layer tar
+	SkipLinked                      // file already counted through another path, with --follow-symlinks
+	SkipTimeout                     // counting took longer than --per-file-timeout
+)
+
+// SkipReasons lists every SkipReason in display order
+var SkipReasons = []SkipReason{SkipExcluded, SkipBinary, SkipHidden, SkipUnknown, SkipMalformed, SkipEmpty, SkipWhiteout, SkipLinked, SkipTimeout}
+
+// String returns the description of r shown in the skipped-file breakdown
+func (r SkipReason) String() string {
+	switch r {
+	case SkipExcluded:
+		return "excluded"
+	case SkipBinary:
+		return "binary"
+	case SkipHidden:
+		return "hidden"
+	case SkipUnknown:
+		return "unknown type"
+	case SkipMalformed:
+		return "malformed notebook"
+	case SkipEmpty:
+		return "empty"
+	case SkipWhiteout:
+		return "whiteout"
+	case SkipLinked:
+		return "already counted"
+	case SkipTimeout:
+		return "timed out"
+	default:
+		return "unknown reason"
+	}
+}
+
+// SkippedFile records a file that was not counted and why
+type SkippedFile struct {
+	Path   string
+	Reason SkipReason
+}
+
+// CountSkipReasons returns the number of skipped files per reason
+func CountSkipReasons(skipped []SkippedFile) map[SkipReason]int {
+	counts := make(map[SkipReason]int)
+	for _, sf := range skipped {
+		counts[sf.Reason]++
+	}
+	return counts
+}
+
+// sortSkippedFiles sorts skipped files by path
+func sortSkippedFiles(skipped []SkippedFile) {
+	sort.Slice(skipped, func(i, j int) bool {
+		return skipped[i].Path < skipped[j].Path
+	})
+}
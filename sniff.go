@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLength is the number of bytes http.DetectContentType looks at
+const sniffLength = 512
+
+// SniffText reports whether the start of the file at path looks like text
+// rather than binary data, judged by http.DetectContentType. A file that
+// cannot be read is reported as text so counting it reports the error.
+func SniffText(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return true
+	}
+	defer file.Close()
+
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return true
+	}
+	return strings.HasPrefix(http.DetectContentType(buf[:n]), "text/")
+}
+
+// sniffLanguage applies content sniffing to a file detected as lang. It
+// returns false if the file looks binary, and otherwise the language to
+// count it with: lang, or Text if no other rule recognized the file.
+func sniffLanguage(path string, lang *Language) (*Language, bool) {
+	if !SniffText(path) {
+		return nil, false
+	}
+	if lang == nil {
+		return Languages[".txt"], true
+	}
+	return lang, true
+}
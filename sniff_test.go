@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSniffText(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string][]byte{
+		"text":   []byte("plain text\nwith lines\n"),
+		"empty":  nil,
+		"binary": {0x7f, 'E', 'L', 'F', 0x02, 0x01, 0x01, 0x00, 0x00, 0x00},
+		"png":    {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00},
+		"utf16":  {0xff, 0xfe, 'h', 0x00, 'i', 0x00, '\n', 0x00},
+	}
+	want := map[string]bool{"text": true, "empty": true, "binary": false, "png": false, "utf16": true}
+
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+		if got := SniffText(path); got != want[name] {
+			t.Errorf("SniffText(%s) = %t, want %t", name, got, want[name])
+		}
+	}
+	if !SniffText(filepath.Join(tmpDir, "missing")) {
+		t.Error("A missing file should be reported as text so counting reports the error")
+	}
+}
+
+func TestWalkerSniffContent(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string][]byte{
+		"main.go":     []byte("package main\n"),
+		"notes.draft": []byte("a text file\nwith an unknown extension\n"),
+		"image.txt":   {0x89, 'P', 'N', 'G', '\r', '\n', 0x1a, '\n', 0x00, 0x00},
+		"readme.txt":  []byte("real text\n"),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), content, 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	languages := func(sniff bool) (map[string]string, *Walker) {
+		walker := NewWalker(tmpDir, 2)
+		walker.SetSniffContent(sniff)
+		stats, _ := walker.Walk()
+		found := make(map[string]string)
+		for _, fs := range stats {
+			found[filepath.Base(fs.FilePath)] = fs.Language
+		}
+		return found, walker
+	}
+
+	got, walker := languages(true)
+	want := map[string]string{"main.go": "Go", "notes.draft": "Text", "readme.txt": "Text"}
+	for name, lang := range want {
+		if got[name] != lang {
+			t.Errorf("With --sniff-content, %s = %q, want %q", name, got[name], lang)
+		}
+	}
+	if lang, ok := got["image.txt"]; ok {
+		t.Errorf("Binary content with a .txt extension should be skipped, got %q", lang)
+	}
+	if counts := CountSkipReasons(walker.GetSkippedFiles()); counts[SkipBinary] != 1 {
+		t.Errorf("Expected 1 file skipped as binary, got %v", counts)
+	}
+
+	got, _ = languages(false)
+	if got["image.txt"] != "Text" {
+		t.Errorf("Without --sniff-content, the extension should decide: %v", got)
+	}
+	if _, ok := got["notes.draft"]; ok {
+		t.Errorf("Without --sniff-content, an unknown extension should be skipped: %v", got)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// StagedFiles returns the files staged in the git repository containing dir
+// that lie under dir. Only added, copied and modified files are listed, so
+// staged deletions are left out. Paths are joined onto dir.
+func StagedFiles(dir string) ([]string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", "diff", "--cached", "--name-only", "--diff-filter=ACM", "--relative", "-z")
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("git diff --cached: %w", err)
+	}
+
+	var paths []string
+	for _, name := range strings.Split(stdout.String(), "\x00") {
+		if name != "" {
+			paths = append(paths, filepath.Join(dir, filepath.FromSlash(name)))
+		}
+	}
+	LogDebug("Found %d staged files in %s", len(paths), dir)
+	return paths, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// createStagedRepo creates a repository with one commit followed by staged
+// and unstaged changes
+func createStagedRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	write("staged.go", "package main\n")
+	write("unstaged.go", "package main\n")
+	write("deleted.py", "x = 1\n")
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "--quiet", "-m", "initial")
+
+	write("staged.go", "package main\n\nfunc main() {}\n")
+	write("added.py", "# comment\nx = 1\n")
+	runGit(t, dir, "add", "staged.go", "added.py")
+	runGit(t, dir, "rm", "--quiet", "deleted.py")
+	write("unstaged.go", "package main\n\nvar x = 1\n")
+	write("untracked.go", "package main\n")
+
+	return dir
+}
+
+func TestStagedFiles(t *testing.T) {
+	dir := createStagedRepo(t)
+
+	paths, err := StagedFiles(dir)
+	if err != nil {
+		t.Fatalf("StagedFiles failed: %v", err)
+	}
+	slices.Sort(paths)
+	want := []string{filepath.Join(dir, "added.py"), filepath.Join(dir, "staged.go")}
+	if !slices.Equal(paths, want) {
+		t.Errorf("StagedFiles() = %v, want %v", paths, want)
+	}
+
+	if _, err := StagedFiles(t.TempDir()); err == nil {
+		t.Error("Expected an error outside a git repository")
+	}
+}
+
+func TestRunGitStaged(t *testing.T) {
+	dir := createStagedRepo(t)
+
+	config := &Config{
+		Path:         dir,
+		GitStaged:    true,
+		OutputFormat: "default",
+		Quiet:        true,
+		ByFile:       true,
+		RelativeTo:   dir,
+	}
+	output := captureStdout(func() {
+		if err := Run(config); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	if !containsRow(output, "staged.go", "Go", "1", "0", "2", "3") {
+		t.Errorf("Expected staged.go row:\n%s", output)
+	}
+	if !containsRow(output, "added.py", "Python", "0", "1", "1", "2") {
+		t.Errorf("Expected added.py row:\n%s", output)
+	}
+	if !containsRow(output, "Total", "2", "1", "1", "3", "5") {
+		t.Errorf("Expected only the staged files to be counted:\n%s", output)
+	}
+
+	err := Run(&Config{Path: t.TempDir(), GitStaged: true, Quiet: true})
+	if err == nil {
+		t.Error("Expected an error for a directory outside a git repository")
+	}
+}
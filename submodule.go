@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readGitmodules returns the submodule paths listed in the .gitmodules file
+// at the top of root, relative to root in slash form. A missing or
+// unreadable file lists none.
+func readGitmodules(root string) map[string]bool {
+	paths := make(map[string]bool)
+	file, err := os.Open(filepath.Join(root, ".gitmodules"))
+	if err != nil {
+		return paths
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok || strings.TrimSpace(key) != "path" {
+			continue
+		}
+		if path := strings.TrimSpace(value); path != "" {
+			paths[filepath.ToSlash(filepath.Clean(path))] = true
+		}
+	}
+	return paths
+}
+
+// hasGitFile reports whether dir holds a .git file rather than a .git
+// directory, as a checked-out submodule or a linked worktree does
+func hasGitFile(dir string) bool {
+	info, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil && info.Mode().IsRegular()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// whiteoutPrefix starts the names of the whiteout entries of an OCI or
+// Docker image layer, which delete a file of a lower layer rather than hold
+// one, such as ".wh.main.go" or the opaque directory marker ".wh..wh..opq"
+const whiteoutPrefix = ".wh."
+
+// imageMetadata names the files docker save writes next to the layers of an
+// image, which describe the image rather than hold its sources
+var imageMetadata = map[string]bool{
+	"manifest.json": true,
+	"index.json":    true,
+	"oci-layout":    true,
+	"repositories":  true,
+}
+
+// isImageMetadata reports whether the entry name of an archive exported by
+// docker save is image metadata: one of imageMetadata, an image config named
+// after its digest, or any other blob of an OCI layout
+func isImageMetadata(name string) bool {
+	if imageMetadata[name] || strings.HasPrefix(name, "blobs/") {
+		return true
+	}
+	digest, ok := strings.CutSuffix(name, ".json")
+	return ok && len(digest) == 64 && strings.Trim(digest, "0123456789abcdef") == ""
+}
+
+// isTarPath reports whether path names a tar archive, gzipped or not, whose
+// entries are counted rather than the archive itself
+func isTarPath(p string) bool {
+	name := strings.ToLower(p)
+	return strings.HasSuffix(name, ".tar") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// tarStream returns the content of r decompressed if it is gzipped, and
+// whether that content is a tar archive, going by the "ustar" magic of its
+// first header
+func tarStream(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, err
+		}
+		br = bufio.NewReader(gz)
+	}
+	header, _ := br.Peek(262)
+	return br, len(header) == 262 && bytes.Equal(header[257:262], []byte("ustar")), nil
+}
+
+// tarScan holds the state of counting the entries of a tar archive
+type tarScan struct {
+	config      *Config
+	opts        CountOptions
+	preferred   map[string]*Language
+	exts        map[string]*Language
+	data        []string
+	excludeDirs map[string]bool
+	excludeFile map[string]bool // slash-separated entry names
+	result      *ScanResult
+}
+
+// ScanTar counts the regular files in the tar archive at path, gzipped or
+// not, as an image layer or a source tarball. Entries that are tar archives
+// themselves, such as the layers of an image exported by docker save, are
+// counted entry by entry in turn, one level deep. Whiteout entries are
+// skipped, and files are reported as the archive path joined with their
+// name. Languages are found by name alone: --use-shebang, --use-modeline and
+// --sniff-content do not apply to entries.
+func ScanTar(config *Config, archive string) (*ScanResult, error) {
+	preferred, err := config.preferredLanguages()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &tarScan{
+		config:      config,
+		opts:        config.countOptions(),
+		preferred:   preferred,
+		exts:        extensionLanguages(config.Extensions),
+		data:        dataSuffixes(config.dataExtensions()),
+		excludeDirs: make(map[string]bool),
+		excludeFile: make(map[string]bool),
+		result:      &ScanResult{},
+	}
+	for _, dirs := range [][]string{DefaultExcludeDirs, config.ExcludeDirs} {
+		for _, dir := range dirs {
+			s.excludeDirs[dir] = true
+		}
+	}
+	for _, file := range config.ExcludeFiles {
+		s.excludeFile[path.Clean(strings.TrimPrefix(filepath.ToSlash(file), "./"))] = true
+	}
+
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	content, ok, err := tarStream(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", archive, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%s is not a tar archive", archive)
+	}
+	if err := s.scan(content, archive, 0); err != nil {
+		return nil, fmt.Errorf("%s: %w", archive, err)
+	}
+	sortSkippedFiles(s.result.Skipped)
+
+	s.result.LangStats = AggregateStats(s.result.FileStats)
+	s.result.Embedded = AggregateEmbedded(s.result.FileStats)
+	return s.result, nil
+}
+
+// scan counts the entries of the tar archive read from r, reported under
+// prefix, descending into archives among them while depth is 0
+func (s *tarScan) scan(r io.Reader, prefix string, depth int) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		display := filepath.Join(prefix, filepath.FromSlash(name))
+
+		if strings.HasPrefix(path.Base(name), whiteoutPrefix) {
+			LogDebug("Skipping whiteout entry: %s", display)
+			s.skip(display, SkipWhiteout)
+			continue
+		}
+		if s.excluded(name) {
+			LogDebug("Skipping excluded entry: %s", display)
+			s.skip(display, SkipExcluded)
+			continue
+		}
+
+		content, isTar, err := tarStream(tr)
+		if err == nil && isTar {
+			if depth > 0 {
+				LogDebug("Skipping nested archive: %s", display)
+				s.skip(display, SkipBinary)
+				continue
+			}
+			LogDebug("Counting the entries of layer %s", display)
+			if err := s.scan(content, display, depth+1); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			// Gzipped, but not a tar archive
+			s.skip(display, SkipBinary)
+			continue
+		}
+		if depth == 0 && isImageMetadata(name) {
+			LogDebug("Skipping image metadata: %s", display)
+			s.skip(display, SkipExcluded)
+			continue
+		}
+		// Include patterns select the files counted, not the layers
+		if len(s.config.IncludePatterns) > 0 && !matchesAny(s.config.IncludePatterns, path.Base(name)) {
+			LogDebug("Skipping entry matching no include pattern: %s", display)
+			s.skip(display, SkipExcluded)
+			continue
+		}
+		s.count(content, name, display, header.Size)
+
+		if s.config.SampleFiles > 0 && s.result.ProcessedFiles >= s.config.SampleFiles {
+			s.result.Sampled = true
+			return nil
+		}
+	}
+}
+
+// excluded reports whether the entry name is in an excluded or hidden
+// directory, is excluded by exact path or matches an --ignore pattern, as
+// the walker would find it. Exact paths are relative to the root of the
+// archive or layer holding the entry.
+func (s *tarScan) excluded(name string) bool {
+	segments := strings.Split(name, "/")
+	for _, dir := range segments[:len(segments)-1] {
+		if s.excludeDirs[dir] || matchesAny(s.config.ExcludePatterns, dir) ||
+			(!s.config.IncludeHidden && strings.HasPrefix(dir, ".")) {
+			return true
+		}
+	}
+	return s.excludeFile[name] || matchesAny(s.config.ExcludePatterns, segments[len(segments)-1])
+}
+
+// count counts the entry name read from r, of the given size, reported as
+// display
+func (s *tarScan) count(r io.Reader, name, display string, size int64) {
+	base := path.Base(name)
+	ext := strings.ToLower(path.Ext(base))
+	lang := GetLanguage(ext)
+	reason := "ext " + ext
+	if lang == nil {
+		lang = GetLanguageByFilename(base)
+		reason = "filename"
+	}
+	if s.exts != nil {
+		var ok bool
+		if lang, ok = s.exts[ext]; !ok {
+			s.skip(display, SkipExcluded)
+			return
+		}
+		reason = "--ext " + ext
+	} else if isDataFile(base, s.data) {
+		lang, reason = DataLanguage, "data suffix"
+	} else if preferredLang, ok := s.preferred[ext]; ok {
+		lang, reason = preferredLang, "--prefer "+ext
+	}
+
+	if lang == nil || lang.Notebook {
+		// Notebooks are decoded from a file, not a stream
+		s.result.UnknownFiles = append(s.result.UnknownFiles, display)
+		s.skip(display, SkipUnknown)
+		return
+	}
+	if s.config.SkipEmpty && size == 0 {
+		s.skip(display, SkipEmpty)
+		return
+	}
+	logClassified(display, lang, reason)
+
+	stats, err := CountReader(r, display, lang, s.opts)
+	if err != nil {
+		LogFileError(display, err)
+		s.result.addError(NewFileError(display, err), s.config.MaxErrors)
+		return
+	}
+	stats.Extension = ext
+	s.result.FileStats = append(s.result.FileStats, stats)
+	s.result.ProcessedFiles++
+}
+
+// skip records that the entry reported as display was not counted
+func (s *tarScan) skip(display string, reason SkipReason) {
+	s.result.SkippedFiles++
+	s.result.Skipped = append(s.result.Skipped, SkippedFile{Path: display, Reason: reason})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// tarEntry is a file of a tar archive built by buildTar
+type tarEntry struct {
+	name    string
+	content string
+	symlink bool
+}
+
+// buildTar returns a tar archive holding entries
+func buildTar(t *testing.T, entries []tarEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		header := &tar.Header{Name: e.name, Mode: 0644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.symlink {
+			header = &tar.Header{Name: e.name, Linkname: e.content, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if !e.symlink {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestScanTarLayer(t *testing.T) {
+	layer := buildTar(t, []tarEntry{
+		{name: "app/main.go", content: "package main\n\n// main runs\nfunc main() {}\n"},
+		{name: "./app/util.py", content: "# util\nx = 1\n"},
+		{name: "app/.wh.old.go", content: ""},
+		{name: "app/lib/.wh..wh..opq", content: ""},
+		{name: "app/node_modules/dep.js", content: "var x;\n"},
+		{name: "app/link.go", content: "main.go", symlink: true},
+	})
+	path := filepath.Join(t.TempDir(), "layer.tar")
+	if err := os.WriteFile(path, layer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Scan(&Config{}, path)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.ProcessedFiles != 2 {
+		t.Errorf("ProcessedFiles = %d, want 2", result.ProcessedFiles)
+	}
+	if goStats := result.LangStats["Go"]; goStats == nil || goStats.CodeLines != 2 || goStats.CommentLines != 1 {
+		t.Errorf("Go stats = %+v, want 2 code and 1 comment lines", goStats)
+	}
+	if pyStats := result.LangStats["Python"]; pyStats == nil || pyStats.CodeLines != 1 {
+		t.Errorf("Python stats = %+v, want 1 code line", pyStats)
+	}
+	reasons := CountSkipReasons(result.Skipped)
+	if reasons[SkipWhiteout] != 2 || reasons[SkipExcluded] != 1 {
+		t.Errorf("Skip reasons = %v, want 2 whiteouts and 1 excluded", reasons)
+	}
+	want := filepath.Join(path, "app", "main.go")
+	found := false
+	for _, fs := range result.FileStats {
+		found = found || fs.FilePath == want
+	}
+	if !found {
+		t.Errorf("Expected %s among the counted files", want)
+	}
+}
+
+func TestScanTarImage(t *testing.T) {
+	// docker save writes the layers, gzipped or not, next to the metadata
+	first := buildTar(t, []tarEntry{{name: "src/a.go", content: "package a\n"}})
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write(buildTar(t, []tarEntry{
+		{name: "src/b.go", content: "package b\n\nvar x = 1\n"},
+		{name: "src/.wh.a.go", content: ""},
+	}))
+	gz.Close()
+
+	image := buildTar(t, []tarEntry{
+		{name: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.json", content: "{}\n"},
+		{name: "1111/layer.tar", content: string(first)},
+		{name: "2222/layer.tar.gz", content: gzipped.String()},
+		{name: "manifest.json", content: "[]\n"},
+	})
+	path := filepath.Join(t.TempDir(), "image.tar")
+	if err := os.WriteFile(path, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Scan(&Config{}, path)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	if result.ProcessedFiles != 2 || result.LangStats["JSON"] != nil {
+		t.Errorf("ProcessedFiles = %d, languages %v; want the 2 Go files only", result.ProcessedFiles, result.LangStats)
+	}
+	if goStats := result.LangStats["Go"]; goStats == nil || goStats.CodeLines != 3 {
+		t.Errorf("Go stats = %+v, want 3 code lines", goStats)
+	}
+	if reasons := CountSkipReasons(result.Skipped); reasons[SkipWhiteout] != 1 {
+		t.Errorf("Skip reasons = %v, want 1 whiteout", reasons)
+	}
+}
+
+func TestScanTarIncludeExclude(t *testing.T) {
+	layer := buildTar(t, []tarEntry{{name: "src/main.go", content: "package main\n"}})
+	archive := buildTar(t, []tarEntry{
+		{name: "1111/layer.tar", content: string(layer)},
+		{name: "app/main.go", content: "package main\n"},
+		{name: "app/gen.go", content: "package main\n"},
+		{name: "app/util.py", content: "x = 1\n"},
+	})
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tree.tar")
+	includeFile := filepath.Join(dir, "include.txt")
+	if err := os.WriteFile(path, archive, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(includeFile, []byte("*.go\n"), 0644)
+
+	config := &Config{IncludeFrom: includeFile, ExcludeFiles: []string{"./app/gen.go"}}
+	if err := config.readPatternFiles(); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Scan(config, path)
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	var counted []string
+	for _, fs := range result.FileStats {
+		counted = append(counted, fs.FilePath)
+	}
+	want := []string{filepath.Join(path, "1111", "layer.tar", "src", "main.go"), filepath.Join(path, "app", "main.go")}
+	if !reflect.DeepEqual(counted, want) {
+		t.Errorf("Counted %v, want %v", counted, want)
+	}
+	if reasons := CountSkipReasons(result.Skipped); reasons[SkipExcluded] != 2 {
+		t.Errorf("Skip reasons = %v, want gen.go and util.py excluded", reasons)
+	}
+}
+
+func TestScanTarNotArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fake.tar")
+	os.WriteFile(path, []byte("not a tar\n"), 0644)
+	if _, err := Scan(&Config{}, path); err == nil {
+		t.Error("Expected an error for a file that is not a tar archive")
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "os"
+
+// TerminalWidth is the number of columns tables may fill to show long
+// language names in full. If 0, the language column keeps its fixed width
+// and long names are truncated.
+var TerminalWidth = 0
+
+// stdoutTerminalWidth returns the width of the terminal stdout is attached
+// to, or 0 if stdout is not a terminal or its width is unknown
+func stdoutTerminalWidth() int {
+	info, err := os.Stdout.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return 0
+	}
+	return terminalWidth(os.Stdout.Fd())
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package main
+
+// terminalWidth is not implemented on this platform, so tables keep their
+// fixed widths
+func terminalWidth(fd uintptr) int {
+	return 0
+}
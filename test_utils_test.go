@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"io"
 	"os"
+	"reflect"
+	"strings"
 )
 
 func captureStdout(f func()) string {
@@ -20,3 +22,29 @@ func captureStdout(f func()) string {
 	io.Copy(&buf, r)
 	return buf.String()
 }
+
+func captureStderr(f func()) string {
+	old := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	f()
+
+	w.Close()
+	os.Stderr = old
+
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+	return buf.String()
+}
+
+// containsRow reports whether output has a line made of exactly the given
+// whitespace-separated fields
+func containsRow(output string, fields ...string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if reflect.DeepEqual(strings.Fields(line), fields) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// TreeNode is a directory or file in the tree-json output format. The
+// counts of a directory are the sums over every file below it.
+type TreeNode struct {
+	Name     string      `json:"name"`
+	Language string      `json:"language,omitempty"` // set on files only
+	Files    int         `json:"files"`
+	Blank    int         `json:"blank"`
+	Comment  int         `json:"comment"`
+	Code     int         `json:"code"`
+	Total    int         `json:"total"`
+	Children []*TreeNode `json:"children,omitempty"`
+
+	index map[string]*TreeNode // children by name
+}
+
+// child returns the child of n called name, adding it if needed
+func (n *TreeNode) child(name string) *TreeNode {
+	if c, ok := n.index[name]; ok {
+		return c
+	}
+	if n.index == nil {
+		n.index = make(map[string]*TreeNode)
+	}
+	c := &TreeNode{Name: name}
+	n.index[name] = c
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// add sums the counts of fs into n
+func (n *TreeNode) add(fs *FileStats) {
+	n.Files++
+	n.Blank += fs.BlankLines
+	n.Comment += fs.CommentLines
+	n.Code += fs.CodeLines
+	n.Total += fs.TotalLines
+}
+
+// BuildTree nests the files of fileStats by directory under a node named
+// root, which their paths are taken relative to. Children are ordered by
+// path.
+func BuildTree(root string, fileStats []*FileStats) *TreeNode {
+	tree := &TreeNode{Name: root}
+	files, paths := sortFilesByPath(fileStats, root)
+	for i, fs := range files {
+		path := filepath.ToSlash(paths[i])
+		if path == "." {
+			// The root is the file itself
+			path = filepath.Base(fs.FilePath)
+		}
+
+		node := tree
+		node.add(fs)
+		for _, part := range strings.Split(path, "/") {
+			node = node.child(part)
+			node.add(fs)
+		}
+		node.Language = fs.Language
+	}
+	return tree
+}
+
+// PrintTreeJSON prints the files of fileStats as a JSON tree of directories
+// rooted at root, as read by sunburst and treemap visualizations
+func PrintTreeJSON(w io.Writer, root string, fileStats []*FileStats) {
+	data, err := json.MarshalIndent(BuildTree(root, fileStats), "", "  ")
+	if err != nil {
+		LogError("Failed to encode JSON: %v", err)
+		return
+	}
+	fmt.Fprintln(w, string(data))
+}
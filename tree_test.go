@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	root := "repo"
+	fileStats := []*FileStats{
+		{FilePath: filepath.Join(root, "main.go"), Language: "Go", CodeLines: 10, TotalLines: 12, BlankLines: 2},
+		{FilePath: filepath.Join(root, "pkg", "a", "a.go"), Language: "Go", CodeLines: 5, TotalLines: 6, CommentLines: 1},
+		{FilePath: filepath.Join(root, "pkg", "a", "a_test.go"), Language: "Go", CodeLines: 7, TotalLines: 7},
+		{FilePath: filepath.Join(root, "pkg", "b.py"), Language: "Python", CodeLines: 3, TotalLines: 3},
+	}
+
+	tree := BuildTree(root, fileStats)
+
+	if tree.Name != root || tree.Files != 4 || tree.Code != 25 || tree.Total != 28 {
+		t.Errorf("Root = %+v, want 4 files, 25 code, 28 total", tree)
+	}
+	if len(tree.Children) != 2 || tree.Children[0].Name != "main.go" || tree.Children[1].Name != "pkg" {
+		t.Fatalf("Root children = %+v, want main.go and pkg", tree.Children)
+	}
+
+	pkg := tree.Children[1]
+	if pkg.Files != 3 || pkg.Code != 15 || pkg.Comment != 1 || pkg.Language != "" {
+		t.Errorf("pkg = %+v, want 3 files, 15 code, 1 comment", pkg)
+	}
+	if len(pkg.Children) != 2 || pkg.Children[0].Name != "a" || pkg.Children[1].Name != "b.py" {
+		t.Fatalf("pkg children = %+v, want a and b.py", pkg.Children)
+	}
+
+	a := pkg.Children[0]
+	if a.Files != 2 || a.Code != 12 || len(a.Children) != 2 {
+		t.Errorf("pkg/a = %+v, want 2 files and 12 code", a)
+	}
+	if leaf := pkg.Children[1]; leaf.Language != "Python" || leaf.Code != 3 || leaf.Children != nil {
+		t.Errorf("pkg/b.py = %+v, want a Python leaf with 3 code", leaf)
+	}
+}
+
+func TestRunTreeJSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.MkdirAll(filepath.Join(tmpDir, "cmd"), 0755)
+	os.WriteFile(filepath.Join(tmpDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "cmd", "tool.go"), []byte("package cmd\n"), 0644)
+
+	output := captureStdout(func() {
+		if err := Run(&Config{Path: tmpDir, OutputFormat: "tree-json"}); err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+	})
+
+	var tree TreeNode
+	if err := json.Unmarshal([]byte(output), &tree); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, output)
+	}
+	if tree.Files != 2 || tree.Code != 3 || len(tree.Children) != 2 {
+		t.Errorf("Root = %+v, want 2 files and 3 code", tree)
+	}
+	if cmd := tree.Children[0]; cmd.Name != "cmd" || cmd.Code != 1 || len(cmd.Children) != 1 || cmd.Children[0].Name != "tool.go" {
+		t.Errorf("First child = %+v, want cmd with tool.go", cmd)
+	}
+}
+
+func TestBuildTreeSingleFile(t *testing.T) {
+	path := filepath.Join("src", "main.go")
+	tree := BuildTree(path, []*FileStats{{FilePath: path, Language: "Go", CodeLines: 4}})
+	if len(tree.Children) != 1 || tree.Children[0].Name != "main.go" || tree.Children[0].Code != 4 {
+		t.Errorf("Single file tree = %+v", tree.Children)
+	}
+}
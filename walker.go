@@ -1,18 +1,64 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
+// countFile counts the lines of a file for Walk and scanFile, stopping once
+// ctx is done. Tests replace it to simulate slow file systems.
+var countFile = CountLinesContext
+
+// ErrFileTimeout is returned by countFileWithin for a file that took longer
+// than its budget to count
+var ErrFileTimeout = errors.New("counting took longer than --per-file-timeout")
+
+// countFileWithin counts the file at path with countFile, giving up with
+// ErrFileTimeout once timeout has passed. The caller is free to move on to
+// other files at once, even if a read is blocked, and the count stops at its
+// next read. A timeout of 0 waits for the count however long it takes.
+func countFileWithin(timeout time.Duration, path string, lang *Language, opts CountOptions) (*FileStats, error) {
+	if timeout <= 0 {
+		return countFile(context.Background(), path, lang, opts)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	type outcome struct {
+		stats *FileStats
+		err   error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		stats, err := countFile(ctx, path, lang, opts)
+		done <- outcome{stats, err}
+	}()
+
+	select {
+	case result := <-done:
+		if errors.Is(result.err, context.DeadlineExceeded) {
+			return nil, ErrFileTimeout
+		}
+		return result.stats, result.err
+	case <-ctx.Done():
+		return nil, ErrFileTimeout
+	}
+}
+
 // FileJob represents a file to be processed
 type FileJob struct {
 	Path      string
 	Extension string
 	Language  *Language
+	Info      os.FileInfo
 }
 
 // Walker handles concurrent directory traversal and file processing
@@ -21,12 +67,78 @@ type Walker struct {
 	numWorkers      int
 	excludeDirs     map[string]bool
 	excludePatterns []string
+	includePatterns []string
+	excludeFiles    map[string]bool // slash-separated paths relative to rootPath
 	includeHidden   bool
+	includeSubs     bool
+	submodules      map[string]bool
+	useShebang      bool
+	useModeline     bool
+	sniffContent    bool
+	skipEmpty       bool
+	followSymlinks  bool
+	visited         map[string]bool // real paths of the directories and files walked, with followSymlinks
+	progressDirs    bool
+	perFileTimeout  time.Duration
+	progress        *dirProgress
+	extensions      map[string]*Language
+	preferred       map[string]*Language // extension -> language forced by --prefer
+	dataSuffixes    []string
+	sampleFiles     int
+	dispatched      int
+	settled         int        // dispatched files whose outcome is known, counted or not
+	settledCond     *sync.Cond // signaled as settled grows, on mu
+	sampled         bool
+	ctx             context.Context
+	interrupted     bool
+	countOptions    CountOptions
+	cache           *FileCache
+	retainFiles     bool
 	results         []*FileStats
-	errors          []error
+	langStats       map[string]*LanguageStats
+	embedded        map[string]int
+	errors          ErrorList
 	mu              sync.Mutex
 	processedFiles  int
-	skippedFiles    int
+	skipped         []SkippedFile
+}
+
+// DefaultExcludeDirs lists the directory names skipped unless overridden
+// with SetExcludeDirs
+var DefaultExcludeDirs = []string{
+	".git",
+	".svn",
+	".hg",
+	"node_modules",
+	"vendor",
+	".idea",
+	".vscode",
+	"__pycache__",
+	".cache",
+	"dist",
+	"build",
+	"target",
+	".next",
+	".nuxt",
+	"coverage",
+	".nyc_output",
+}
+
+// VendorDirs lists the directory names of vendored dependencies, virtual
+// environments and build output pruned by --skip-vendor. Some of them are
+// also in DefaultExcludeDirs.
+var VendorDirs = []string{
+	"node_modules",
+	"bower_components",
+	"jspm_packages",
+	"vendor",
+	".venv",
+	"venv",
+	"__pycache__",
+	"Pods",
+	"target",
+	"build",
+	"dist",
 }
 
 // NewWalker creates a new Walker instance
@@ -35,32 +147,25 @@ func NewWalker(rootPath string, numWorkers int) *Walker {
 		numWorkers = runtime.NumCPU()
 	}
 
-	return &Walker{
-		rootPath:   rootPath,
-		numWorkers: numWorkers,
-		excludeDirs: map[string]bool{
-			".git":         true,
-			".svn":         true,
-			".hg":          true,
-			"node_modules": true,
-			"vendor":       true,
-			".idea":        true,
-			".vscode":      true,
-			"__pycache__":  true,
-			".cache":       true,
-			"dist":         true,
-			"build":        true,
-			"target":       true,
-			".next":        true,
-			".nuxt":        true,
-			"coverage":     true,
-			".nyc_output":  true,
-		},
+	w := &Walker{
+		rootPath:        rootPath,
+		numWorkers:      numWorkers,
+		excludeDirs:     make(map[string]bool),
 		includeHidden:   false,
 		excludePatterns: make([]string, 0),
+		excludeFiles:    make(map[string]bool),
+		retainFiles:     true,
 		results:         make([]*FileStats, 0),
-		errors:          make([]error, 0),
+		langStats:       make(map[string]*LanguageStats),
+		embedded:        make(map[string]int),
+		errors:          ErrorList{Max: DefaultMaxErrors},
+		ctx:             context.Background(),
+	}
+	w.settledCond = sync.NewCond(&w.mu)
+	for _, dir := range DefaultExcludeDirs {
+		w.excludeDirs[dir] = true
 	}
+	return w
 }
 
 // SetExcludeDirs sets custom directories to exclude
@@ -86,11 +191,141 @@ func (w *Walker) AddExcludePattern(pattern string) {
 	w.excludePatterns = append(w.excludePatterns, pattern)
 }
 
+// AddIncludePattern adds a pattern to the include list. Once any include
+// pattern is set, only files whose name matches one of them are counted.
+func (w *Walker) AddIncludePattern(pattern string) {
+	w.includePatterns = append(w.includePatterns, pattern)
+}
+
+// AddExcludeFile skips the file at path, by exact path relative to the root
+// of the walk. An absolute path is made relative to the root first.
+func (w *Walker) AddExcludeFile(path string) {
+	if filepath.IsAbs(path) {
+		if root, err := filepath.Abs(w.rootPath); err == nil {
+			if rel, err := filepath.Rel(root, path); err == nil {
+				path = rel
+			}
+		}
+	}
+	w.excludeFiles[filepath.ToSlash(filepath.Clean(path))] = true
+}
+
 // SetIncludeHidden sets whether to include hidden files
 func (w *Walker) SetIncludeHidden(include bool) {
 	w.includeHidden = include
 }
 
+// SetIncludeSubmodules sets whether git submodules are counted. By default a
+// directory listed in the .gitmodules file at the root, or holding a .git
+// file instead of a .git directory, is skipped.
+func (w *Walker) SetIncludeSubmodules(include bool) {
+	w.includeSubs = include
+}
+
+// SetUseShebang sets whether a "#!" line picks the language of a file,
+// overriding its extension or identifying a file without one
+func (w *Walker) SetUseShebang(use bool) {
+	w.useShebang = use
+}
+
+// SetExtensions restricts the walk to files with the given extensions,
+// counted generically under the extension as their language name instead of
+// through the language table. An empty list lifts the restriction.
+func (w *Walker) SetExtensions(exts []string) {
+	w.extensions = extensionLanguages(exts)
+}
+
+// SetPreferences forces the language of files with the extensions in
+// preferred, keyed by lower-cased extension with the leading dot, whatever
+// their content or shebang says
+func (w *Walker) SetPreferences(preferred map[string]*Language) {
+	w.preferred = preferred
+}
+
+// SetDataExtensions reports files whose name ends in one of exts under
+// DataLanguage instead of their own language, even if they would otherwise
+// be skipped, as lock files are. An empty list reports every file as usual.
+func (w *Walker) SetDataExtensions(exts []string) {
+	w.dataSuffixes = dataSuffixes(exts)
+}
+
+// SetSampleFiles stops the walk once n files have been counted. Files that
+// fail to be read, time out or turn out malformed do not use up the sample,
+// the walk goes on to the next ones instead. Files are visited in lexical
+// path order, so the sample is reproducible. A value of 0 counts every file.
+func (w *Walker) SetSampleFiles(n int) {
+	w.sampleFiles = n
+}
+
+// SetUseModeline sets whether a Vim or Emacs modeline near the start or end
+// of a file picks its language, overriding its extension and shebang
+func (w *Walker) SetUseModeline(use bool) {
+	w.useModeline = use
+}
+
+// SetSniffContent sets whether the start of each file is checked to skip
+// binary files with misleading extensions and count unrecognized text files
+// as Text
+func (w *Walker) SetSniffContent(sniff bool) {
+	w.sniffContent = sniff
+}
+
+// SetSkipEmpty sets whether zero-byte files are skipped instead of being
+// counted as files without lines
+func (w *Walker) SetSkipEmpty(skip bool) {
+	w.skipEmpty = skip
+}
+
+// SetFollowSymlinks sets whether symbolic links to directories are walked
+// into. Every real file is then counted once, however many links lead to it,
+// and a directory already walked is not walked again, so link cycles end.
+func (w *Walker) SetFollowSymlinks(follow bool) {
+	w.followSymlinks = follow
+}
+
+// SetProgressDirs sets whether a summary of every directory is logged at
+// Info level once its files are all counted, see dirProgress
+func (w *Walker) SetProgressDirs(progress bool) {
+	w.progressDirs = progress
+}
+
+// SetPerFileTimeout sets how long counting a single file may take before
+// it is skipped with a warning, see countFileWithin. A value of 0 sets no
+// limit.
+func (w *Walker) SetPerFileTimeout(timeout time.Duration) {
+	w.perFileTimeout = timeout
+}
+
+// SetMaxErrors sets how many errors Walk keeps and returns. Further errors
+// are only counted by GetErrorCount. A value of 0 keeps every error.
+func (w *Walker) SetMaxErrors(n int) {
+	w.errors.Max = n
+}
+
+// SetCountOptions sets the optional analyses run on every counted file
+func (w *Walker) SetCountOptions(opts CountOptions) {
+	w.countOptions = opts
+}
+
+// SetCache sets the cache consulted before counting a file and updated
+// after counting it
+func (w *Walker) SetCache(cache *FileCache) {
+	w.cache = cache
+}
+
+// SetRetainFiles sets whether Walk keeps every per-file record. When disabled,
+// results are only merged into the per-language totals returned by
+// GetLanguageStats, keeping memory flat on very large trees.
+func (w *Walker) SetRetainFiles(retain bool) {
+	w.retainFiles = retain
+}
+
+// SetContext sets a context that ends the walk early once it is done. Files
+// already being counted are finished, but no further file is counted.
+func (w *Walker) SetContext(ctx context.Context) {
+	w.ctx = ctx
+}
+
 // Walk traverses the directory tree and processes files concurrently
 func (w *Walker) Walk() ([]*FileStats, []error) {
 	jobs := make(chan FileJob, 1000)
@@ -108,15 +343,48 @@ func (w *Walker) Walk() ([]*FileStats, []error) {
 	collectWg.Add(1)
 	go w.collectResults(results, &collectWg)
 
+	if !w.includeSubs {
+		w.submodules = readGitmodules(w.rootPath)
+	}
+
 	// Walk the directory tree and send jobs
-	err := filepath.Walk(w.rootPath, func(path string, info os.FileInfo, err error) error {
+	w.visited = make(map[string]bool)
+	if w.progressDirs {
+		w.progress = newDirProgress(w.rootPath)
+	}
+	var walkFn filepath.WalkFunc
+	walkFn = func(path string, info os.FileInfo, err error) error {
+		if w.ctx.Err() != nil {
+			LogDebug("Stopping the walk: %v", w.ctx.Err())
+			w.mu.Lock()
+			w.interrupted = true
+			w.mu.Unlock()
+			return filepath.SkipAll
+		}
 		if err != nil {
-			LogDebug("Error accessing path %s: %v", path, err)
+			var walkErr error
+			if info != nil && info.IsDir() {
+				LogDirectoryError(path, err)
+				walkErr = NewDirectoryError(path, err)
+			} else {
+				LogFileError(path, err)
+				walkErr = NewFileError(path, err)
+			}
 			w.mu.Lock()
-			w.errors = append(w.errors, err)
+			w.errors.Add(walkErr)
 			w.mu.Unlock()
 			return nil // Continue walking despite errors
 		}
+		if w.progress != nil {
+			w.progress.visit(path)
+		}
+
+		// Walk into a linked directory if requested, under the link's path
+		if w.followSymlinks && info.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(path); err == nil && target.IsDir() {
+				return w.walkLink(path, walkFn)
+			}
+		}
 
 		// Skip directories
 		if info.IsDir() {
@@ -134,6 +402,12 @@ func (w *Walker) Walk() ([]*FileStats, []error) {
 				return filepath.SkipDir
 			}
 
+			// Skip git submodules unless configured otherwise
+			if !w.includeSubs && path != w.rootPath && w.isSubmodule(path) {
+				LogDebug("Skipping git submodule: %s", path)
+				return filepath.SkipDir
+			}
+
 			// Check against exclude patterns
 			for _, pattern := range w.excludePatterns {
 				match, err := filepath.Match(pattern, dirName)
@@ -143,30 +417,74 @@ func (w *Walker) Walk() ([]*FileStats, []error) {
 				}
 			}
 
+			// Skip directories already reached through a link
+			if w.followSymlinks && w.seen(path) {
+				LogDebug("Skipping directory already walked: %s", path)
+				return filepath.SkipDir
+			}
+
+			if w.progress != nil {
+				w.progress.enter(path)
+			}
 			return nil
 		}
 
 		fileName := info.Name()
 		ext := strings.ToLower(filepath.Ext(path))
 
+		// Check against the files excluded by exact path
+		if len(w.excludeFiles) > 0 {
+			if rel, err := filepath.Rel(w.rootPath, path); err == nil && w.excludeFiles[filepath.ToSlash(rel)] {
+				LogDebug("Skipping excluded file: %s", path)
+				w.skip(path, SkipExcluded)
+				return nil
+			}
+		}
+
 		// Check against exclude patterns
 		for _, pattern := range w.excludePatterns {
 			match, err := filepath.Match(pattern, fileName)
 			if err == nil && match {
 				LogDebug("Skipping file matching pattern %s: %s", pattern, path)
-				w.mu.Lock()
-				w.skippedFiles++
-				w.mu.Unlock()
+				w.skip(path, SkipExcluded)
 				return nil
 			}
 		}
 
+		// Check against include patterns
+		if len(w.includePatterns) > 0 && !matchesAny(w.includePatterns, fileName) {
+			LogDebug("Skipping file matching no include pattern: %s", path)
+			w.skip(path, SkipExcluded)
+			return nil
+		}
+
+		// Count only the requested extensions, bypassing language detection
+		if w.extensions != nil {
+			lang, ok := w.extensions[ext]
+			switch {
+			case !ok:
+				w.skip(path, SkipExcluded)
+			case strings.HasPrefix(fileName, ".") && !w.includeHidden:
+				LogDebug("Skipping hidden file: %s", path)
+				w.skip(path, SkipHidden)
+			default:
+				logClassified(path, lang, "--ext "+ext)
+				return w.dispatch(jobs, FileJob{Path: path, Extension: ext, Language: lang, Info: info})
+			}
+			return nil
+		}
+
+		// Report data files separately from code if requested. This comes
+		// before the binary check, which skips lock and minified files.
+		if isDataFile(fileName, w.dataSuffixes) && (w.includeHidden || !strings.HasPrefix(fileName, ".")) {
+			logClassified(path, DataLanguage, "data suffix")
+			return w.dispatch(jobs, FileJob{Path: path, Extension: ext, Language: DataLanguage, Info: info})
+		}
+
 		// Skip binary files first
 		if IsBinaryExtension(ext) {
 			LogDebug("Skipping binary file: %s", path)
-			w.mu.Lock()
-			w.skippedFiles++
-			w.mu.Unlock()
+			w.skip(path, SkipBinary)
 			return nil
 		}
 
@@ -176,57 +494,94 @@ func (w *Walker) Walk() ([]*FileStats, []error) {
 			lang := GetLanguageByFilename(fileName)
 			if lang != nil {
 				// It's a known config file, process it
-				jobs <- FileJob{
+				logClassified(path, lang, "filename")
+				return w.dispatch(jobs, FileJob{
 					Path:      path,
 					Extension: ext,
 					Language:  lang,
-				}
-				return nil
+					Info:      info,
+				})
 			}
 			// Unknown hidden file, skip unless includeHidden is set
 			if !w.includeHidden {
 				LogDebug("Skipping unknown hidden file: %s", path)
-				w.mu.Lock()
-				w.skippedFiles++
-				w.mu.Unlock()
+				w.skip(path, SkipHidden)
 				return nil
 			}
 		}
 
 		// Try to get language by extension first
 		lang := GetLanguage(ext)
+		reason := "ext " + ext
 		if lang == nil {
 			// Try case-sensitive lookup for extensions like .R
 			lang = GetLanguage(filepath.Ext(path))
+			reason = "ext " + filepath.Ext(path)
 		}
 
 		// If no language found by extension, try by filename
 		if lang == nil {
 			lang = GetLanguageByFilename(fileName)
+			reason = "filename"
+		}
+
+		// Let a shebang refine or supply the language if enabled
+		if w.useShebang {
+			if shebangLang := DetectShebang(path); shebangLang != nil {
+				lang, reason = shebangLang, "shebang"
+			}
+		}
+
+		// Let a modeline override the language if enabled
+		if w.useModeline {
+			if modelineLang := DetectModeline(path); modelineLang != nil {
+				lang, reason = modelineLang, "modeline"
+			}
+		}
+
+		// Let the content rule out binary files and catch unknown text
+		if w.sniffContent {
+			sniffed, text := sniffLanguage(path, lang)
+			if !text {
+				LogDebug("Skipping binary content: %s", path)
+				w.skip(path, SkipBinary)
+				return nil
+			}
+			if lang == nil {
+				reason = "content"
+			}
+			lang = sniffed
+		}
+
+		// Let --prefer settle the language of an ambiguous extension
+		if preferred, ok := w.preferred[ext]; ok {
+			lang, reason = preferred, "--prefer "+ext
 		}
 
 		// If still no language found, skip the file
 		if lang == nil {
 			LogDebug("Skipping unsupported file: %s", path)
-			w.mu.Lock()
-			w.skippedFiles++
-			w.mu.Unlock()
+			w.skip(path, SkipUnknown)
 			return nil
 		}
+		logClassified(path, lang, reason)
 
 		// Send job to workers
-		jobs <- FileJob{
+		return w.dispatch(jobs, FileJob{
 			Path:      path,
 			Extension: ext,
 			Language:  lang,
-		}
-
-		return nil
-	})
+			Info:      info,
+		})
+	}
+	err := filepath.Walk(w.rootPath, walkFn)
+	if w.progress != nil {
+		w.progress.finish()
+	}
 
 	if err != nil {
 		w.mu.Lock()
-		w.errors = append(w.errors, err)
+		w.errors.Add(err)
 		w.mu.Unlock()
 	}
 
@@ -238,7 +593,119 @@ func (w *Walker) Walk() ([]*FileStats, []error) {
 	close(results)
 	collectWg.Wait()
 
-	return w.results, w.errors
+	return w.results, w.errors.Errors()
+}
+
+// isSubmodule reports whether the directory at path is a git submodule
+func (w *Walker) isSubmodule(path string) bool {
+	if hasGitFile(path) {
+		return true
+	}
+	rel, err := filepath.Rel(w.rootPath, path)
+	return err == nil && w.submodules[filepath.ToSlash(rel)]
+}
+
+// walkLink walks the directory the symbolic link at path points to with
+// walkFn, as if its files were below path
+func (w *Walker) walkLink(path string, walkFn filepath.WalkFunc) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		LogDirectoryError(path, err)
+		return nil
+	}
+	LogDebug("Following symlink %s to %s", path, target)
+	err = filepath.Walk(target, func(p string, info os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(target, p)
+		if relErr != nil {
+			return relErr
+		}
+		return walkFn(filepath.Join(path, rel), info, err)
+	})
+	if err != nil {
+		return err
+	}
+	// filepath.Walk ends quietly when walkFn stops the walk
+	if w.sampled || w.ctx.Err() != nil {
+		return filepath.SkipAll
+	}
+	return nil
+}
+
+// seen reports whether the real path of the file or directory at path was
+// already walked, and records it otherwise
+func (w *Walker) seen(path string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil {
+		real, err = filepath.Abs(real)
+	}
+	if err != nil {
+		return false
+	}
+	if w.visited[real] {
+		return true
+	}
+	w.visited[real] = true
+	return false
+}
+
+// dispatch sends job to the workers, ending the walk with filepath.SkipAll
+// once the sample limit is reached, see reachedSample
+func (w *Walker) dispatch(jobs chan<- FileJob, job FileJob) error {
+	if w.followSymlinks && w.seen(job.Path) {
+		LogDebug("Skipping file already counted through another path: %s", job.Path)
+		w.skip(job.Path, SkipLinked)
+		return nil
+	}
+	if w.skipEmpty && isEmptyFile(job.Path, job.Info) {
+		LogDebug("Skipping empty file: %s", job.Path)
+		w.skip(job.Path, SkipEmpty)
+		return nil
+	}
+	if w.progress != nil {
+		w.progress.dispatched(job.Path)
+	}
+	jobs <- job
+	w.dispatched++
+	if w.sampleFiles > 0 && w.reachedSample() {
+		LogDebug("Stopping after a sample of %d files", w.sampleFiles)
+		return filepath.SkipAll
+	}
+	return nil
+}
+
+// reachedSample reports whether sampleFiles files have been counted. While
+// the files in flight could complete the sample, it waits for them to
+// settle, so that no file past the sample is dispatched.
+func (w *Walker) reachedSample() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.processedFiles+w.dispatched-w.settled < w.sampleFiles {
+		return false
+	}
+	for w.settled < w.dispatched {
+		w.settledCond.Wait()
+	}
+	w.sampled = w.processedFiles >= w.sampleFiles
+	return w.sampled
+}
+
+// isEmptyFile reports whether the file at path, described by info, has no
+// content. Symbolic links are resolved with os.Stat.
+func isEmptyFile(path string, info os.FileInfo) bool {
+	if info == nil || info.Mode()&os.ModeSymlink != 0 {
+		var err error
+		if info, err = os.Stat(path); err != nil {
+			return false
+		}
+	}
+	return info.Size() == 0
+}
+
+// skip records a file that will not be counted
+func (w *Walker) skip(path string, reason SkipReason) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.skipped = append(w.skipped, SkippedFile{Path: path, Reason: reason})
 }
 
 // worker processes files from the jobs channel
@@ -246,13 +713,50 @@ func (w *Walker) worker(jobs <-chan FileJob, results chan<- CountResult, wg *syn
 	defer wg.Done()
 
 	for job := range jobs {
-		stats, err := CountLines(job.Path, job.Language)
+		// Drain the remaining jobs without counting them once the context
+		// is done
+		if w.ctx.Err() != nil {
+			w.mu.Lock()
+			w.interrupted = true
+			w.settled++
+			w.settledCond.Broadcast()
+			w.mu.Unlock()
+			continue
+		}
+
+		if w.cache != nil && job.Info != nil {
+			if stats, ok := w.cache.Get(job.Path, job.Info, job.Language); ok {
+				stats.Extension = job.Extension
+				results <- CountResult{Stats: stats, Path: job.Path}
+				continue
+			}
+		}
+
+		stats, err := countFileWithin(w.perFileTimeout, job.Path, job.Language, w.countOptions)
+		if errors.Is(err, ErrFileTimeout) {
+			LogWarn("Skipping %s: counting took longer than %v", job.Path, w.perFileTimeout)
+			results <- CountResult{Skipped: true, SkipReason: SkipTimeout, Path: job.Path}
+			continue
+		}
 		if stats != nil {
 			stats.Extension = job.Extension
+			if w.cache != nil && job.Info != nil && err == nil {
+				w.cache.Put(job.Path, job.Info, job.Language, stats)
+			}
+		}
+		if errors.Is(err, ErrMalformedNotebook) {
+			LogFileError(job.Path, err)
+			results <- CountResult{Skipped: true, SkipReason: SkipMalformed, Path: job.Path}
+			continue
+		}
+		if err != nil {
+			LogFileError(job.Path, err)
+			err = NewFileError(job.Path, err)
 		}
 		results <- CountResult{
 			Stats: stats,
 			Error: err,
+			Path:  job.Path,
 		}
 	}
 }
@@ -263,16 +767,47 @@ func (w *Walker) collectResults(results <-chan CountResult, wg *sync.WaitGroup)
 
 	for result := range results {
 		w.mu.Lock()
-		if result.Error != nil {
-			w.errors = append(w.errors, result.Error)
+		if result.Skipped {
+			w.skipped = append(w.skipped, SkippedFile{Path: result.Path, Reason: result.SkipReason})
+		} else if result.Error != nil {
+			w.errors.Add(result.Error)
 		} else if result.Stats != nil {
-			w.results = append(w.results, result.Stats)
+			addFileStats(w.langStats, result.Stats)
+			for lang, lines := range result.Stats.Embedded {
+				w.embedded[lang] += lines
+			}
+			if w.retainFiles {
+				w.results = append(w.results, result.Stats)
+			}
 			w.processedFiles++
 		}
+		w.settled++
+		w.settledCond.Broadcast()
 		w.mu.Unlock()
+		if w.progress != nil {
+			var stats *FileStats
+			if !result.Skipped && result.Error == nil {
+				stats = result.Stats
+			}
+			w.progress.counted(result.Path, stats)
+		}
 	}
 }
 
+// GetLanguageStats returns the per-language totals of every counted file
+func (w *Walker) GetLanguageStats() map[string]*LanguageStats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.langStats
+}
+
+// GetEmbedded returns the embedded language lines found across all files
+func (w *Walker) GetEmbedded() map[string]int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.embedded
+}
+
 // GetProcessedCount returns the number of processed files
 func (w *Walker) GetProcessedCount() int {
 	w.mu.Lock()
@@ -284,12 +819,87 @@ func (w *Walker) GetProcessedCount() int {
 func (w *Walker) GetSkippedCount() int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return w.skippedFiles
+	return len(w.skipped)
 }
 
-// GetErrorCount returns the number of errors encountered
+// GetSkippedFiles returns the skipped files and their reasons, sorted by path
+func (w *Walker) GetSkippedFiles() []SkippedFile {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	skipped := append([]SkippedFile(nil), w.skipped...)
+	sortSkippedFiles(skipped)
+	return skipped
+}
+
+// GetUnknownFiles returns the sorted paths of files skipped because no
+// language could be determined for them
+func (w *Walker) GetUnknownFiles() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var files []string
+	for _, sf := range w.skipped {
+		if sf.Reason == SkipUnknown {
+			files = append(files, sf.Path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// IsSampled reports whether the walk stopped at the SetSampleFiles limit
+func (w *Walker) IsSampled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.sampled
+}
+
+// GetErrorCount returns the number of errors encountered, including those
+// beyond the limit set with SetMaxErrors
 func (w *Walker) GetErrorCount() int {
 	w.mu.Lock()
 	defer w.mu.Unlock()
-	return len(w.errors)
+	return w.errors.Count()
+}
+
+// logClassified logs, at debug level, the language picked for a file and
+// what picked it
+func logClassified(path string, lang *Language, reason string) {
+	LogDebug("Classified %s as %s (%s)", path, lang.Name, reason)
+}
+
+// matchesAny reports whether name matches one of the glob patterns
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if match, err := filepath.Match(pattern, name); err == nil && match {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionLanguages returns generic counting rules, named after the
+// extension, for each of exts. Extensions are matched case-insensitively and
+// may be given without the leading dot. It returns nil for an empty list.
+func extensionLanguages(exts []string) map[string]*Language {
+	if len(exts) == 0 {
+		return nil
+	}
+
+	langs := make(map[string]*Language, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		langs[ext] = &Language{Name: ext, Extensions: []string{ext}}
+	}
+	return langs
+}
+
+// IsInterrupted reports whether the walk ended early because the context set
+// by SetContext was done
+func (w *Walker) IsInterrupted() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.interrupted
 }
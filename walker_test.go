@@ -1,8 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -418,3 +425,511 @@ func TestWalkerSkippedCount(t *testing.T) {
 		t.Errorf("Expected 1 processed file, got %d", walker.GetProcessedCount())
 	}
 }
+
+func TestWalkerWithoutRetainedFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "a.go"), []byte("package main\n\n// comment\nfunc a() {}\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "b.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "c.py"), []byte("x = 1\n"), 0644)
+
+	walker := NewWalker(tmpDir, 2)
+	walker.SetRetainFiles(false)
+	stats, errs := walker.Walk()
+
+	if len(errs) > 0 {
+		t.Fatalf("Walk returned errors: %v", errs)
+	}
+	if len(stats) != 0 {
+		t.Errorf("Expected no retained file records, got %d", len(stats))
+	}
+	if walker.GetProcessedCount() != 3 {
+		t.Errorf("Expected 3 processed files, got %d", walker.GetProcessedCount())
+	}
+
+	langStats := walker.GetLanguageStats()
+	goStats := langStats["Go"]
+	if goStats == nil || goStats.FileCount != 2 || goStats.CodeLines != 3 || goStats.CommentLines != 1 || goStats.BlankLines != 1 {
+		t.Errorf("Unexpected Go stats: %+v", goStats)
+	}
+	if pyStats := langStats["Python"]; pyStats == nil || pyStats.FileCount != 1 || pyStats.CodeLines != 1 {
+		t.Errorf("Unexpected Python stats: %+v", pyStats)
+	}
+}
+
+func BenchmarkWalkRetainFiles(b *testing.B) {
+	tmpDir := b.TempDir()
+	content := []byte("package main\n\n// comment\nfunc main() {}\n")
+	for i := 0; i < 2000; i++ {
+		if err := os.WriteFile(filepath.Join(tmpDir, fmt.Sprintf("file%04d.go", i)), content, 0644); err != nil {
+			b.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	for _, retain := range []bool{true, false} {
+		b.Run(fmt.Sprintf("retain=%t", retain), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				walker := NewWalker(tmpDir, 4)
+				walker.SetRetainFiles(retain)
+				walker.Walk()
+			}
+		})
+	}
+}
+
+func TestWalkerSkipReasons(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":       "package main\n",
+		"main_test.go":  "package main\n",
+		"logo.png":      "\x89PNG",
+		".secret":       "token\n",
+		"data.unknown":  "???\n",
+		"broken.ipynb":  "{not json",
+		"gen/output.go": "package gen\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	walker.AddExcludePattern("*_test.go")
+	walker.Walk()
+
+	want := []SkippedFile{
+		{filepath.Join(tmpDir, ".secret"), SkipHidden},
+		{filepath.Join(tmpDir, "broken.ipynb"), SkipMalformed},
+		{filepath.Join(tmpDir, "data.unknown"), SkipUnknown},
+		{filepath.Join(tmpDir, "logo.png"), SkipBinary},
+		{filepath.Join(tmpDir, "main_test.go"), SkipExcluded},
+	}
+	if got := walker.GetSkippedFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSkippedFiles() = %v, want %v", got, want)
+	}
+	if got := walker.GetSkippedCount(); got != len(want) {
+		t.Errorf("GetSkippedCount() = %d, want %d", got, len(want))
+	}
+	if got := walker.GetUnknownFiles(); !reflect.DeepEqual(got, []string{filepath.Join(tmpDir, "data.unknown")}) {
+		t.Errorf("GetUnknownFiles() = %v", got)
+	}
+}
+
+func TestWalkerSampleFiles(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, name := range []string{"b.go", "a/2.go", "a/1.go", "c.py", "d/e.rs", "notes.unknown"} {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("x\n"), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	for run := 0; run < 2; run++ {
+		walker := NewWalker(tmpDir, 4)
+		walker.SetSampleFiles(3)
+		results, _ := walker.Walk()
+
+		var paths []string
+		for _, fs := range results {
+			paths = append(paths, fs.FilePath)
+		}
+		sort.Strings(paths)
+		want := []string{filepath.Join(tmpDir, "a/1.go"), filepath.Join(tmpDir, "a/2.go"), filepath.Join(tmpDir, "b.go")}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("Sampled files = %v, want %v", paths, want)
+		}
+		if walker.GetProcessedCount() != 3 || !walker.IsSampled() {
+			t.Errorf("Processed %d files, sampled %t; want 3, true", walker.GetProcessedCount(), walker.IsSampled())
+		}
+	}
+
+	walker := NewWalker(tmpDir, 4)
+	walker.SetSampleFiles(10)
+	walker.Walk()
+	if walker.GetProcessedCount() != 5 || walker.IsSampled() {
+		t.Errorf("A limit above the file count should count every file, got %d", walker.GetProcessedCount())
+	}
+
+	// A file that cannot be read does not use up the sample
+	defer func() { countFile = CountLinesContext }()
+	countFile = func(ctx context.Context, path string, lang *Language, opts CountOptions) (*FileStats, error) {
+		if filepath.Base(path) == "2.go" {
+			return nil, errors.New("read failed")
+		}
+		return CountLinesContext(ctx, path, lang, opts)
+	}
+	SetLogLevel(LogLevelSilent)
+	defer SetLogLevel(LogLevelInfo)
+	for _, workers := range []int{1, 4} {
+		walker := NewWalker(tmpDir, workers)
+		walker.SetSampleFiles(3)
+		results, errs := walker.Walk()
+
+		var paths []string
+		for _, fs := range results {
+			paths = append(paths, fs.FilePath)
+		}
+		sort.Strings(paths)
+		want := []string{filepath.Join(tmpDir, "a/1.go"), filepath.Join(tmpDir, "b.go"), filepath.Join(tmpDir, "c.py")}
+		if !reflect.DeepEqual(paths, want) {
+			t.Errorf("Sampled files with a read error = %v, want %v", paths, want)
+		}
+		if len(errs) != 1 || walker.GetProcessedCount() != 3 || !walker.IsSampled() {
+			t.Errorf("Got %d errors, processed %d files, sampled %t; want 1, 3, true", len(errs), walker.GetProcessedCount(), walker.IsSampled())
+		}
+	}
+}
+
+func TestWalkerSkipEmpty(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":         "package main\n",
+		"placeholder.go":  "",
+		"pkg/__init__.py": "",
+		"pkg/util.py":     "x = 1\n",
+		"pkg/blank.py":    "\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	fileCounts := func(skipEmpty bool) (map[string]int, *Walker) {
+		walker := NewWalker(tmpDir, 2)
+		walker.SetSkipEmpty(skipEmpty)
+		walker.Walk()
+		counts := make(map[string]int)
+		for lang, ls := range walker.GetLanguageStats() {
+			counts[lang] = ls.FileCount
+		}
+		return counts, walker
+	}
+
+	counts, walker := fileCounts(true)
+	if counts["Go"] != 1 || counts["Python"] != 2 {
+		t.Errorf("With --skip-empty, file counts = %v, want 1 Go and 2 Python", counts)
+	}
+	if got := CountSkipReasons(walker.GetSkippedFiles())[SkipEmpty]; got != 2 || walker.GetSkippedCount() != 2 {
+		t.Errorf("Skipped %d empty files of %d, want 2 of 2", got, walker.GetSkippedCount())
+	}
+
+	counts, _ = fileCounts(false)
+	if counts["Go"] != 2 || counts["Python"] != 3 {
+		t.Errorf("Without --skip-empty, file counts = %v, want 2 Go and 3 Python", counts)
+	}
+}
+
+func TestWalkerSkipsSubmodules(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":           "package main\n",
+		"lib/.git":          "gitdir: ../.git/modules/lib\n",
+		"lib/lib.go":        "package lib\n",
+		"deps/one/one.go":   "package one\n",
+		"pkg/pkg.go":        "package pkg\n",
+		".gitmodules":       "[submodule \"lib\"]\n\tpath = lib\n[submodule \"one\"]\n\tpath = deps/one\n\turl = https://example.com/one.git\n",
+		"pkg/nested/.git":   "gitdir: ../../.git/modules/nested\n",
+		"pkg/nested/sub.go": "package nested\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	walker.Walk()
+	if got := walker.GetLanguageStats()["Go"].FileCount; got != 2 {
+		t.Errorf("Counted %d Go files, want 2 with submodules skipped", got)
+	}
+
+	walker = NewWalker(tmpDir, 2)
+	walker.SetIncludeSubmodules(true)
+	walker.Walk()
+	if got := walker.GetLanguageStats()["Go"].FileCount; got != 5 {
+		t.Errorf("Counted %d Go files, want 5 with submodules included", got)
+	}
+
+	// Counting inside a submodule counts its files
+	walker = NewWalker(filepath.Join(tmpDir, "lib"), 2)
+	walker.Walk()
+	if got := walker.GetProcessedCount(); got != 1 {
+		t.Errorf("Counted %d files inside the submodule, want 1", got)
+	}
+}
+
+func TestWalkerDataExtensions(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":          "package main\n",
+		"package.json":     "{\n  \"name\": \"app\"\n}\n",
+		"Cargo.lock":       "[[package]]\nname = \"app\"\n",
+		"vendor.min.js":    "var a=1;\n",
+		"app.js":           "// app\nvar a = 1;\n",
+		"schema/data.JSON": "{}\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	walker.SetDataExtensions(DefaultDataExtensions)
+	walker.Walk()
+	langStats := walker.GetLanguageStats()
+	if langStats["Data"] == nil || langStats["Data"].FileCount != 4 {
+		t.Fatalf("Expected package.json, Cargo.lock, vendor.min.js and data.JSON as Data, got %+v", langStats["Data"])
+	}
+	if langStats["Data"].CodeLines != 7 {
+		t.Errorf("Data code lines = %d, want 7", langStats["Data"].CodeLines)
+	}
+	if langStats["JSON"] != nil {
+		t.Errorf("JSON files should be reported as Data, got %+v", langStats["JSON"])
+	}
+	if langStats["JavaScript"] == nil || langStats["JavaScript"].FileCount != 1 || langStats["Go"] == nil {
+		t.Errorf("Code files should keep their language: %+v", langStats)
+	}
+
+	walker = NewWalker(tmpDir, 2)
+	walker.Walk()
+	langStats = walker.GetLanguageStats()
+	if langStats["Data"] != nil || langStats["JSON"] == nil || langStats["JSON"].FileCount != 2 {
+		t.Errorf("Without data extensions, JSON files should be counted as JSON: %+v", langStats)
+	}
+}
+
+func TestWalkerLogsClassification(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":  "package main\n",
+		"Makefile": "all:\n",
+		"deploy":   "#!/usr/bin/env bash\necho hi\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	SetLogLevel(LogLevelDebug)
+	SetLogOutput(&out)
+	defer func() {
+		SetLogLevel(LogLevelInfo)
+		SetLogOutput(os.Stderr)
+	}()
+
+	walker := NewWalker(tmpDir, 2)
+	walker.SetUseShebang(true)
+	walker.Walk()
+
+	for _, want := range []string{
+		"Classified " + filepath.Join(tmpDir, "main.go") + " as Go (ext .go)",
+		"Classified " + filepath.Join(tmpDir, "Makefile") + " as Makefile (filename)",
+		"Classified " + filepath.Join(tmpDir, "deploy") + " as Bash (shebang)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Debug output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+// BenchmarkScanDir counts 50 files of 1,000 lines in 5 directories. Counting
+// lines as strings cost 35982 allocs/op (4.8 MB/op); counting their bytes
+// brought it down to 981 allocs/op (3.7 MB/op).
+func BenchmarkScanDir(b *testing.B) {
+	tmpDir := b.TempDir()
+	src := benchmarkSource(1000)
+	for i := 0; i < 50; i++ {
+		path := filepath.Join(tmpDir, fmt.Sprintf("pkg%d", i%5), fmt.Sprintf("file%d.go", i))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		walker := NewWalker(tmpDir, 4)
+		walker.Walk()
+		if walker.GetProcessedCount() != 50 {
+			b.Fatalf("Processed %d files, want 50", walker.GetProcessedCount())
+		}
+	}
+}
+
+func TestWalkerPreferences(t *testing.T) {
+	tmpDir := t.TempDir()
+	// C++ content with a modeline claiming C
+	header := "// vim: set ft=c:\n#include <vector>\n\nclass Widget {\npublic:\n    std::vector<int> parts;\n};\n"
+	os.WriteFile(filepath.Join(tmpDir, "widget.h"), []byte(header), 0644)
+	os.WriteFile(filepath.Join(tmpDir, "main.c"), []byte("int main(void) { return 0; }\n"), 0644)
+
+	languages := func(preferred map[string]*Language) map[string]int {
+		walker := NewWalker(tmpDir, 2)
+		walker.SetUseModeline(true)
+		walker.SetSniffContent(true)
+		walker.SetPreferences(preferred)
+		walker.Walk()
+		counts := make(map[string]int)
+		for lang, ls := range walker.GetLanguageStats() {
+			counts[lang] = ls.FileCount
+		}
+		return counts
+	}
+
+	if got := languages(nil); got["C"] != 2 {
+		t.Errorf("Without preferences, got %v; want the modeline to count widget.h as C", got)
+	}
+
+	config := &Config{Prefer: map[string]string{".h": "cpp"}}
+	preferred, err := config.preferredLanguages()
+	if err != nil {
+		t.Fatalf("preferredLanguages() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if got := languages(preferred); got["C++"] != 1 || got["C"] != 1 {
+			t.Fatalf("With h=cpp, got %v; want widget.h counted as C++", got)
+		}
+	}
+
+	if _, err := (&Config{Prefer: map[string]string{".h": "Klingon"}}).preferredLanguages(); err == nil {
+		t.Error("Expected an unknown preferred language to fail")
+	}
+}
+
+func TestPreferFlag(t *testing.T) {
+	prefer := make(map[string]string)
+	if err := preferFlag(prefer).Set("h=C++, .M=Objective-C"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+	if want := map[string]string{".h": "C++", ".m": "Objective-C"}; !reflect.DeepEqual(prefer, want) {
+		t.Errorf("Set() = %v, want %v", prefer, want)
+	}
+	for _, value := range []string{"h", "=C++", "h=", ".=C"} {
+		if err := preferFlag(prefer).Set(value); err == nil {
+			t.Errorf("Set(%q) should fail", value)
+		}
+	}
+}
+
+func TestWalkerFollowSymlinks(t *testing.T) {
+	tmpDir := t.TempDir()
+	real := filepath.Join(tmpDir, "real")
+	if err := os.MkdirAll(real, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	for link, target := range map[string]string{
+		"a.go":        filepath.Join("real", "main.go"),
+		"b.go":        filepath.Join("real", "main.go"),
+		"linked":      "real",
+		"real/parent": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(tmpDir, link)); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+	}
+
+	walker := NewWalker(tmpDir, 2)
+	walker.SetFollowSymlinks(true)
+	walker.Walk()
+	stats := walker.GetLanguageStats()["Go"]
+	if stats == nil || stats.FileCount != 1 || stats.CodeLines != 2 {
+		t.Fatalf("Go stats = %+v, want the real file counted once", stats)
+	}
+	skipped := 0
+	for _, file := range walker.GetSkippedFiles() {
+		if file.Reason == SkipLinked {
+			skipped++
+		}
+	}
+	if skipped != 2 {
+		t.Errorf("Skipped %d files as already counted, want 2: %v", skipped, walker.GetSkippedFiles())
+	}
+
+	// Without following, each link to the file is counted and linked
+	// directories are not walked
+	walker = NewWalker(tmpDir, 2)
+	walker.Walk()
+	if stats := walker.GetLanguageStats()["Go"]; stats == nil || stats.FileCount != 3 {
+		t.Errorf("Go stats without following = %+v, want 3 files", stats)
+	}
+}
+
+func TestWalkerProgressDirs(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := map[string]string{
+		"main.go":           "package main\n\nfunc main() {}\n",
+		"src/a.go":          "package src\n",
+		"src/b.go":          "package src\n\nvar x = 1\n",
+		"src/deep/c.py":     "x = 1\n",
+		"src/notes.unknown": "???\n",
+		"empty/readme.bin":  "\x00",
+	}
+	for name, content := range files {
+		path := filepath.Join(tmpDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create file: %v", err)
+		}
+	}
+
+	var out bytes.Buffer
+	SetLogLevel(LogLevelInfo)
+	SetLogOutput(&out)
+	defer SetLogOutput(os.Stderr)
+
+	walker := NewWalker(tmpDir, 4)
+	walker.SetProgressDirs(true)
+	walker.Walk()
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if strings.Contains(line, "Processed directory") {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	want := []string{
+		"[INFO] Processed directory .: 1 files, 2 code lines",
+		"[INFO] Processed directory " + filepath.Join("src", "deep") + ": 1 files, 1 code lines",
+		"[INFO] Processed directory src: 2 files, 3 code lines",
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("Progress lines = %q, want %q", lines, want)
+	}
+
+	// Nothing is logged by default
+	out.Reset()
+	NewWalker(tmpDir, 4).Walk()
+	if strings.Contains(out.String(), "Processed directory") {
+		t.Errorf("Expected no progress lines without SetProgressDirs:\n%s", out.String())
+	}
+}